@@ -0,0 +1,172 @@
+package seed
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// registered functions, by name
+var mapFunctions = map[string]MapFn{}
+var reduceFunctions = map[string]ReduceFn{}
+
+// the import paths of the packages defining the registered functions,
+// by name
+var mapPackages = map[string]string{}
+var reducePackages = map[string]string{}
+
+// RegisterMap makes a map function available to Seeds by name and
+// records the package defining it (see FunctionPackages).
+// It panics if the name is already registered.
+func RegisterMap(name string, function MapFn) {
+	if _, ok := mapFunctions[name]; ok {
+		panic("seed: RegisterMap called twice for " + name)
+	}
+	mapFunctions[name] = function
+	mapPackages[name] = packageOf(function)
+}
+
+// RegisterReduce makes a reduce function available to Seeds by name
+// and records the package defining it (see FunctionPackages).
+// It panics if the name is already registered.
+func RegisterReduce(name string, function ReduceFn) {
+	if _, ok := reduceFunctions[name]; ok {
+		panic("seed: RegisterReduce called twice for " + name)
+	}
+	reduceFunctions[name] = function
+	reducePackages[name] = packageOf(function)
+}
+
+// packageOf gives the import path of the package defining function
+func packageOf(function interface{}) string {
+	name := runtime.FuncForPC(reflect.ValueOf(function).Pointer()).Name()
+
+	// e.g., github.com/nathankerr/seed/transformation/quorum.version
+	slash := strings.LastIndex(name, "/")
+	dot := strings.Index(name[slash+1:], ".")
+	if dot < 0 {
+		return name
+	}
+	return name[:slash+1+dot]
+}
+
+// FunctionPackages lists the import paths of the packages which
+// registered the functions the Seed uses, other than this package and
+// main. A go program executing the Seed imports them for their
+// registrations.
+func (s *Seed) FunctionPackages() []string {
+	packagesmap := map[string]bool{} // map only used for uniqueness
+
+	maps, reduces := s.Functions()
+	for _, name := range maps {
+		packagesmap[mapPackages[name]] = true
+	}
+	for _, name := range reduces {
+		packagesmap[reducePackages[name]] = true
+	}
+
+	packages := []string{}
+	for path := range packagesmap {
+		switch path {
+		case "", "main", packageOf(RegisterMap):
+			// no-op
+		default:
+			packages = append(packages, path)
+		}
+	}
+	sort.Strings(packages)
+
+	return packages
+}
+
+// Functions lists the names of the map and reduce functions the Seed
+// requires from the host environment.
+func (s *Seed) Functions() (maps []string, reduces []string) {
+	mapsmap := map[string]bool{} // maps only used for uniqueness
+	reducesmap := map[string]bool{}
+
+	for _, rule := range s.Rules {
+		for _, expression := range rule.Intension {
+			switch value := expression.(type) {
+			case QualifiedColumn:
+				// no-op
+			case MapFunction:
+				mapsmap[value.Name] = true
+			case ReduceFunction:
+				reducesmap[value.Name] = true
+			default:
+				panic(fmt.Sprintf("unhandled type: %v", reflect.TypeOf(expression).String()))
+			}
+		}
+	}
+
+	for name := range mapsmap {
+		maps = append(maps, name)
+	}
+	sort.Strings(maps)
+
+	for name := range reducesmap {
+		reduces = append(reduces, name)
+	}
+	sort.Strings(reduces)
+
+	return maps, reduces
+}
+
+// ValidateFunctions returns an error listing each function required
+// by the Seed that has not been registered. It is separate from
+// Validate because only executing a Seed needs the functions; writing
+// it out, e.g., as go whose functions are registered by other files in
+// the build, does not.
+func (s *Seed) ValidateFunctions() error {
+	missing := []string{}
+
+	maps, reduces := s.Functions()
+	for _, name := range maps {
+		if _, ok := mapFunctions[name]; !ok {
+			missing = append(missing, fmt.Sprintf("(%s)", name))
+		}
+	}
+	for _, name := range reduces {
+		if _, ok := reduceFunctions[name]; !ok {
+			missing = append(missing, fmt.Sprintf("{%s}", name))
+		}
+	}
+
+	if len(missing) > 0 {
+		return errorMessagef("Missing functions: %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// BindFunctions fills in the Function of each map and reduce function
+// in the Seed's rules with the registered function of the same name.
+// Functions which are not registered are listed in the returned error.
+func (s *Seed) BindFunctions() error {
+	err := s.ValidateFunctions()
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range s.Rules {
+		for i, expression := range rule.Intension {
+			switch value := expression.(type) {
+			case QualifiedColumn:
+				// no-op
+			case MapFunction:
+				value.Function = mapFunctions[value.Name]
+				rule.Intension[i] = value
+			case ReduceFunction:
+				value.Function = reduceFunctions[value.Name]
+				rule.Intension[i] = value
+			default:
+				panic(fmt.Sprintf("unhandled type: %v", reflect.TypeOf(expression).String()))
+			}
+		}
+	}
+
+	return nil
+}
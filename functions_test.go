@@ -0,0 +1,130 @@
+package seed
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func init() {
+	RegisterMap("functions_test_map", func(input Tuple) Element { return input[0] })
+	RegisterReduce("functions_test_reduce", func(input []Tuple) Element { return len(input) })
+}
+
+func functionsSeed(t *testing.T, rules string) *Seed {
+	s, err := FromSeed("functions", []byte("input in [key] => [value]\ntable out [key] => [value]\n"+rules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestFunctions(t *testing.T) {
+	tests := []struct {
+		rules   string
+		maps    []string
+		reduces []string
+	}{
+		{"out <+ [in.key, in.value]\n", nil, nil},
+		{"out <+ [in.key, (second in.value)]\nout <+ [in.key, (first in.value)]\nout <+ [in.key, (first in.key)]\n", []string{"first", "second"}, nil},
+		{"out <+ [in.key, {count in.value}]\nout <+ [in.key, (count in.value)]\n", []string{"count"}, []string{"count"}},
+	}
+
+	for _, test := range tests {
+		maps, reduces := functionsSeed(t, test.rules).Functions()
+		if !reflect.DeepEqual(maps, test.maps) || !reflect.DeepEqual(reduces, test.reduces) {
+			t.Errorf("%q: expected %v %v, got %v %v", test.rules, test.maps, test.reduces, maps, reduces)
+		}
+	}
+}
+
+func TestValidateFunctions(t *testing.T) {
+	tests := []struct {
+		rules   string
+		missing string // empty when valid
+	}{
+		{"out <+ [in.key, in.value]\n", ""},
+		{"out <+ [in.key, (functions_test_map in.value)]\nout <+ [in.key, {functions_test_reduce in.value}]\n", ""},
+		{"out <+ [in.key, {count in.value}]\n", ""},
+		// missing
+		{"out <+ [in.key, (functions_test_missing in.value)]\n", "(functions_test_missing)"},
+		// registered as the other kind of function
+		{"out <+ [in.key, {functions_test_map in.value}]\n", "{functions_test_map}"},
+		{"out <+ [in.key, (count in.value)]\n", "(count)"},
+		// all are listed
+		{"out <+ [in.key, (functions_test_missing in.value)]\nout <+ [in.key, {functions_test_map in.value}]\n", "(functions_test_missing), {functions_test_map}"},
+	}
+
+	for _, test := range tests {
+		s := functionsSeed(t, test.rules)
+
+		for name, err := range map[string]error{"ValidateFunctions": s.ValidateFunctions(), "BindFunctions": s.BindFunctions()} {
+			switch {
+			case test.missing == "" && err != nil:
+				t.Errorf("%s(%q): unexpected error %s", name, test.rules, err)
+			case test.missing != "" && err == nil:
+				t.Errorf("%s(%q): expected %s to be missing", name, test.rules, test.missing)
+			case test.missing != "" && !strings.HasSuffix(err.Error(), "Missing functions: "+test.missing):
+				t.Errorf("%s(%q): expected %s to be missing, got %s", name, test.rules, test.missing, err)
+			}
+		}
+	}
+}
+
+func TestBindFunctions(t *testing.T) {
+	s := functionsSeed(t, "out <+ [in.key, (functions_test_map in.value), {functions_test_reduce in.value}]\n")
+	err := s.BindFunctions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mapFunction := s.Rules[0].Intension[1].(MapFunction)
+	if mapFunction.Function == nil || mapFunction.Function(Tuple{"a"}) != "a" {
+		t.Errorf("%s was not bound", mapFunction.Name)
+	}
+	reduceFunction := s.Rules[0].Intension[2].(ReduceFunction)
+	if reduceFunction.Function == nil || reduceFunction.Function([]Tuple{{1}, {2}}) != 2 {
+		t.Errorf("%s was not bound", reduceFunction.Name)
+	}
+}
+
+func TestRegisterTwice(t *testing.T) {
+	tests := map[string]func(){
+		"RegisterMap":    func() { RegisterMap("functions_test_map", nil) },
+		"RegisterReduce": func() { RegisterReduce("count", nil) },
+	}
+
+	for name, register := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s should panic for a name which is already registered", name)
+				}
+			}()
+			register()
+		}()
+	}
+}
+
+func TestFunctionPackages(t *testing.T) {
+	tests := []struct {
+		function interface{}
+		path     string
+	}{
+		{strings.TrimSpace, "strings"},
+		{RegisterMap, "github.com/nathankerr/seed"},
+		// closures are named after the function they are in
+		{func() {}, "github.com/nathankerr/seed"},
+	}
+	for _, test := range tests {
+		if path := packageOf(test.function); path != test.path {
+			t.Errorf("expected %s, got %s", test.path, path)
+		}
+	}
+
+	// neither this package nor main need to be imported
+	s := functionsSeed(t, "out <+ [in.key, (functions_test_map in.value), {count in.value}]\n")
+	if packages := s.FunctionPackages(); len(packages) != 0 {
+		t.Errorf("expected no packages, got %v", packages)
+	}
+}
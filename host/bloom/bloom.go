@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/nathankerr/seed"
 	"reflect"
+	"sort"
 	"strings"
 )
 
@@ -12,9 +13,33 @@ import (
 func ToBloom(s *seed.Seed, name string) ([]byte, error) {
 	str := fmt.Sprintf("module %s\n", strings.Title(name))
 
+	// rules, reductions bloom cannot group directly are rewritten
+	// using helper collections
+	collections := map[string]*seed.Collection{}
+	for cname, collection := range s.Collections {
+		collections[cname] = collection
+	}
+	rules := []string{}
+	for ruleNum, rule := range s.Rules {
+		_, grouped := groupToBloom(rule)
+		if grouped || !hasReductions(rule) {
+			rules = append(rules, fmt.Sprintf("%s # rule %d",
+				ruleToBloom(rule), ruleNum))
+			continue
+		}
+
+		helpers, rewritten := reductionToBloom(s, rule, ruleNum)
+		for cname, collection := range helpers {
+			collections[cname] = collection
+		}
+		for _, r := range rewritten {
+			rules = append(rules, fmt.Sprintf("%s # rule %d", r, ruleNum))
+		}
+	}
+
 	// collections
 	str = fmt.Sprintf("%s  state do\n", str)
-	for cname, collection := range s.Collections {
+	for cname, collection := range collections {
 		str = fmt.Sprintf("%s    %s\n",
 			str,
 			collectionToBloom(collection, cname),
@@ -24,49 +49,43 @@ func ToBloom(s *seed.Seed, name string) ([]byte, error) {
 
 	// rules
 	str = fmt.Sprintf("%s\n  bloom do\n", str)
-	for ruleNum, rule := range s.Rules {
-		str = fmt.Sprintf("%s    %s # rule %d\n",
-			str,
-			ruleToBloom(rule),
-			ruleNum,
-		)
+	for _, rule := range rules {
+		str = fmt.Sprintf("%s    %s\n", str, rule)
 	}
 	str = fmt.Sprintf("%s  end\n", str)
 
 	return []byte(fmt.Sprintf("%send\n", str)), nil
 }
 
-func ruleToBloom(r *seed.Rule) string {
-	var selecter string
-	collections := r.Requires()
+// the standard reduce functions which have native bloom aggregates
+// accum gathers a set, so collect, which keeps repeated values, is not
+// one of them
+var aggregates = map[string]string{
+	"count":    "count",
+	"sum":      "sum",
+	"min":      "min",
+	"max":      "max",
+	"avg":      "avg",
+	"distinct": "accum",
+}
 
-	index := make(map[string]string)
-	names := []string{}
-	for i, c := range collections {
-		name := fmt.Sprintf("c%d", i)
-		index[c] = name
-		names = append(names, name)
+func ruleToBloom(r *seed.Rule) string {
+	if grouped, ok := groupToBloom(r); ok {
+		return grouped
 	}
 
+	collections := r.Requires()
+	sort.Strings(collections)
+	index, names := blockNames(collections)
+
 	intension := []string{}
 	for _, expression := range r.Intension {
 		switch value := expression.(type) {
-		case seed.QualifiedColumn:
-			intension = append(intension, fmt.Sprintf("%s.%s",
-				index[value.Collection], value.Column))
-		case seed.MapFunction:
-			arguments := []string{}
-			for _, qc := range value.Arguments {
-				arguments = append(arguments, fmt.Sprintf("%s.%s",
-					index[qc.Collection], qc.Column))
-			}
-
-			intension = append(intension, fmt.Sprintf("%s(%s)",
-				value.Name, strings.Join(arguments, ", ")))
+		case seed.QualifiedColumn, seed.MapFunction:
+			intension = append(intension, expressionToBloom(value, index))
 		case seed.ReduceFunction:
 			for _, qc := range value.Arguments {
-				intension = append(intension, fmt.Sprintf("%s.%s",
-					index[qc.Collection], qc.Column))
+				intension = append(intension, expressionToBloom(qc, index))
 			}
 		default:
 			panic(fmt.Sprintf("unhandled type: %v",
@@ -74,6 +93,44 @@ func ruleToBloom(r *seed.Rule) string {
 		}
 	}
 
+	return fmt.Sprintf("%s %s %s",
+		r.Supplies,
+		r.Operation,
+		selecterToBloom(collections, names, r.Predicate, intension))
+}
+
+// blockNames names the block parameter used for each collection
+func blockNames(collections []string) (map[string]string, []string) {
+	index := make(map[string]string)
+	names := []string{}
+	for i, c := range collections {
+		name := fmt.Sprintf("c%d", i)
+		index[c] = name
+		names = append(names, name)
+	}
+	return index, names
+}
+
+func expressionToBloom(expression seed.Expression, index map[string]string) string {
+	switch value := expression.(type) {
+	case seed.QualifiedColumn:
+		return fmt.Sprintf("%s.%s", index[value.Collection], value.Column)
+	case seed.MapFunction:
+		arguments := []string{}
+		for _, qc := range value.Arguments {
+			arguments = append(arguments, expressionToBloom(qc, index))
+		}
+
+		return fmt.Sprintf("%s(%s)",
+			value.Name, strings.Join(arguments, ", "))
+	default:
+		panic(fmt.Sprintf("unhandled type: %v",
+			reflect.TypeOf(expression).String()))
+	}
+}
+
+func selecterToBloom(collections []string, names []string, predicate []seed.Constraint, intension []string) string {
+	var selecter string
 	if len(collections) == 1 {
 		selecter = fmt.Sprintf("%s do |%s|\n      [%s]\n    end",
 			collections[0],
@@ -81,7 +138,7 @@ func ruleToBloom(r *seed.Rule) string {
 			strings.Join(intension, ", "))
 	} else {
 		predicates := []string{}
-		for _, p := range r.Predicate {
+		for _, p := range predicate {
 			predicates = append(predicates, p.String())
 		}
 
@@ -92,10 +149,65 @@ func ruleToBloom(r *seed.Rule) string {
 			strings.Join(intension, ", "))
 	}
 
-	return fmt.Sprintf("%s %s %s",
+	return selecter
+}
+
+// groupToBloom uses bloom's group for rules which only reduce a
+// single collection with native aggregates and whose grouping columns
+// come before the reductions
+func groupToBloom(r *seed.Rule) (string, bool) {
+	collections := r.Requires()
+	if len(collections) != 1 {
+		return "", false
+	}
+	collection := collections[0]
+
+	groups := []string{}
+	reductions := []string{}
+	for _, expression := range r.Intension {
+		switch value := expression.(type) {
+		case seed.QualifiedColumn:
+			if len(reductions) > 0 {
+				return "", false
+			}
+			groups = append(groups, value.String())
+		case seed.MapFunction:
+			return "", false
+		case seed.ReduceFunction:
+			aggregate, ok := aggregates[value.Name]
+			if !ok {
+				return "", false
+			}
+
+			switch {
+			case aggregate == "count":
+				reductions = append(reductions, aggregate)
+			case len(value.Arguments) == 1:
+				reductions = append(reductions, fmt.Sprintf("%s(%s)",
+					aggregate, value.Arguments[0]))
+			default:
+				return "", false
+			}
+		default:
+			panic(fmt.Sprintf("unhandled type: %v",
+				reflect.TypeOf(expression).String()))
+		}
+	}
+	if len(reductions) == 0 {
+		return "", false
+	}
+
+	keys := "nil"
+	if len(groups) > 0 {
+		keys = fmt.Sprintf("[%s]", strings.Join(groups, ", "))
+	}
+
+	return fmt.Sprintf("%s %s %s.group(%s, %s)",
 		r.Supplies,
 		r.Operation,
-		selecter)
+		collection,
+		keys,
+		strings.Join(reductions, ", ")), true
 }
 
 func collectionToBloom(c *seed.Collection, name string) string {
@@ -112,6 +224,8 @@ func collectionToBloom(c *seed.Collection, name string) string {
 		declaration = "table"
 	case seed.CollectionScratch:
 		declaration = "scratch"
+	case seed.CollectionLmax, seed.CollectionLset, seed.CollectionLcounter, seed.CollectionLorset, seed.CollectionLregister:
+		return latticeToBloom(c, name)
 	default:
 		// shouldn't get here
 		panic(c.Type)
@@ -140,3 +254,32 @@ func collectionToBloom(c *seed.Collection, name string) string {
 
 	return declaration
 }
+
+// bloom lattices are single values; counters map replicas to counts,
+// or-sets tags to elements and registers are [timestamp, value] pairs
+var lattices = map[seed.CollectionType]string{
+	seed.CollectionLmax:      "lmax",
+	seed.CollectionLset:      "lset",
+	seed.CollectionLcounter:  "lmap",
+	seed.CollectionLorset:    "lmap",
+	seed.CollectionLregister: "lmax",
+}
+
+// latticeToBloom declares a lattice collection. Those with a single
+// column become that bloom lattice, the others an lmap from their key to
+// their lattice, with the columns noted in a comment.
+func latticeToBloom(c *seed.Collection, name string) string {
+	lattice := lattices[c.Type]
+	if len(c.Key) == 0 && len(c.Data) == 1 {
+		return fmt.Sprintf("%s :%s", lattice, name)
+	}
+
+	symbols := func(columns []string) string {
+		names := []string{}
+		for _, column := range columns {
+			names = append(names, ":"+column)
+		}
+		return strings.Join(names, ", ")
+	}
+	return fmt.Sprintf("lmap :%s # [%s] => %s [%s]", name, symbols(c.Key), lattice, symbols(c.Data))
+}
@@ -0,0 +1,260 @@
+package bloom
+
+import (
+	"github.com/nathankerr/seed"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestReductions(t *testing.T) {
+	type test struct {
+		filename string
+		expected []string
+	}
+
+	tests := []test{
+		test{
+			filename: "../../services/cart/cart.seed",
+			expected: []string{
+				"scratch :rule1_joined, [:cart, :checkout_cart, :log_cart, :log_seq, :items]",
+				"scratch :rule1_reduce1, [:cart] => [:items]",
+				"rule1_joined <= (checkout * log).combos(checkout.cart => log.cart) do |c0, c1|\n" +
+					"      [c0.cart, c0.cart, c1.cart, c1.seq, [c1.item, c1.num]]\n" +
+					"    end # rule 1",
+				"rule1_reduce1 <= rule1_joined.group([rule1_joined.cart], accum(rule1_joined.items)) # rule 1",
+				"response <+ rule1_reduce1 do |c0|\n" +
+					"      [c0.cart, accumulate_items(c0.items)]\n" +
+					"    end # rule 1",
+			},
+		},
+		test{
+			filename: "../../services/price/price.seed",
+			expected: []string{
+				"response <+ request.group([request.item], sum(request.number_of_item)) # rule 0",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		source, err := ioutil.ReadFile(test.filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		service, err := seed.FromSeed(test.filename, source)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		output, err := ToBloom(service, "test")
+		if err != nil {
+			t.Errorf("%s: %s", test.filename, err)
+		}
+
+		for _, expected := range test.expected {
+			if !strings.Contains(string(output), expected) {
+				t.Errorf("%s: expected to contain\n%s\ngot\n%s", test.filename, expected, output)
+			}
+		}
+	}
+}
+
+func TestFromBloom(t *testing.T) {
+	filenames := []string{
+		"../../services/kvs/kvs.seed",
+		"../../services/price/price.seed",
+		"../../services/time/time.seed",
+		"../../services/cart/cart.seed",
+		"../../tutorial/start/kvs.seed",
+		"../../tutorial/put/kvs.seed",
+		"../../tutorial/map/kvs.seed",
+		"../../tutorial/reduce/kvs.seed",
+		"../../tutorial/client/kvs.seed",
+		"../../tutorial/compile/kvs.seed",
+		"../../tutorial/replicate/kvs.seed",
+	}
+
+	for _, filename := range filenames {
+		source, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		original, err := seed.FromSeed(filename, source)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		exported, err := ToBloom(original, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		imported, err := FromBloom(filename, exported)
+		if err != nil {
+			t.Fatalf("%s: %s\n%s", filename, err, exported)
+		}
+
+		err = imported.Validate()
+		if err != nil {
+			t.Errorf("%s: %s", filename, err)
+		}
+
+		if len(imported.Collections) != len(original.Collections) {
+			t.Errorf("%s: expected %d collections, got %d", filename, len(original.Collections), len(imported.Collections))
+		}
+		for name, collection := range original.Collections {
+			importedCollection, ok := imported.Collections[name]
+			if !ok {
+				t.Errorf("%s: %s missing", filename, name)
+				continue
+			}
+
+			if importedCollection.String(name) != collection.String(name) {
+				t.Errorf("%s: expected %s, got %s", filename, collection.String(name), importedCollection.String(name))
+			}
+		}
+
+		if len(imported.Rules) != len(original.Rules) {
+			t.Fatalf("%s: expected %d rules, got %d", filename, len(original.Rules), len(imported.Rules))
+		}
+		for i, rule := range original.Rules {
+			if imported.Rules[i].String() != rule.String() {
+				t.Errorf("%s: expected\n%s\ngot\n%s", filename, rule, imported.Rules[i])
+			}
+		}
+	}
+}
+
+func TestFromHandwrittenBloom(t *testing.T) {
+	filename := "../../services/kvs/simplekvsserver.rb"
+	source, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service, err := FromBloom(filename, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = service.Validate()
+	if err != nil {
+		t.Error(err)
+	}
+
+	expected := []string{
+		"kvstate <+- [kvput.key, kvput.value]",
+		"kvstate <- [kvstate.key, kvstate.value]: kvstate.key => kvdel.key",
+		"kvget_response <~ [kvget.client, kvstate.key, kvstate.value]: kvget.key => kvstate.key",
+	}
+	if len(service.Rules) != len(expected) {
+		t.Fatalf("expected %d rules, got %d", len(expected), len(service.Rules))
+	}
+	for i, rule := range service.Rules {
+		if rule.String() != expected[i] {
+			t.Errorf("expected\n%s\ngot\n%s", expected[i], rule)
+		}
+	}
+}
+
+func TestLattices(t *testing.T) {
+	source := []byte(`lset visitors [page] => [visitor]
+lcounter hits [page] => [counts]
+lorset carts [session] => [items]
+lregister status [page] => [message]
+`)
+	service, err := seed.FromSeed("lattices", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.Collections["latest"] = &seed.Collection{
+		Type: seed.CollectionLmax,
+		Data: []string{"at"},
+	}
+
+	output, err := ToBloom(service, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"lmax :latest\n",
+		"lmap :visitors # [:page] => lset [:visitor]\n",
+		"lmap :hits # [:page] => lmap [:counts]\n",
+		"lmap :carts # [:session] => lmap [:items]\n",
+		"lmap :status # [:page] => lmax [:message]\n",
+	} {
+		if !strings.Contains(string(output), expected) {
+			t.Errorf("expected to contain\n%s\ngot\n%s", expected, output)
+		}
+	}
+}
+
+func TestToBudProject(t *testing.T) {
+	source, err := ioutil.ReadFile("../../services/cart/cart.seed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service, err := seed.FromSeed("cart", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := ToBudProject(service, "CartServer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][]string{
+		"cartserver.rb": {"module CartServer\n"},
+		"functions.rb":  {"module CartServerFunctions\n", "def accumulate_items(tuples)\n"},
+		"server.rb":     {"require_relative 'cartserver'\n", "class CartServerServer\n", "include CartServer\n", "include CartServerFunctions\n"},
+		"run.rb":        {"require_relative 'server'\n", "CartServerServer.new("},
+		"Gemfile":       {"of CartServer;", "gem 'bud'\n"},
+	}
+	if len(files) != len(expected) {
+		t.Errorf("expected %d files, got %d", len(expected), len(files))
+	}
+	for filename, contents := range expected {
+		file, ok := files[filename]
+		if !ok {
+			t.Errorf("%s is missing", filename)
+			continue
+		}
+		for _, content := range contents {
+			if !strings.Contains(string(file), content) {
+				t.Errorf("%s: expected to contain %q, got\n%s", filename, content, file)
+			}
+		}
+	}
+}
+
+func TestFromBloomReductions(t *testing.T) {
+	source := []byte("input request [id, item] => [num]\n" +
+		"output response [item] => [total, requests, nums]\n" +
+		"response <+ [request.item, {sum request.num}, {count request.item}, {collect request.id request.num}]\n")
+	original, err := seed.FromSeed("reductions", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exported, err := ToBloom(original, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imported, err := FromBloom("reductions", exported)
+	if err != nil {
+		t.Fatalf("%s\n%s", err, exported)
+	}
+
+	if len(imported.Collections) != len(original.Collections) {
+		t.Errorf("expected %d collections, got %d", len(original.Collections), len(imported.Collections))
+	}
+	if len(imported.Rules) != 1 || imported.Rules[0].String() != original.Rules[0].String() {
+		t.Errorf("expected\n%s\ngot\n%v", original.Rules[0], imported.Rules)
+	}
+}
@@ -0,0 +1,1040 @@
+package bloom
+
+import (
+	"fmt"
+	"github.com/nathankerr/seed"
+	"strings"
+	"unicode"
+)
+
+// FromBloom loads a Seed from the state and bloom blocks of a bud
+// module. The supported subset is what ToBloom writes together with the
+// joins and projections commonly written by hand:
+//
+//	state:  table, scratch, channel, interface input and interface output
+//	        declarations
+//	rules:  collection
+//	        collection.payloads
+//	        collection.group(nil or [columns], aggregates)
+//	        (c1 * c2 ...).combos(predicates) or .pairs(predicates)
+//	        (c1 * c2).lefts(predicates) or .rights(predicates)
+//	        each optionally followed by a do |...| [expressions] end block
+//
+// Predicates and expressions use qualified columns (collection.column
+// or block_parameter.column) and map function calls. Predicates on
+// pairs of collections may also be written as :column => :column. Native
+// aggregates are converted to the standard reduce functions. The
+// rule<n>_joined and rule<n>_reduce<i> collections and rules ToBloom
+// uses for other reductions are folded back into the rule they came
+// from. Rules supplying stdio are skipped as Seed has no equivalent.
+// Anything else is reported as an error.
+func FromBloom(name string, input []byte) (*seed.Seed, error) {
+	tokens, err := tokenize(string(input))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{
+		tokens: tokens,
+		seed: &seed.Seed{
+			Name:        name,
+			Collections: make(map[string]*seed.Collection),
+		},
+	}
+
+	err = p.module()
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.foldReductions()
+	if err != nil {
+		return nil, err
+	}
+
+	return p.seed, nil
+}
+
+// bud aggregates and the standard reduce functions they become
+var reductions = map[string]string{
+	"count": "count",
+	"sum":   "sum",
+	"min":   "min",
+	"max":   "max",
+	"avg":   "avg",
+	"accum": "distinct",
+}
+
+type tokenKind int
+
+const (
+	tokenIdentifier tokenKind = iota
+	tokenSymbol               // :name, text without the :
+	tokenPunctuation
+	tokenOther // strings and numbers
+	tokenEOF
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	line int
+}
+
+// tokenize splits ruby source into the tokens needed for state and
+// bloom blocks. Comments are dropped.
+func tokenize(input string) ([]token, error) {
+	tokens := []token{}
+	runes := []rune(input)
+	line := 1
+
+	// multi-rune punctuation, longest first
+	operators := []string{"<+-", "<+", "<-", "<~", "<=", "=>", "::"}
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\n':
+			line++
+		case unicode.IsSpace(r):
+			// no-op
+		case r == '#':
+			for i+1 < len(runes) && runes[i+1] != '\n' {
+				i++
+			}
+		case r == '"' || r == '\'':
+			start := i
+			for i+1 < len(runes) && runes[i+1] != r {
+				if runes[i+1] == '\\' {
+					i++
+				}
+				if runes[i+1] == '\n' {
+					line++
+				}
+				i++
+			}
+			i++
+			if i >= len(runes) {
+				return nil, fmt.Errorf("line %d: unterminated string", line)
+			}
+			tokens = append(tokens, token{tokenOther, string(runes[start : i+1]), line})
+		case unicode.IsDigit(r):
+			start := i
+			for i+1 < len(runes) && (unicode.IsDigit(runes[i+1]) || runes[i+1] == '.' || runes[i+1] == '_') {
+				i++
+			}
+			tokens = append(tokens, token{tokenOther, string(runes[start : i+1]), line})
+		case isIdentifierStart(r):
+			start := i
+			for i+1 < len(runes) && isIdentifierPart(runes[i+1]) {
+				i++
+			}
+			if i+1 < len(runes) && (runes[i+1] == '?' || runes[i+1] == '!') {
+				i++
+			}
+			tokens = append(tokens, token{tokenIdentifier, string(runes[start : i+1]), line})
+		case r == ':' && i+1 < len(runes) && (isIdentifierStart(runes[i+1]) || runes[i+1] == '@'):
+			start := i + 1
+			i++
+			for i+1 < len(runes) && isIdentifierPart(runes[i+1]) {
+				i++
+			}
+			tokens = append(tokens, token{tokenSymbol, string(runes[start : i+1]), line})
+		default:
+			text := string(r)
+			for _, operator := range operators {
+				if strings.HasPrefix(string(runes[i:]), operator) {
+					text = operator
+					break
+				}
+			}
+			i += len([]rune(text)) - 1
+			tokens = append(tokens, token{tokenPunctuation, text, line})
+		}
+	}
+
+	return append(tokens, token{tokenEOF, "", line}), nil
+}
+
+func isIdentifierStart(r rune) bool {
+	return unicode.IsLetter(r) || r == '_' || r == '@'
+}
+
+func isIdentifierPart(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+type parser struct {
+	tokens   []token
+	position int
+	seed     *seed.Seed
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.position]
+}
+
+func (p *parser) peekAt(offset int) token {
+	if p.position+offset >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.position+offset]
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	if t.kind != tokenEOF {
+		p.position++
+	}
+	return t
+}
+
+func (p *parser) errorf(t token, format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s", t.line, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) expect(text string) error {
+	t := p.next()
+	if t.kind == tokenOther || t.text != text {
+		return p.errorf(t, "expected %q, got %q", text, t.text)
+	}
+	return nil
+}
+
+func (p *parser) identifier() (string, error) {
+	t := p.next()
+	if t.kind != tokenIdentifier {
+		return "", p.errorf(t, "expected a name, got %q", t.text)
+	}
+	return t.text, nil
+}
+
+func (p *parser) is(text string) bool {
+	t := p.peek()
+	return (t.kind == tokenIdentifier || t.kind == tokenPunctuation) && t.text == text
+}
+
+// module finds and parses the state and bloom blocks, skipping
+// everything else
+func (p *parser) module() error {
+	for p.peek().kind != tokenEOF {
+		switch {
+		case p.is("state") && p.peekAt(1).text == "do":
+			p.next()
+			p.next()
+			err := p.state()
+			if err != nil {
+				return err
+			}
+		case p.is("bloom") && p.peekAt(1).text == "do":
+			p.next()
+			p.next()
+			err := p.bloom()
+			if err != nil {
+				return err
+			}
+		case p.is("bloom") && p.peekAt(1).kind == tokenSymbol && p.peekAt(2).text == "do":
+			p.next()
+			p.next()
+			p.next()
+			err := p.bloom()
+			if err != nil {
+				return err
+			}
+		default:
+			p.next()
+		}
+	}
+
+	return nil
+}
+
+// state parses collection declarations until end
+func (p *parser) state() error {
+	for !p.is("end") {
+		start := p.peek()
+		if start.kind == tokenEOF {
+			return p.errorf(start, "state block is not closed")
+		}
+
+		keyword, err := p.identifier()
+		if err != nil {
+			return err
+		}
+
+		collection := &seed.Collection{}
+		switch keyword {
+		case "table":
+			collection.Type = seed.CollectionTable
+		case "scratch":
+			collection.Type = seed.CollectionScratch
+		case "channel":
+			collection.Type = seed.CollectionChannel
+		case "interface":
+			direction := p.next()
+			switch direction.text {
+			case "input":
+				collection.Type = seed.CollectionInput
+			case "output":
+				collection.Type = seed.CollectionOutput
+			default:
+				return p.errorf(direction, "unknown interface direction %q", direction.text)
+			}
+			err = p.expect(",")
+			if err != nil {
+				return err
+			}
+		default:
+			return p.errorf(start, "%s collections are not supported", keyword)
+		}
+
+		name := p.next()
+		if name.kind != tokenSymbol {
+			return p.errorf(name, "expected a collection name, got %q", name.text)
+		}
+		if _, ok := p.seed.Collections[name.text]; ok {
+			return p.errorf(name, "%s is declared more than once", name.text)
+		}
+
+		if p.is(",") {
+			p.next()
+			collection.Key, err = p.symbols()
+			if err != nil {
+				return err
+			}
+
+			if p.is("=>") {
+				p.next()
+				collection.Data, err = p.symbols()
+				if err != nil {
+					return err
+				}
+			}
+		} else {
+			// bud's default schema
+			collection.Key = []string{"key"}
+			collection.Data = []string{"val"}
+		}
+
+		p.seed.Collections[name.text] = collection
+	}
+	p.next()
+
+	return nil
+}
+
+// symbols parses [:a, :b, ...]
+func (p *parser) symbols() ([]string, error) {
+	err := p.expect("[")
+	if err != nil {
+		return nil, err
+	}
+
+	symbols := []string{}
+	for !p.is("]") {
+		t := p.next()
+		if t.kind != tokenSymbol {
+			return nil, p.errorf(t, "expected a column name, got %q", t.text)
+		}
+		symbols = append(symbols, t.text)
+
+		if p.is(",") {
+			p.next()
+		}
+	}
+	p.next()
+
+	return symbols, nil
+}
+
+// bloom parses rules until end
+func (p *parser) bloom() error {
+	for !p.is("end") {
+		if p.peek().kind == tokenEOF {
+			return p.errorf(p.peek(), "bloom block is not closed")
+		}
+
+		rule, err := p.rule()
+		if err != nil {
+			return err
+		}
+
+		if rule != nil {
+			p.seed.Rules = append(p.seed.Rules, rule)
+		}
+	}
+	p.next()
+
+	return nil
+}
+
+// rule parses supplies op source [block]. A nil rule is returned for
+// rules which are skipped.
+func (p *parser) rule() (*seed.Rule, error) {
+	start := p.peek()
+
+	supplies, err := p.identifier()
+	if err != nil {
+		return nil, err
+	}
+
+	operation := p.next()
+	switch operation.text {
+	case "<=", "<+", "<-", "<+-", "<~":
+		// known operations
+	default:
+		return nil, p.errorf(operation, "expected an operation, got %q", operation.text)
+	}
+
+	r := &seed.Rule{
+		Supplies:  supplies,
+		Operation: operation.text,
+	}
+
+	sources, intension, skip, err := p.source(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.is("do") || p.is("{") {
+		intension, err = p.block(sources)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if supplies == "stdio" || skip {
+		if supplies != "stdio" {
+			return nil, p.errorf(start, "only stdio can be supplied with inspected")
+		}
+		return nil, nil
+	}
+
+	collection, ok := p.seed.Collections[supplies]
+	if !ok {
+		return nil, p.errorf(start, "%s is not a declared collection", supplies)
+	}
+	columns := len(collection.Key) + len(collection.Data)
+	if len(intension) != columns {
+		return nil, p.errorf(start, "%s has %d columns, but the rule supplies %d", supplies, columns, len(intension))
+	}
+	r.Intension = intension
+
+	return r, nil
+}
+
+// source parses the collections a rule reads and any predicates,
+// giving the rule's intension when there is no block
+func (p *parser) source(r *seed.Rule) ([]string, []seed.Expression, bool, error) {
+	start := p.peek()
+
+	// joins
+	if p.is("(") {
+		p.next()
+
+		sources := []string{}
+		for {
+			t := p.peek()
+			name, err := p.collection()
+			if err != nil {
+				return nil, nil, false, err
+			}
+			for _, source := range sources {
+				if source == name {
+					return nil, nil, false, p.errorf(t, "self joins are not supported")
+				}
+			}
+			sources = append(sources, name)
+
+			if !p.is("*") {
+				break
+			}
+			p.next()
+		}
+
+		err := p.expect(")")
+		if err != nil {
+			return nil, nil, false, err
+		}
+		err = p.expect(".")
+		if err != nil {
+			return nil, nil, false, err
+		}
+
+		method, err := p.identifier()
+		if err != nil {
+			return nil, nil, false, err
+		}
+
+		switch method {
+		case "combos", "pairs", "lefts", "rights":
+			// supported
+		default:
+			return nil, nil, false, p.errorf(start, "%s is not supported", method)
+		}
+
+		if (method == "lefts" || method == "rights") && len(sources) != 2 {
+			return nil, nil, false, p.errorf(start, "%s needs two collections", method)
+		}
+
+		r.Predicate, err = p.predicates(sources)
+		if err != nil {
+			return nil, nil, false, err
+		}
+
+		intension := []seed.Expression{}
+		switch method {
+		case "lefts":
+			intension = p.columns(sources[0], false)
+		case "rights":
+			intension = p.columns(sources[1], false)
+		}
+
+		return sources, intension, false, nil
+	}
+
+	name, err := p.collection()
+	if err != nil {
+		return nil, nil, false, err
+	}
+	sources := []string{name}
+
+	if !p.is(".") {
+		return sources, p.columns(name, false), false, nil
+	}
+	p.next()
+
+	method, err := p.identifier()
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	switch method {
+	case "payloads":
+		return sources, p.columns(name, true), false, nil
+	case "inspected":
+		return sources, nil, true, nil
+	case "group":
+		intension, err := p.group(name)
+		return sources, intension, false, err
+	default:
+		return nil, nil, false, p.errorf(start, "%s is not supported", method)
+	}
+}
+
+// collection parses the name of a declared collection
+func (p *parser) collection() (string, error) {
+	t := p.peek()
+	name, err := p.identifier()
+	if err != nil {
+		return "", err
+	}
+
+	if _, ok := p.seed.Collections[name]; !ok {
+		return "", p.errorf(t, "%s is not a declared collection", name)
+	}
+
+	return name, nil
+}
+
+// columns lists the columns of a collection as qualified columns,
+// without the address column for payloads
+func (p *parser) columns(collectionName string, payloads bool) []seed.Expression {
+	collection := p.seed.Collections[collectionName]
+
+	intension := []seed.Expression{}
+	for _, column := range append(append([]string{}, collection.Key...), collection.Data...) {
+		if payloads && strings.HasPrefix(column, "@") {
+			continue
+		}
+		intension = append(intension, seed.QualifiedColumn{Collection: collectionName, Column: column})
+	}
+
+	return intension
+}
+
+// predicates parses (left => right, ...) with qualified columns or,
+// for two collections, :column => :column
+func (p *parser) predicates(sources []string) ([]seed.Constraint, error) {
+	err := p.expect("(")
+	if err != nil {
+		return nil, err
+	}
+
+	constraints := []seed.Constraint{}
+	for !p.is(")") {
+		t := p.peek()
+		if t.kind == tokenEOF {
+			return nil, p.errorf(t, "predicates are not closed")
+		}
+
+		var constraint seed.Constraint
+		if t.kind == tokenSymbol {
+			if len(sources) != 2 {
+				return nil, p.errorf(t, "column name predicates need two collections")
+			}
+
+			constraint.Left, err = p.symbolColumn(sources[0])
+			if err != nil {
+				return nil, err
+			}
+			err = p.expect("=>")
+			if err != nil {
+				return nil, err
+			}
+			constraint.Right, err = p.symbolColumn(sources[1])
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			params := map[string]string{}
+			constraint.Left, err = p.qualifiedColumn(sources, params)
+			if err != nil {
+				return nil, err
+			}
+			err = p.expect("=>")
+			if err != nil {
+				return nil, err
+			}
+			constraint.Right, err = p.qualifiedColumn(sources, params)
+			if err != nil {
+				return nil, err
+			}
+		}
+		constraints = append(constraints, constraint)
+
+		if p.is(",") {
+			p.next()
+		}
+	}
+	p.next()
+
+	return constraints, nil
+}
+
+func (p *parser) symbolColumn(collectionName string) (seed.QualifiedColumn, error) {
+	t := p.next()
+	if t.kind != tokenSymbol {
+		return seed.QualifiedColumn{}, p.errorf(t, "expected a column name, got %q", t.text)
+	}
+
+	return p.column(t, collectionName, t.text)
+}
+
+// column finds the column of a collection. Address columns match with
+// or without their @.
+func (p *parser) column(t token, collectionName string, columnName string) (seed.QualifiedColumn, error) {
+	collection := p.seed.Collections[collectionName]
+	for _, column := range append(append([]string{}, collection.Key...), collection.Data...) {
+		if column == columnName || strings.TrimPrefix(column, "@") == columnName {
+			return seed.QualifiedColumn{Collection: collectionName, Column: column}, nil
+		}
+	}
+
+	return seed.QualifiedColumn{}, p.errorf(t, "%s does not have a column named %s", collectionName, columnName)
+}
+
+// qualifiedColumn parses name.column, where name is a block parameter
+// or one of the sources
+func (p *parser) qualifiedColumn(sources []string, params map[string]string) (seed.QualifiedColumn, error) {
+	t := p.peek()
+	name, err := p.identifier()
+	if err != nil {
+		return seed.QualifiedColumn{}, err
+	}
+
+	collectionName, ok := params[name]
+	if !ok {
+		for _, source := range sources {
+			if source == name {
+				collectionName = name
+				ok = true
+			}
+		}
+	}
+	if !ok {
+		return seed.QualifiedColumn{}, p.errorf(t, "%s is not a collection used by the rule", name)
+	}
+
+	err = p.expect(".")
+	if err != nil {
+		return seed.QualifiedColumn{}, err
+	}
+
+	columnName, err := p.identifier()
+	if err != nil {
+		return seed.QualifiedColumn{}, err
+	}
+
+	return p.column(t, collectionName, columnName)
+}
+
+// group parses (nil or [columns], aggregates)
+func (p *parser) group(collectionName string) ([]seed.Expression, error) {
+	sources := []string{collectionName}
+	params := map[string]string{}
+
+	err := p.expect("(")
+	if err != nil {
+		return nil, err
+	}
+
+	intension := []seed.Expression{}
+	switch {
+	case p.is("nil"):
+		p.next()
+	case p.is("["):
+		p.next()
+		for !p.is("]") {
+			qc, err := p.qualifiedColumn(sources, params)
+			if err != nil {
+				return nil, err
+			}
+			intension = append(intension, qc)
+
+			if p.is(",") {
+				p.next()
+			}
+		}
+		p.next()
+	default:
+		return nil, p.errorf(p.peek(), "expected nil or grouping columns, got %q", p.peek().text)
+	}
+
+	for p.is(",") {
+		p.next()
+
+		t := p.peek()
+		aggregate, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+
+		name, ok := reductions[aggregate]
+		if !ok {
+			return nil, p.errorf(t, "%s is not a supported aggregate", aggregate)
+		}
+		reduction := seed.ReduceFunction{Name: name}
+
+		if p.is("(") {
+			p.next()
+			for !p.is(")") {
+				qc, err := p.qualifiedColumn(sources, params)
+				if err != nil {
+					return nil, err
+				}
+				reduction.Arguments = append(reduction.Arguments, qc)
+
+				if p.is(",") {
+					p.next()
+				}
+			}
+			p.next()
+		}
+
+		// the collection must still be required by the rule
+		if len(reduction.Arguments) == 0 {
+			reduction.Arguments = []seed.QualifiedColumn{
+				p.columns(collectionName, false)[0].(seed.QualifiedColumn),
+			}
+		}
+
+		intension = append(intension, reduction)
+	}
+
+	err = p.expect(")")
+	if err != nil {
+		return nil, err
+	}
+
+	return intension, nil
+}
+
+// block parses do |params| [expressions] end or the {} equivalent
+func (p *parser) block(sources []string) ([]seed.Expression, error) {
+	closing := "end"
+	if p.is("{") {
+		closing = "}"
+	}
+	p.next()
+
+	err := p.expect("|")
+	if err != nil {
+		return nil, err
+	}
+	params := map[string]string{}
+	for i := 0; !p.is("|"); i++ {
+		t := p.peek()
+		name, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		if i >= len(sources) {
+			return nil, p.errorf(t, "more block parameters than collections")
+		}
+		params[name] = sources[i]
+
+		if p.is(",") {
+			p.next()
+		}
+	}
+	p.next()
+
+	err = p.expect("[")
+	if err != nil {
+		return nil, err
+	}
+	intension := []seed.Expression{}
+	for !p.is("]") {
+		expression, err := p.expression(sources, params)
+		if err != nil {
+			return nil, err
+		}
+		intension = append(intension, expression)
+
+		if p.is(",") {
+			p.next()
+		}
+	}
+	p.next()
+
+	err = p.expect(closing)
+	if err != nil {
+		return nil, err
+	}
+
+	return intension, nil
+}
+
+// array is [c0.a, c0.b], which ToBloom uses to gather the arguments of
+// reductions in rule<n>_joined
+type array []seed.QualifiedColumn
+
+// expression parses a qualified column, a map function call or an array
+func (p *parser) expression(sources []string, params map[string]string) (seed.Expression, error) {
+	t := p.peek()
+	if p.is("[") {
+		p.next()
+		arguments := array{}
+		for !p.is("]") {
+			qc, err := p.qualifiedColumn(sources, params)
+			if err != nil {
+				return nil, err
+			}
+			arguments = append(arguments, qc)
+
+			if p.is(",") {
+				p.next()
+			}
+		}
+		p.next()
+
+		return arguments, nil
+	}
+	if t.kind != tokenIdentifier {
+		return nil, p.errorf(t, "%q is not supported in rule expressions", t.text)
+	}
+
+	if p.peekAt(1).text != "(" {
+		return p.qualifiedColumn(sources, params)
+	}
+
+	name, err := p.identifier()
+	if err != nil {
+		return nil, err
+	}
+	p.next()
+
+	function := seed.MapFunction{Name: name}
+	for !p.is(")") {
+		qc, err := p.qualifiedColumn(sources, params)
+		if err != nil {
+			return nil, err
+		}
+		function.Arguments = append(function.Arguments, qc)
+
+		if p.is(",") {
+			p.next()
+		}
+	}
+	p.next()
+
+	return function, nil
+}
+
+// foldReductions folds the rules written by reductionToBloom back into
+// the rules they came from and removes their helper collections
+func (p *parser) foldReductions() error {
+	joins := map[string]*seed.Rule{}  // rule<n>_joined -> its rule
+	groups := map[string]*seed.Rule{} // rule<n>_reduce<i> -> its rule
+	rules := []*seed.Rule{}
+	for _, rule := range p.seed.Rules {
+		switch {
+		case isJoined(rule.Supplies):
+			joins[rule.Supplies] = rule
+		case isReduce(rule.Supplies):
+			groups[rule.Supplies] = rule
+		default:
+			for _, expression := range rule.Intension {
+				if _, ok := expression.(array); ok {
+					return fmt.Errorf("%s: arrays are only supported in the rules ToBloom writes for reductions", rule.Supplies)
+				}
+			}
+			rules = append(rules, rule)
+		}
+	}
+
+	for ruleNumber, rule := range rules {
+		folded, err := fold(rule, p.seed.Collections, joins, groups)
+		if err != nil {
+			return err
+		}
+		rules[ruleNumber] = folded
+	}
+	p.seed.Rules = rules
+
+	for collectionName := range p.seed.Collections {
+		if isJoined(collectionName) || isReduce(collectionName) {
+			delete(p.seed.Collections, collectionName)
+		}
+	}
+
+	for _, rule := range p.seed.Rules {
+		for _, collectionName := range rule.Requires() {
+			if _, ok := p.seed.Collections[collectionName]; !ok {
+				return fmt.Errorf("%s: %s is not a declared collection", rule.Supplies, collectionName)
+			}
+		}
+	}
+
+	return nil
+}
+
+// fold rebuilds a rule which combines rule<n>_reduce<i> collections
+// from the rule<n>_joined rule and the reductions. Other rules are
+// returned as they are.
+func fold(rule *seed.Rule, collections map[string]*seed.Collection, joins, groups map[string]*seed.Rule) (*seed.Rule, error) {
+	var join *seed.Rule
+	intension := []seed.Expression{}
+	for _, expression := range rule.Intension {
+		var qc seed.QualifiedColumn
+		reduction := ""
+		switch value := expression.(type) {
+		case seed.QualifiedColumn:
+			qc = value
+		case seed.MapFunction:
+			if len(value.Arguments) != 1 || !isReduce(value.Arguments[0].Collection) {
+				intension = append(intension, value)
+				continue
+			}
+			// a reduce function bloom does not have an aggregate for
+			qc = value.Arguments[0]
+			reduction = value.Name
+		default:
+			intension = append(intension, value)
+			continue
+		}
+
+		if !isReduce(qc.Collection) {
+			intension = append(intension, expression)
+			continue
+		}
+
+		group, ok := groups[qc.Collection]
+		if !ok {
+			return nil, fmt.Errorf("%s: nothing supplies %s", rule.Supplies, qc.Collection)
+		}
+		joinedName := qc.Collection[:strings.LastIndex(qc.Collection, "_reduce")] + "_joined"
+		join, ok = joins[joinedName]
+		if !ok {
+			return nil, fmt.Errorf("%s: nothing supplies %s", rule.Supplies, joinedName)
+		}
+		joined := collections[joinedName]
+
+		// grouping columns come from the join
+		if reduction == "" && collections[qc.Collection].Data[0] != qc.Column {
+			column := indexOf(joined.Key, qc.Column)
+			if column < 0 {
+				return nil, fmt.Errorf("%s: %s is not grouped", rule.Supplies, qc)
+			}
+			intension = append(intension, join.Intension[column])
+			continue
+		}
+
+		aggregate, ok := group.Intension[len(group.Intension)-1].(seed.ReduceFunction)
+		if !ok {
+			return nil, fmt.Errorf("%s: %s does not reduce", rule.Supplies, group.Supplies)
+		}
+		if reduction == "" {
+			reduction = aggregate.Name
+		}
+
+		arguments, err := joinedArguments(join, joined, aggregate)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", rule.Supplies, err)
+		}
+
+		intension = append(intension, seed.ReduceFunction{
+			Name:      reduction,
+			Arguments: arguments,
+		})
+	}
+
+	if join == nil {
+		return rule, nil
+	}
+
+	return &seed.Rule{
+		Supplies:  rule.Supplies,
+		Operation: rule.Operation,
+		Intension: intension,
+		Predicate: join.Predicate,
+	}, nil
+}
+
+// joinedArguments finds the arguments a reduction had before they
+// were projected into rule<n>_joined. count does not project its
+// arguments, so it uses the first column of the join.
+func joinedArguments(join *seed.Rule, joined *seed.Collection, aggregate seed.ReduceFunction) ([]seed.QualifiedColumn, error) {
+	expression := join.Intension[len(join.Intension)-1]
+	if aggregate.Name != "count" {
+		column := indexOf(joined.Key, aggregate.Arguments[0].Column)
+		if column < 0 {
+			return nil, fmt.Errorf("%s is not a column of %s", aggregate.Arguments[0].Column, join.Supplies)
+		}
+		expression = join.Intension[column]
+	} else {
+		for _, candidate := range join.Intension {
+			if _, ok := candidate.(seed.QualifiedColumn); ok {
+				expression = candidate
+				break
+			}
+		}
+	}
+
+	switch value := expression.(type) {
+	case seed.QualifiedColumn:
+		return []seed.QualifiedColumn{value}, nil
+	case array:
+		return value, nil
+	default:
+		return nil, fmt.Errorf("the arguments of %s are not columns", aggregate.Name)
+	}
+}
+
+func indexOf(columns []string, column string) int {
+	for i, candidate := range columns {
+		if candidate == column {
+			return i
+		}
+	}
+	return -1
+}
+
+func isJoined(name string) bool {
+	return strings.HasPrefix(name, "rule") && strings.HasSuffix(name, "_joined")
+}
+
+func isReduce(name string) bool {
+	return strings.HasPrefix(name, "rule") && strings.Contains(name, "_reduce")
+}
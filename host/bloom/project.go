@@ -0,0 +1,139 @@
+package bloom
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/nathankerr/seed"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ToBudProject converts a seed into the files (by filename) of a
+// runnable bud project: the bloom module, a server class including
+// it, stubs for the functions the module calls, a Gemfile and an
+// entry script.
+func ToBudProject(s *seed.Seed, name string) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	moduleName := strings.Title(name)
+	filename := strings.ToLower(name)
+
+	module, err := ToBloom(s, name)
+	if err != nil {
+		return nil, err
+	}
+	files[filename+".rb"] = module
+
+	files["functions.rb"] = functionsToRuby(s, moduleName)
+
+	files["server.rb"] = []byte(fmt.Sprintf(`require 'rubygems'
+require 'bud'
+require_relative '%[1]s'
+require_relative 'functions'
+
+class %[2]sServer
+  include Bud
+  include %[2]s
+  include %[2]sFunctions
+end
+`, filename, moduleName))
+
+	files["run.rb"] = []byte(fmt.Sprintf(`require_relative 'server'
+
+# runs %[1]sServer
+# usage: ruby run.rb [ip] [port]
+ip = ARGV[0] || "127.0.0.1"
+port = (ARGV[1] || 3000).to_i
+
+program = %[1]sServer.new(:ip => ip, :port => port)
+program.run_fg
+`, moduleName))
+
+	files["Gemfile"] = []byte(fmt.Sprintf(`# dependencies of %s; install with bundle install
+source 'https://rubygems.org'
+
+gem 'bud'
+`, moduleName))
+
+	return files, nil
+}
+
+// ruby versions of the standard functions without native bloom
+// aggregates
+var standardFunctions = map[string][]string{ // name: parameters, body
+	"collect": {"tuples", "tuples.map { |arguments| arguments.length == 1 ? arguments[0] : arguments }"},
+}
+
+// functionsToRuby writes the standard functions and stubs for the
+// other map functions and reduce functions without native bloom
+// aggregates. Reduce functions are called with the set of their
+// accumulated argument tuples.
+func functionsToRuby(s *seed.Seed, moduleName string) []byte {
+	maps := map[string][]string{} // function name: parameter names
+	reduces := map[string]bool{}
+	for _, rule := range s.Rules {
+		for _, expression := range rule.Intension {
+			switch value := expression.(type) {
+			case seed.QualifiedColumn:
+				// no-op
+			case seed.MapFunction:
+				parameters := []string{}
+				used := map[string]bool{}
+				for _, qc := range value.Arguments {
+					parameter := qc.Column
+					if used[parameter] {
+						parameter = fmt.Sprintf("%s_%s", qc.Collection, qc.Column)
+					}
+					used[parameter] = true
+					parameters = append(parameters, parameter)
+				}
+				maps[value.Name] = parameters
+			case seed.ReduceFunction:
+				if _, native := aggregates[value.Name]; !native {
+					reduces[value.Name] = true
+				}
+			default:
+				panic(fmt.Sprintf("unhandled type: %v",
+					reflect.TypeOf(expression).String()))
+			}
+		}
+	}
+
+	names := []string{}
+	for name := range maps {
+		names = append(names, name)
+	}
+	for name := range reduces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buffer := new(bytes.Buffer)
+	fmt.Fprintf(buffer, "# Functions used by %s. Replace the stubs with implementations.\n", moduleName)
+	fmt.Fprintf(buffer, "module %sFunctions\n", moduleName)
+	for i, name := range names {
+		if i > 0 {
+			fmt.Fprintf(buffer, "\n")
+		}
+
+		if standard, ok := standardFunctions[name]; ok {
+			fmt.Fprintf(buffer, "  def %s(%s)\n", name, standard[0])
+			fmt.Fprintf(buffer, "    %s\n", standard[1])
+			fmt.Fprintf(buffer, "  end\n")
+			continue
+		}
+
+		parameters, isMap := maps[name]
+		if !isMap {
+			fmt.Fprintf(buffer, "  # tuples is the set of argument tuples for one group\n")
+			parameters = []string{"tuples"}
+		}
+
+		fmt.Fprintf(buffer, "  def %s(%s)\n", name, strings.Join(parameters, ", "))
+		fmt.Fprintf(buffer, "    raise NotImplementedError, \"%s is not implemented\"\n", name)
+		fmt.Fprintf(buffer, "  end\n")
+	}
+	fmt.Fprintf(buffer, "end\n")
+
+	return buffer.Bytes()
+}
@@ -0,0 +1,196 @@
+package bloom
+
+import (
+	"fmt"
+	"github.com/nathankerr/seed"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// reductionToBloom rewrites a rule containing reductions into rules
+// bloom can run (see "NOTES on Reduce in Bloom.txt"):
+//
+//	rule<n>_joined <= the join from the original rule, projecting the
+//	                  grouping columns, the keys of the joined
+//	                  collections and the reduction arguments
+//	rule<n>_reduce<i> <= rule<n>_joined.group(grouping columns, aggregate)
+//	supplies <op> the reduce collections combined on the grouping columns
+//
+// Reductions without a native bloom aggregate accumulate their
+// arguments and call the reduce function on the accumulated set.
+func reductionToBloom(s *seed.Seed, r *seed.Rule, ruleNum int) (map[string]*seed.Collection, []string) {
+	helpers := map[string]*seed.Collection{}
+	rules := []string{}
+
+	supplies := s.Collections[r.Supplies]
+	columns := []string{}
+	for _, column := range append(append([]string{}, supplies.Key...), supplies.Data...) {
+		columns = append(columns, strings.TrimPrefix(column, "@"))
+	}
+
+	collections := r.Requires()
+	sort.Strings(collections)
+	index, names := blockNames(collections)
+
+	// joined collection
+	joinedName := fmt.Sprintf("rule%d_joined", ruleNum)
+	joined := &seed.Collection{Type: seed.CollectionScratch}
+	joinedIntension := []string{}
+	groups := []string{}
+	for columnNumber, expression := range r.Intension {
+		switch value := expression.(type) {
+		case seed.QualifiedColumn, seed.MapFunction:
+			joined.Key = append(joined.Key, columns[columnNumber])
+			joinedIntension = append(joinedIntension, expressionToBloom(value, index))
+			groups = append(groups, columns[columnNumber])
+		case seed.ReduceFunction:
+			// added after the keys
+		default:
+			panic(fmt.Sprintf("unhandled type: %v",
+				reflect.TypeOf(expression).String()))
+		}
+	}
+
+	// keeping the keys of the joined collections keeps rows which
+	// only differ in those keys from being merged before reduction
+	for _, collectionName := range collections {
+		for _, column := range s.Collections[collectionName].Key {
+			column = strings.TrimPrefix(column, "@")
+			joined.Key = append(joined.Key, fmt.Sprintf("%s_%s", collectionName, column))
+			joinedIntension = append(joinedIntension, fmt.Sprintf("%s.%s", index[collectionName], column))
+		}
+	}
+
+	for columnNumber, expression := range r.Intension {
+		reduction, ok := expression.(seed.ReduceFunction)
+		if !ok {
+			continue
+		}
+
+		argument, ok := reductionArgument(reduction, index)
+		if !ok {
+			continue
+		}
+		joinedIntension = append(joinedIntension, argument)
+		joined.Key = append(joined.Key, columns[columnNumber])
+	}
+
+	helpers[joinedName] = joined
+	rules = append(rules, fmt.Sprintf("%s <= %s",
+		joinedName,
+		selecterToBloom(collections, names, r.Predicate, joinedIntension)))
+
+	// group each reduction and recombine
+	keys := "nil"
+	if len(groups) > 0 {
+		qualified := []string{}
+		for _, group := range groups {
+			qualified = append(qualified, fmt.Sprintf("%s.%s", joinedName, group))
+		}
+		keys = fmt.Sprintf("[%s]", strings.Join(qualified, ", "))
+	}
+
+	combined := &seed.Rule{
+		Supplies:  r.Supplies,
+		Operation: r.Operation,
+	}
+	previous := ""
+	for columnNumber, expression := range r.Intension {
+		reduction, ok := expression.(seed.ReduceFunction)
+		if !ok {
+			continue
+		}
+		column := columns[columnNumber]
+
+		reduceName := fmt.Sprintf("rule%d_reduce%d", ruleNum, columnNumber)
+		helpers[reduceName] = &seed.Collection{
+			Type: seed.CollectionScratch,
+			Key:  groups,
+			Data: []string{column},
+		}
+
+		aggregate, native := aggregates[reduction.Name]
+		switch {
+		case native && aggregate == "count":
+			// no-op
+		case native:
+			aggregate = fmt.Sprintf("%s(%s.%s)", aggregate, joinedName, column)
+		default:
+			aggregate = fmt.Sprintf("accum(%s.%s)", joinedName, column)
+		}
+		rules = append(rules, fmt.Sprintf("%s <= %s.group(%s, %s)",
+			reduceName, joinedName, keys, aggregate))
+
+		// reduce collections are combined on their grouping columns
+		if previous != "" {
+			for _, group := range groups {
+				combined.Predicate = append(combined.Predicate, seed.Constraint{
+					Left:  seed.QualifiedColumn{Collection: previous, Column: group},
+					Right: seed.QualifiedColumn{Collection: reduceName, Column: group},
+				})
+			}
+		}
+		previous = reduceName
+	}
+
+	for columnNumber, expression := range r.Intension {
+		switch value := expression.(type) {
+		case seed.QualifiedColumn, seed.MapFunction:
+			combined.Intension = append(combined.Intension, seed.QualifiedColumn{
+				Collection: previous,
+				Column:     columns[columnNumber],
+			})
+		case seed.ReduceFunction:
+			reduced := seed.QualifiedColumn{
+				Collection: fmt.Sprintf("rule%d_reduce%d", ruleNum, columnNumber),
+				Column:     columns[columnNumber],
+			}
+			if _, native := aggregates[value.Name]; native {
+				combined.Intension = append(combined.Intension, reduced)
+			} else {
+				combined.Intension = append(combined.Intension, seed.MapFunction{
+					Name:      value.Name,
+					Arguments: []seed.QualifiedColumn{reduced},
+				})
+			}
+		default:
+			panic(fmt.Sprintf("unhandled type: %v",
+				reflect.TypeOf(expression).String()))
+		}
+	}
+	rules = append(rules, ruleToBloom(combined))
+
+	return helpers, rules
+}
+
+// reductionArgument gives the joined column for a reduction's
+// arguments. count does not need one.
+func reductionArgument(reduction seed.ReduceFunction, index map[string]string) (string, bool) {
+	arguments := []string{}
+	for _, qc := range reduction.Arguments {
+		arguments = append(arguments, expressionToBloom(qc, index))
+	}
+
+	aggregate, native := aggregates[reduction.Name]
+	switch {
+	case native && aggregate == "count":
+		return "", false
+	case native && aggregate != "accum", native && len(arguments) == 1:
+		// like the standard reduce functions, only the first
+		// argument is used
+		return arguments[0], true
+	default:
+		// non-native reduce functions get tuples of their arguments
+		return fmt.Sprintf("[%s]", strings.Join(arguments, ", ")), true
+	}
+}
+
+func hasReductions(r *seed.Rule) bool {
+	for _, expression := range r.Intension {
+		if _, ok := expression.(seed.ReduceFunction); ok {
+			return true
+		}
+	}
+	return false
+}
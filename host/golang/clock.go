@@ -0,0 +1,89 @@
+package golang
+
+import (
+	"strconv"
+	"time"
+)
+
+// A Clock decides when the host inputs are filled and with which time.
+// Tick is called at the start of each timestep; ok reports whether the
+// host inputs receive now during that timestep. Times are seconds since
+// the Unix epoch as float64s, so they compare equal to the numbers
+// decoded from wsjson messages.
+type Clock interface {
+	Tick() (now float64, ok bool)
+}
+
+// ParseClock returns a StepClock when how is a number of timesteps,
+// e.g., 10, or a WallClock when it is a duration, e.g., 500ms.
+func ParseClock(how string) (Clock, error) {
+	steps, err := strconv.Atoi(how)
+	if err == nil {
+		return &StepClock{Steps: steps}, nil
+	}
+
+	interval, err := time.ParseDuration(how)
+	if err != nil {
+		return nil, err
+	}
+	return &WallClock{Interval: interval}, nil
+}
+
+// WallClock ticks with the current time once Interval has passed since
+// its last tick.
+type WallClock struct {
+	Interval time.Duration
+	last     time.Time
+}
+
+func (c *WallClock) Tick() (float64, bool) {
+	now := time.Now()
+	if !c.last.IsZero() && now.Sub(c.last) < c.Interval {
+		return 0, false
+	}
+	c.last = now
+	return seconds(now), true
+}
+
+// StepClock ticks with the current time every Steps timesteps,
+// starting with the first.
+type StepClock struct {
+	Steps int
+	step  int
+}
+
+func (c *StepClock) Tick() (float64, bool) {
+	if !every(c.Steps, &c.step) {
+		return 0, false
+	}
+	return seconds(time.Now()), true
+}
+
+// SimulatedClock ticks every Steps timesteps, starting with the first.
+// Its time starts at Start and advances by Increment each timestep,
+// regardless of how long the timesteps take, so runs using it repeat.
+type SimulatedClock struct {
+	Start     float64
+	Increment float64
+	Steps     int
+	step      int
+}
+
+func (c *SimulatedClock) Tick() (float64, bool) {
+	now := c.Start + float64(c.step)*c.Increment
+	if !every(c.Steps, &c.step) {
+		return 0, false
+	}
+	return now, true
+}
+
+// every counts a timestep and reports whether it is one of every steps
+func every(steps int, step *int) bool {
+	ticks := steps <= 1 || *step%steps == 0
+	*step++
+	return ticks
+}
+
+func seconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
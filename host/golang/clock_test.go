@@ -0,0 +1,44 @@
+package golang
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSimulatedClock(t *testing.T) {
+	clock := &SimulatedClock{Start: 100, Increment: 0.5, Steps: 2}
+
+	expected := []struct {
+		now float64
+		ok  bool
+	}{{100, true}, {0, false}, {101, true}, {0, false}, {102, true}}
+	for step, e := range expected {
+		now, ok := clock.Tick()
+		if now != e.now || ok != e.ok {
+			t.Errorf("step %d: expected %v %v, got %v %v", step, e.now, e.ok, now, ok)
+		}
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	clock, err := ParseClock("10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if steps, ok := clock.(*StepClock); !ok || steps.Steps != 10 {
+		t.Errorf("expected a StepClock every 10 timesteps, got %#v", clock)
+	}
+
+	clock, err = ParseClock("500ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wall, ok := clock.(*WallClock); !ok || wall.Interval != 500*time.Millisecond {
+		t.Errorf("expected a WallClock every 500ms, got %#v", clock)
+	}
+
+	_, err = ParseClock("often")
+	if err == nil {
+		t.Error("expected an error for often")
+	}
+}
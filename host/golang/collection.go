@@ -2,6 +2,7 @@ package golang
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/nathankerr/seed"
 )
 
@@ -10,13 +11,16 @@ type tupleSet struct {
 	keyEnds         int
 	numberOfColumns int
 	collectionName  string
+	collectionType  seed.CollectionType
 }
 
 // tuples are unique according to their key columns
 // the key columns are a subset of the columns starting at the beginning
 // encoding the key columns in json gives a way to uniquely encode the columns
 // a map is then used (with the encoded key) to store the tuples
-func (ts *tupleSet) add(tuple seed.Tuple) {
+// lattices merge the data columns with those stored for the key; tuples
+// which cannot be merged are not added
+func (ts *tupleSet) add(tuple seed.Tuple) error {
 	if len(tuple) != ts.numberOfColumns {
 		fatal(ts.collectionName, "expected", ts.numberOfColumns, "columns for", tuple)
 	}
@@ -26,7 +30,69 @@ func (ts *tupleSet) add(tuple seed.Tuple) {
 		panic(err)
 	}
 
+	if ts.collectionType.Lattice() {
+		stored := ts.tuples[string(key)]
+		merged := append(seed.Tuple{}, tuple[:ts.keyEnds]...)
+		for column := ts.keyEnds; column < ts.numberOfColumns; column++ {
+			var storedValue seed.Element
+			if stored != nil {
+				storedValue = stored[column]
+			}
+			value, err := merge(ts.collectionType, storedValue, tuple[column])
+			if err != nil {
+				return err
+			}
+			merged = append(merged, value)
+		}
+		tuple = merged
+	}
+
 	ts.tuples[string(key)] = tuple
+	return nil
+}
+
+// remove deletes the stored tuple with the same key when all its columns
+// match; a tuple updated in the same timestep is kept. Or-sets instead
+// merge in tombstones for the tags in the tuple's data columns.
+func (ts *tupleSet) remove(tuple seed.Tuple) error {
+	if len(tuple) != ts.numberOfColumns {
+		fatal(ts.collectionName, "expected", ts.numberOfColumns, "columns for", tuple)
+	}
+
+	if ts.collectionType == seed.CollectionLorset {
+		tombstones := append(seed.Tuple{}, tuple[:ts.keyEnds]...)
+		for _, set := range tuple[ts.keyEnds:] {
+			tombstone, err := removal(set)
+			if err != nil {
+				return err
+			}
+			tombstones = append(tombstones, tombstone)
+		}
+		return ts.add(tombstones)
+	}
+
+	key, err := json.Marshal(tuple[:ts.keyEnds])
+	if err != nil {
+		panic(err)
+	}
+
+	stored, ok := ts.tuples[string(key)]
+	if !ok {
+		return nil
+	}
+
+	encodedStored, err := json.Marshal(stored)
+	if err != nil {
+		panic(err)
+	}
+	encoded, err := json.Marshal(tuple)
+	if err != nil {
+		panic(err)
+	}
+	if string(encodedStored) == string(encoded) {
+		delete(ts.tuples, string(key))
+	}
+	return nil
 }
 
 func (ts *tupleSet) message() MessageContainer {
@@ -43,11 +109,14 @@ func (ts *tupleSet) message() MessageContainer {
 	return message
 }
 
-func collectionHandler(collectionName string, s *seed.Seed, channels Channels) {
+func collectionHandler(collectionName string, s *seed.Seed, channels Channels, options Options) {
 	controlinfo(collectionName, "started")
 	input := channels.Collections[collectionName]
 	c := s.Collections[collectionName]
 
+	// the immediate phase waits for data from the distributer and each
+	// immediate rule; messages from other seeds may come at any time, so
+	// they are not counted
 	inputsNeeded := 1 // start with the distributer
 	for _, rule := range s.Rules {
 		if rule.Supplies == collectionName && rule.Operation == "<=" {
@@ -56,6 +125,12 @@ func collectionHandler(collectionName string, s *seed.Seed, channels Channels) {
 	}
 	inputsReceived := 0
 
+	// tuples from other seeds arriving after the immediate phase are
+	// held for the next timestep, or emptying a temporary collection in
+	// the deferred phase would lose them
+	immediateDone := false
+	held := []seed.Tuple{}
+
 	immediates := ruleChannels(false, collectionName, s, channels)
 	deferreds := ruleChannels(true, collectionName, s, channels)
 
@@ -66,6 +141,28 @@ func collectionHandler(collectionName string, s *seed.Seed, channels Channels) {
 		keyEnds:         len(c.Key),
 		numberOfColumns: len(c.Key) + len(c.Data),
 		collectionName:  collectionName,
+		collectionType:  c.Type,
+	}
+
+	// tuples which cannot be merged into a lattice are dropped and, when
+	// function errors are reported, replaced by error tuples
+	failures := []seed.Tuple{} // error tuples for the function error collection
+	failed := func(tuple seed.Tuple, err error) {
+		if err == nil {
+			return
+		}
+		mergeerror(collectionName, tuple, err)
+
+		if options.FunctionErrors != ReportFunctionErrors {
+			return
+		}
+		failures = append(failures, seed.Tuple{collectionName, "merge", fmt.Sprint(tuple), err.Error()})
+	}
+	add := func(tuple seed.Tuple) {
+		failed(tuple, data.add(tuple))
+	}
+	remove := func(tuple seed.Tuple) {
+		failed(tuple, data.remove(tuple))
 	}
 
 	for {
@@ -83,18 +180,43 @@ func collectionHandler(collectionName string, s *seed.Seed, channels Channels) {
 				switch message.Operation {
 				case "data":
 					for _, tuple := range message.Data {
-						data.add(tuple)
+						add(tuple)
 					}
 					inputsReceived++
+				case "<~":
+					// from another seed, not one of the inputs
+					for _, tuple := range message.Data {
+						add(tuple)
+					}
+				case "delete":
+					// from a deferred rule of the last timestep
+					for _, tuple := range message.Data {
+						remove(tuple)
+					}
 				default:
 					fatal(collectionName, "unhandled message", message)
 				}
 				flowinfo(collectionName, "have ", inputsReceived, "of ", inputsNeeded)
 			}
 			inputsReceived = 0
+			immediateDone = true
 
 			dataMessage := data.message()
 			sendToAll(dataMessage, immediates)
+
+			// error tuples are inserted at the next "immediate"; the
+			// distributer has already sent this collection its data
+			if len(failures) > 0 {
+				failuresMessage := MessageContainer{
+					Operation:  "insert",
+					Collection: options.FunctionErrorCollection,
+					Data:       failures,
+				}
+				channels.Distribution <- failuresMessage
+				flowinfo(collectionName, "sent", failuresMessage.String(), "to distribution")
+				failures = []seed.Tuple{}
+			}
+
 			dataMessage.Operation = "done"
 			channels.Control <- dataMessage
 			controlinfo(collectionName, "finished with", message)
@@ -108,21 +230,36 @@ func collectionHandler(collectionName string, s *seed.Seed, channels Channels) {
 			case seed.CollectionInput, seed.CollectionOutput, seed.CollectionScratch, seed.CollectionChannel:
 				// temporary collections are emptied
 				data.tuples = map[string]seed.Tuple{}
-			case seed.CollectionTable:
+			case seed.CollectionTable, seed.CollectionLmax, seed.CollectionLset, seed.CollectionLcounter, seed.CollectionLorset, seed.CollectionLregister:
 				// persistent collections
 				// no-op
 			default:
 				fatal(collectionName, "unhandled collection type", c.Type)
 			}
+			for _, tuple := range held {
+				add(tuple)
+			}
+			held = []seed.Tuple{}
+			immediateDone = false
 			dataMessage.Operation = "done"
 			channels.Control <- dataMessage
 			flowinfo(collectionName, "sent", dataMessage)
 			controlinfo(collectionName, "finished with", message)
 		case "data", "<~":
-			inputsReceived++
+			if message.Operation == "data" {
+				inputsReceived++
+			} else if immediateDone {
+				held = append(held, message.Data...)
+				continue
+			}
 			flowinfo(collectionName, "received", inputsReceived, "of", inputsNeeded, ":", message.String())
 			for _, tuple := range message.Data {
-				data.add(tuple)
+				add(tuple)
+			}
+		case "delete":
+			flowinfo(collectionName, "received", message.String())
+			for _, tuple := range message.Data {
+				remove(tuple)
 			}
 		default:
 			fatal(collectionName, "unhandled message:", message)
@@ -0,0 +1,126 @@
+package golang
+
+import (
+	"github.com/nathankerr/seed"
+	"reflect"
+	"testing"
+)
+
+// handle runs a collection handler, sending it the messages in order
+func handle(s *seed.Seed, collectionName string, messages ...MessageContainer) Channels {
+	channels := makeChannels(s)
+	go collectionHandler(collectionName, s, channels, Options{})
+	go func() {
+		for _, message := range messages {
+			channels.Collections[collectionName] <- message
+		}
+	}()
+	return channels
+}
+
+func TestInputsNeeded(t *testing.T) {
+	s := parse("inputs needed",
+		"input in [key]\n"+
+			"table keep [key]\n"+
+			"keep <= [in.key]")
+
+	// keep waits for the distributer and rule 0 before the immediate
+	// phase; the message from another seed is not one of them
+	channels := handle(s, "keep",
+		MessageContainer{Operation: "<~", Collection: "keep", Data: []seed.Tuple{{"sent"}}},
+		MessageContainer{Operation: "data", Collection: "keep", Data: []seed.Tuple{}},
+		MessageContainer{Operation: "immediate"},
+		MessageContainer{Operation: "data", Collection: "keep", Data: []seed.Tuple{{"supplied"}}},
+	)
+
+	done := <-channels.Control
+	if len(done.Data) != 2 {
+		t.Errorf("expected the sent and supplied tuples, got %v", done.Data)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	tests := []struct {
+		name     string
+		stored   []seed.Tuple
+		remove   seed.Tuple
+		expected int
+	}{
+		{"same tuple", []seed.Tuple{{"a", 1}, {"b", 2}}, seed.Tuple{"a", 1}, 1},
+		// the row was updated since the delete read it
+		{"different data", []seed.Tuple{{"a", 1}, {"b", 2}}, seed.Tuple{"a", 3}, 2},
+		{"missing key", []seed.Tuple{{"b", 2}}, seed.Tuple{"a", 1}, 1},
+	}
+
+	for _, test := range tests {
+		data := tupleSet{
+			tuples:          map[string]seed.Tuple{},
+			keyEnds:         1,
+			numberOfColumns: 2,
+			collectionName:  "keep",
+			collectionType:  seed.CollectionTable,
+		}
+		for _, tuple := range test.stored {
+			data.add(tuple)
+		}
+
+		data.remove(test.remove)
+		if len(data.tuples) != test.expected {
+			t.Errorf("%s: expected %d tuples, got %v", test.name, test.expected, data.tuples)
+		}
+		for _, tuple := range data.tuples {
+			if tuple[0] == test.remove[0] && tuple[1] == test.remove[1] {
+				t.Errorf("%s: %v was not removed", test.name, test.remove)
+			}
+		}
+	}
+}
+
+func TestRemoveFromOrset(t *testing.T) {
+	data := tupleSet{
+		tuples:          map[string]seed.Tuple{},
+		keyEnds:         1,
+		numberOfColumns: 2,
+		collectionName:  "carts",
+		collectionType:  seed.CollectionLorset,
+	}
+	data.add(seed.Tuple{"s", map[string]interface{}{"added": map[string]interface{}{"t1": "a", "t2": "b"}}})
+
+	// the remover has only seen t1
+	err := data.remove(seed.Tuple{"s", map[string]interface{}{"added": map[string]interface{}{"t1": "a"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := seed.Tuple{"s", map[string]interface{}{"added": map[string]interface{}{"t2": "b"}, "removed": []interface{}{"t1"}}}
+	for _, tuple := range data.tuples {
+		if !reflect.DeepEqual(tuple, expected) {
+			t.Errorf("expected %v, got %v", expected, tuple)
+		}
+	}
+
+	if data.remove(seed.Tuple{"s", "a"}) == nil {
+		t.Error("expected an error for removing something which is not an or-set")
+	}
+}
+
+func TestHeld(t *testing.T) {
+	s := parse("held", "input in [key]")
+
+	// a message from another seed arrives between the phases
+	channels := handle(s, "in",
+		MessageContainer{Operation: "data", Collection: "in", Data: []seed.Tuple{}},
+		MessageContainer{Operation: "immediate"},
+		MessageContainer{Operation: "<~", Collection: "in", Data: []seed.Tuple{{"late"}}},
+		MessageContainer{Operation: "deferred"},
+		MessageContainer{Operation: "data", Collection: "in", Data: []seed.Tuple{}},
+		MessageContainer{Operation: "immediate"},
+	)
+
+	expected := []int{0, 0, 1} // the tuples at the end of each phase
+	for phase, count := range expected {
+		done := <-channels.Control
+		if len(done.Data) != count {
+			t.Errorf("phase %d: expected %d tuples, got %v", phase, count, done.Data)
+		}
+	}
+}
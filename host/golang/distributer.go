@@ -40,6 +40,8 @@ func distributer(s *seed.Seed, channels Channels) {
 				channels.Control <- MessageContainer{Operation: "done", Collection: "_distributer"}
 			case "deferred":
 				channels.Control <- MessageContainer{Operation: "done", Collection: "_distributer"}
+			case "delete":
+				// deletions only change the local collection
 			case "data":
 				// TODO: send message to correct communicator
 				collection, ok := s.Collections[message.Collection]
@@ -99,7 +101,7 @@ func distributer(s *seed.Seed, channels Channels) {
 			case "insert":
 				// Collection holds the collection, Data the data
 				// data is inserted at the next "immediate"
-				if _, ok := data[message.Collection]; !ok {
+				if _, ok := s.Collections[message.Collection]; !ok {
 					continue
 				}
 
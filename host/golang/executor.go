@@ -3,6 +3,8 @@ package golang
 import (
 	"fmt"
 	"github.com/nathankerr/seed"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -27,21 +29,87 @@ func (mc *MessageContainer) String() string {
 		mc.Collection, mc.Operation, strings.Join(tuples, ", "))
 }
 
+// Options change how Execute runs a seed
+type Options struct {
+	// Clock fills the host inputs; nil means a WallClock ticking every
+	// second
+	Clock Clock
+
+	// FunctionErrors decides what happens to rows whose map or reduce
+	// functions fail
+	FunctionErrors FunctionErrorPolicy
+
+	// FunctionErrorCollection receives a [rule, function, arguments,
+	// error] tuple for each failed row when FunctionErrors is
+	// ReportFunctionErrors. Tuples which cannot be merged into a lattice
+	// are reported as [collection, "merge", tuple, error].
+	FunctionErrorCollection string
+}
+
+type FunctionErrorPolicy int
+
+const (
+	// failed rows are dropped and only logged
+	DropFunctionErrors FunctionErrorPolicy = iota
+	// failed rows are replaced by error tuples in the
+	// FunctionErrorCollection for the next timestep
+	ReportFunctionErrors
+)
+
+// ParseFunctionErrorPolicy returns the policy named drop or report
+func ParseFunctionErrorPolicy(name string) (FunctionErrorPolicy, error) {
+	switch name {
+	case "drop":
+		return DropFunctionErrors, nil
+	case "report":
+		return ReportFunctionErrors, nil
+	}
+	return DropFunctionErrors, fmt.Errorf("unknown function error policy %q", name)
+}
+
 // A concurrent seed executor
 // Collection and rule handlers work as concurrent processes
 // managed by the control loop in this function.
-func Execute(s *seed.Seed, sleepDuration time.Duration, address string, monitor bool) Channels {
+func Execute(s *seed.Seed, sleepDuration time.Duration, address string, monitor bool, options Options) Channels {
+	switch options.FunctionErrors {
+	case DropFunctionErrors:
+		// no-op
+	case ReportFunctionErrors:
+		collection, ok := s.Collections[options.FunctionErrorCollection]
+		if !ok {
+			fatal("executor", "function error collection", options.FunctionErrorCollection, "does not exist")
+		}
+		if len(collection.Key)+len(collection.Data) != 4 {
+			fatal("executor", "function error collection", options.FunctionErrorCollection, "needs 4 columns: rule, function, arguments, error")
+		}
+	default:
+		fatal("executor", "unhandled function error policy", options.FunctionErrors)
+	}
+
 	// launch the handlers
 	channels := makeChannels(s)
 	for collectionName, _ := range s.Collections {
-		go collectionHandler(collectionName, s, channels)
+		go collectionHandler(collectionName, s, channels, options)
 	}
 	for ruleNumber, _ := range s.Rules {
-		go handleRule(ruleNumber, s, channels)
+		go handleRule(ruleNumber, s, channels, options)
 	}
 
 	go distributer(s, channels)
 
+	// the host fills the host inputs with the time
+	hostInputs := []string{}
+	for collectionName, collection := range s.Collections {
+		if collection.Host {
+			hostInputs = append(hostInputs, collectionName)
+		}
+	}
+	sort.Strings(hostInputs)
+	clock := options.Clock
+	if clock == nil {
+		clock = &WallClock{Interval: time.Second}
+	}
+
 	// make list of all processes to be controlled
 	toControl := []chan<- MessageContainer{channels.Distribution}
 	for _, collectionChannel := range channels.Collections {
@@ -51,11 +119,11 @@ func Execute(s *seed.Seed, sleepDuration time.Duration, address string, monitor
 		toControl = append(toControl, ruleChannel)
 	}
 
-	go controlLoop(monitor, sleepDuration, toControl, channels)
+	go controlLoop(monitor, sleepDuration, toControl, channels, clock, hostInputs)
 	return channels
 }
 
-func controlLoop(monitor bool, sleepDuration time.Duration, toControl []chan<- MessageContainer, channels Channels) {
+func controlLoop(monitor bool, sleepDuration time.Duration, toControl []chan<- MessageContainer, channels Channels, clock Clock, hostInputs []string) {
 
 	shouldStop := false
 	shouldStep := false
@@ -139,8 +207,19 @@ func controlLoop(monitor bool, sleepDuration time.Duration, toControl []chan<- M
 			}
 		}
 
+		// fill the host inputs before the timestep starts
+		if now, ok := clock.Tick(); ok {
+			for _, collectionName := range hostInputs {
+				channels.Collections[collectionName] <- MessageContainer{
+					Operation:  "<~",
+					Collection: collectionName,
+					Data:       []seed.Tuple{{now}},
+				}
+			}
+		}
+
 		// phase 1: execute immediate rules
-		messages := sendAndWaitTilFinished(
+		immediateMessages := sendAndWaitTilFinished(
 			MessageContainer{Operation: "immediate"},
 			toControl, channels.Control)
 
@@ -168,15 +247,26 @@ func controlLoop(monitor bool, sleepDuration time.Duration, toControl []chan<- M
 		}
 
 		// phase 2: execute deferred rules
-		messages = sendAndWaitTilFinished(
+		messages := sendAndWaitTilFinished(
 			MessageContainer{Operation: "deferred"},
 			toControl, channels.Control)
 
 		if monitor {
+			// immediate rules report their results in phase 1
+			immediateResults := map[string][]seed.Tuple{}
+			for _, message := range immediateMessages {
+				immediateResults[message.Collection] = message.Data
+			}
+
 			for _, message := range messages {
+				data := message.Data
+				if _, err := strconv.Atoi(message.Collection); err == nil && len(data) == 0 {
+					data = immediateResults[message.Collection]
+				}
+
 				channels.Monitor <- MonitorMessage{
 					Block: message.Collection,
-					Data:  message.Data,
+					Data:  data,
 				}
 			}
 
@@ -0,0 +1,250 @@
+package golang
+
+import (
+	"github.com/nathankerr/seed"
+	"testing"
+	"time"
+)
+
+// watch returns the contents of the named collection at the end of
+// each timestep until done returns true
+func watch(t *testing.T, channels Channels, collectionName string, done func(tuples []seed.Tuple) bool) {
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case message := <-channels.Monitor:
+			if message.Block != collectionName {
+				continue
+			}
+			if done(message.Data.([]seed.Tuple)) {
+				return
+			}
+		case <-deadline:
+			t.Fatal("timed out watching", collectionName)
+		}
+	}
+}
+
+func TestReportFunctionErrors(t *testing.T) {
+	s := parse("report function errors",
+		"input in [key] => [value]\n"+
+			"table keep [key] => [value]\n"+
+			"table errors [rule, function, arguments, error]\n"+
+			"keep <+ [in.key, (fail in.value)]\n")
+	fail := s.Rules[0].Intension[1].(seed.MapFunction)
+	fail.Function = func(arguments seed.Tuple) seed.Element {
+		panic("bad value")
+	}
+	s.Rules[0].Intension[1] = fail
+
+	channels := Execute(s, time.Millisecond, "", true, Options{
+		FunctionErrors:          ReportFunctionErrors,
+		FunctionErrorCollection: "errors",
+	})
+	channels.Collections["in"] <- MessageContainer{
+		Operation:  "<~",
+		Collection: "in",
+		Data:       []seed.Tuple{{1, "bad"}},
+	}
+
+	watch(t, channels, "errors", func(tuples []seed.Tuple) bool {
+		if len(tuples) == 0 {
+			return false
+		}
+		if tuples[0][0] != 0 || tuples[0][1] != "fail" || tuples[0][3] != "bad value" {
+			t.Errorf("expected an error tuple for rule 0, got %v", tuples[0])
+		}
+		return true
+	})
+}
+
+func TestHostInputs(t *testing.T) {
+	s := parse("host inputs",
+		"host input tick [now]\n"+
+			"table ticks [now]\n"+
+			"ticks <+ [tick.now]\n")
+
+	channels := Execute(s, time.Millisecond, "", true, Options{
+		Clock: &SimulatedClock{Start: 100, Increment: 1, Steps: 2},
+	})
+
+	// the time is only added on every second timestep
+	expected := [][]seed.Tuple{{{100.0}}, {}, {{102.0}}, {}, {{104.0}}}
+	step := 0
+	watch(t, channels, "tick", func(tuples []seed.Tuple) bool {
+		if len(tuples) != len(expected[step]) || (len(tuples) == 1 && tuples[0][0] != expected[step][0][0]) {
+			t.Errorf("timestep %d: expected %v, got %v", step, expected[step], tuples)
+		}
+		step++
+		return step == len(expected)
+	})
+}
+
+func TestReportMergeErrors(t *testing.T) {
+	s := parse("report merge errors",
+		"input in [key] => [at]\n"+
+			"lmax latest [key] => [at]\n"+
+			"table errors [rule, function, arguments, error]\n"+
+			"latest <+ [in.key, in.at]\n")
+
+	channels := Execute(s, time.Millisecond, "", true, Options{
+		FunctionErrors:          ReportFunctionErrors,
+		FunctionErrorCollection: "errors",
+	})
+	go func() {
+		for _, at := range []seed.Element{1.0, "noon"} {
+			channels.Collections["latest"] <- MessageContainer{
+				Operation:  "<~",
+				Collection: "latest",
+				Data:       []seed.Tuple{{"k", at}},
+			}
+		}
+	}()
+
+	// the value which cannot be compared with 1 is dropped
+	watch(t, channels, "errors", func(tuples []seed.Tuple) bool {
+		if len(tuples) == 0 {
+			return false
+		}
+		if tuples[0][0] != "latest" || tuples[0][1] != "merge" {
+			t.Errorf("expected a merge error for latest, got %v", tuples[0])
+		}
+		return true
+	})
+}
+
+func TestDelete(t *testing.T) {
+	s := parse("delete",
+		"input put [key] => [value]\n"+
+			"input del [key] => [value]\n"+
+			"table keep [key] => [value]\n"+
+			"keep <+ [put.key, put.value]\n"+
+			"keep <- [del.key, del.value]\n")
+
+	channels := Execute(s, time.Millisecond, "", true, Options{})
+	channels.Collections["put"] <- MessageContainer{
+		Operation:  "<~",
+		Collection: "put",
+		Data:       []seed.Tuple{{"a", 1.0}, {"b", 2.0}},
+	}
+	watch(t, channels, "keep", func(tuples []seed.Tuple) bool {
+		return len(tuples) == 2
+	})
+
+	// b's value has changed since the delete read it, so b is kept
+	channels.Collections["del"] <- MessageContainer{
+		Operation:  "<~",
+		Collection: "del",
+		Data:       []seed.Tuple{{"a", 1.0}, {"b", 3.0}},
+	}
+	watch(t, channels, "keep", func(tuples []seed.Tuple) bool {
+		if len(tuples) == 2 {
+			return false
+		}
+		if len(tuples) != 1 || tuples[0][0] != "b" || tuples[0][1] != 2.0 {
+			t.Errorf("expected [[b 2]], got %v", tuples)
+		}
+		return true
+	})
+}
+
+func TestConjunction(t *testing.T) {
+	s := parse("conjunction",
+		"table left [key] => [value]\n"+
+			"table right [key] => [value]\n"+
+			"scratch both [key] => [value]\n"+
+			"both <= [left.key, left.value]: left.key => right.key, left.value => right.value\n")
+
+	channels := Execute(s, time.Millisecond, "", true, Options{})
+	for collectionName, tuples := range map[string][]seed.Tuple{
+		"left":  {{1.0, 2.0}, {3.0, 4.0}},
+		"right": {{1.0, 2.0}, {3.0, 5.0}},
+	} {
+		channels.Collections[collectionName] <- MessageContainer{
+			Operation:  "<~",
+			Collection: collectionName,
+			Data:       tuples,
+		}
+	}
+
+	// only [1 2] matches on both the key and the value
+	watch(t, channels, "both", func(tuples []seed.Tuple) bool {
+		if len(tuples) == 0 {
+			return false
+		}
+		if len(tuples) != 1 || tuples[0][0] != 1.0 || tuples[0][1] != 2.0 {
+			t.Errorf("expected [[1 2]], got %v", tuples)
+		}
+		return true
+	})
+}
+
+func TestMessagesAreNotInputs(t *testing.T) {
+	s := parse("messages are not inputs",
+		"input in [key]\n"+
+			"scratch echo [key]\n"+
+			"table seen [key]\n"+
+			"echo <= [in.key]\n"+
+			"seen <= [echo.key]\n")
+
+	channels := Execute(s, time.Millisecond, "", true, Options{})
+
+	// other seeds keep sending to echo while in is supplying it
+	stop := make(chan bool)
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case channels.Collections["echo"] <- MessageContainer{
+				Operation:  "<~",
+				Collection: "echo",
+				Data:       []seed.Tuple{{"sent"}},
+			}:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	keys := 20
+	for key := 0; key < keys; key++ {
+		channels.Collections["in"] <- MessageContainer{
+			Operation:  "<~",
+			Collection: "in",
+			Data:       []seed.Tuple{{float64(key)}},
+		}
+	}
+
+	// every key is echoed in the timestep it arrives, along with "sent"
+	watch(t, channels, "seen", func(tuples []seed.Tuple) bool {
+		return len(tuples) == keys+1
+	})
+}
+
+func TestHeldMessages(t *testing.T) {
+	s := parse("held messages",
+		"input in [key]\n"+
+			"table seen [key]\n"+
+			"seen <= [in.key]\n")
+
+	channels := Execute(s, time.Millisecond, "", true, Options{})
+
+	// spread over several timesteps, some of these arrive between the
+	// immediate and deferred phases; the immediate rule must still see
+	// them, in the next timestep
+	keys := 100
+	go func() {
+		for key := 0; key < keys; key++ {
+			time.Sleep(time.Duration(key%7) * 100 * time.Microsecond)
+			channels.Collections["in"] <- MessageContainer{
+				Operation:  "<~",
+				Collection: "in",
+				Data:       []seed.Tuple{{float64(key)}},
+			}
+		}
+	}()
+
+	watch(t, channels, "seen", func(tuples []seed.Tuple) bool {
+		return len(tuples) == keys
+	})
+}
@@ -20,8 +20,13 @@ import (
 	"github.com/nathankerr/seed"
 	"time"
 	"flag"
-	"log"
-)`, str)
+	"log"`, str)
+
+	// the packages registering the map and reduce functions
+	for _, path := range service.FunctionPackages() {
+		str = fmt.Sprintf("%s\n\t_ %#v", str, path)
+	}
+	str = fmt.Sprintf("%s\n)", str)
 	str = fmt.Sprintf("%s\nfunc main() {", str)
 
 	// command line options
@@ -31,6 +36,9 @@ import (
 	var address = flag.String("address", ":3000", "address the communicator uses")
 	var monitorAddress = flag.String("monitor", "", "address to access the debugger (http), empty means the debugger doesn't run")
 	var traceFilename = flag.String("trace", "", "filename to dump a trace to; empty means it will not run")
+	var functionErrors = flag.String("function-errors", "drop", "what happens to rows whose map or reduce functions fail (drop, report)")
+	var functionErrorCollection = flag.String("function-error-collection", "", "collection receiving an error tuple for each failed row when function errors are reported")
+	var clock = flag.String("clock", "1s", "how often host inputs receive the time: a duration, or a number of timesteps")
 
 	flag.Parse()
 `, str)
@@ -58,9 +66,18 @@ import (
 	// close seed
 	str = fmt.Sprintf("%s\n\t}", str)
 
+	// map and reduce functions are registered by the imported packages
+	// and the files added to the build
+	str = fmt.Sprintf(`%s
+
+	err := service.BindFunctions()
+	if err != nil {
+		log.Fatalln(err)
+	}
+`, str)
+
 	// execute
 	str = fmt.Sprintf(`%s
-	var err error
 	var sleepDuration time.Duration
 	if *sleep != "" {
 		sleepDuration, err = time.ParseDuration(*sleep)
@@ -78,8 +95,18 @@ import (
 		log.Fatalln("cannot use both the web-based monitoring and tracing")
 	}
 
+	options := executor.Options{FunctionErrorCollection: *functionErrorCollection}
+	options.FunctionErrors, err = executor.ParseFunctionErrorPolicy(*functionErrors)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	options.Clock, err = executor.ParseClock(*clock)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
 	println("Starting %s on " + *address)
-	channels := executor.Execute(service, sleepDuration, *address, useMonitor)
+	channels := executor.Execute(service, sleepDuration, *address, useMonitor, options)
 
 	if *monitorAddress != "" {
 		go monitor.StartMonitor(*monitorAddress, channels, service)
@@ -119,11 +146,26 @@ func collectionToGo(c *seed.Collection, indent string) string {
 		typestr = "CollectionScratch"
 	case seed.CollectionChannel:
 		typestr = "CollectionChannel"
+	case seed.CollectionLmax:
+		typestr = "CollectionLmax"
+	case seed.CollectionLset:
+		typestr = "CollectionLset"
+	case seed.CollectionLcounter:
+		typestr = "CollectionLcounter"
+	case seed.CollectionLorset:
+		typestr = "CollectionLorset"
+	case seed.CollectionLregister:
+		typestr = "CollectionLregister"
 	default:
 		panic(fmt.Sprintf("unhandled collection type: %d", c.Type))
 	}
 	str = fmt.Sprintf("%s%sType: seed.%s,\n", str, indent, typestr)
 
+	// host
+	if c.Host {
+		str = fmt.Sprintf("%s%sHost: true,\n", str, indent)
+	}
+
 	// key
 	str = fmt.Sprintf("%s%sKey:  %#v,\n", str, indent, c.Key)
 
@@ -216,7 +258,6 @@ func constraintToGo(c seed.Constraint, indent string) string {
 
 func mapFunctionToGo(functionCall seed.MapFunction, indent string) string {
 	str := fmt.Sprintf("seed.MapFunction{\n%s\tName: \"%s\",", indent, functionCall.Name)
-	str = fmt.Sprintf("%s\n%s\tFunction: %s,", str, indent, functionCall.Name)
 
 	arguments := []string{}
 	for _, argument := range functionCall.Arguments {
@@ -231,7 +272,6 @@ func mapFunctionToGo(functionCall seed.MapFunction, indent string) string {
 
 func reduceFunctionToGo(functionCall seed.ReduceFunction, indent string) string {
 	str := fmt.Sprintf("seed.ReduceFunction{\n%s\tName: \"%s\",", indent, functionCall.Name)
-	str = fmt.Sprintf("%s\n%s\tFunction: %s,", str, indent, functionCall.Name)
 
 	arguments := []string{}
 	for _, argument := range functionCall.Arguments {
@@ -0,0 +1,67 @@
+package golang
+
+import (
+	"github.com/nathankerr/seed"
+	"github.com/nathankerr/seed/transformation/network"
+	"github.com/nathankerr/seed/transformation/quorum"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestToGo(t *testing.T) {
+	gocmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go is not installed")
+	}
+
+	source, err := ioutil.ReadFile("../../services/kvs/kvs.seed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service, err := seed.FromSeed("kvs", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service, err = network.Transform(service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service, err = quorum.Transform(service)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	program, err := ToGo(service, "kvs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the functions added by the transformation are registered by
+	// importing their package
+	expected := "\t_ \"github.com/nathankerr/seed/transformation/quorum\"\n"
+	if !strings.Contains(string(program), expected) {
+		t.Errorf("expected to contain %q, got\n%s", expected, program)
+	}
+
+	// build inside this repository so that its packages are found
+	dir, err := ioutil.TempDir(".", "togo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "main.go"), program, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := exec.Command(gocmd, "build", "-o", os.DevNull, "./"+dir).CombinedOutput()
+	if err != nil {
+		t.Errorf("%s\n%s", err, output)
+	}
+}
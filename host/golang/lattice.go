@@ -0,0 +1,293 @@
+package golang
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/nathankerr/seed"
+	"sort"
+)
+
+// merge joins a value written to a data column of a lattice collection
+// with the stored one, which is nil for new keys
+func merge(collectionType seed.CollectionType, stored, written seed.Element) (seed.Element, error) {
+	switch collectionType {
+	case seed.CollectionLmax:
+		if stored == nil {
+			return written, nil
+		}
+		comparison, err := seed.Compare(stored, written)
+		if err != nil {
+			return nil, err
+		}
+		if comparison < 0 {
+			return written, nil
+		}
+		return stored, nil
+	case seed.CollectionLset:
+		return union(stored, written)
+	case seed.CollectionLcounter:
+		return maxCounts(stored, written)
+	case seed.CollectionLorset:
+		return orset(stored, written)
+	case seed.CollectionLregister:
+		return latest(stored, written)
+	}
+
+	// shouldn't get here
+	panic(collectionType)
+}
+
+// union returns the sorted set of the elements in stored and written,
+// each of which is a list or a single element
+func union(stored, written seed.Element) (seed.Element, error) {
+	set := map[string]seed.Element{}
+	for _, element := range append(elements(stored), elements(written)...) {
+		encoded, err := json.Marshal(normalize(element))
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := set[string(encoded)]; !ok {
+			set[string(encoded)] = element
+		}
+	}
+
+	encodings := []string{}
+	for encoded := range set {
+		encodings = append(encodings, encoded)
+	}
+	sort.Strings(encodings)
+
+	united := []interface{}{}
+	for _, encoded := range encodings {
+		united = append(united, set[encoded])
+	}
+	return united, nil
+}
+
+func elements(element seed.Element) []interface{} {
+	switch typed := element.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return typed
+	case seed.Tuple:
+		return typed
+	}
+	return []interface{}{element}
+}
+
+// normalize converts msgpack's []byte strings to strings so the same
+// values encode the same
+func normalize(element seed.Element) seed.Element {
+	switch typed := element.(type) {
+	case []byte:
+		return string(typed)
+	case []interface{}:
+		normalized := []interface{}{}
+		for _, e := range typed {
+			normalized = append(normalized, normalize(e))
+		}
+		return normalized
+	}
+	return element
+}
+
+// maxCounts returns the count of each replica in stored and written,
+// which map replicas to counts, keeping the larger when both have one
+func maxCounts(stored, written seed.Element) (seed.Element, error) {
+	counts := map[string]interface{}{}
+	for _, element := range []seed.Element{stored, written} {
+		replicas, err := counter(element)
+		if err != nil {
+			return nil, err
+		}
+		for replica, count := range replicas {
+			current, ok := counts[replica]
+			if !ok {
+				counts[replica] = count
+				continue
+			}
+			comparison, err := seed.Compare(current, count)
+			if err != nil {
+				return nil, err
+			}
+			if comparison < 0 {
+				counts[replica] = count
+			}
+		}
+	}
+	return counts, nil
+}
+
+// counter converts the counters decoded from wsjson and msgpack
+// messages
+func counter(element seed.Element) (map[string]interface{}, error) {
+	if element == nil {
+		return nil, nil
+	}
+	replicas, ok := stringMap(element)
+	if !ok {
+		return nil, fmt.Errorf("counter %#v does not map replicas to counts", element)
+	}
+	return replicas, nil
+}
+
+// stringMap converts the maps decoded from wsjson and msgpack messages,
+// whose keys must be strings
+func stringMap(element seed.Element) (map[string]interface{}, bool) {
+	switch typed := element.(type) {
+	case map[string]interface{}:
+		return typed, true
+	case map[interface{}]interface{}:
+		converted := map[string]interface{}{}
+		for key, value := range typed {
+			name, ok := normalize(key).(string)
+			if !ok {
+				return nil, false
+			}
+			converted[name] = value
+		}
+		return converted, true
+	}
+	return nil, false
+}
+
+// orset returns the or-set of the tags added and removed in stored and
+// written, which are {"added": {tag: element}, "removed": [tag]}. Added
+// tags which have been removed are dropped.
+func orset(stored, written seed.Element) (seed.Element, error) {
+	added := map[string]interface{}{}
+	removed := map[string]bool{}
+	for _, element := range []seed.Element{stored, written} {
+		if element == nil {
+			continue
+		}
+		tags, tombstones, err := orsetTags(element)
+		if err != nil {
+			return nil, err
+		}
+		for tag, value := range tags {
+			added[tag] = value
+		}
+		for _, tag := range tombstones {
+			removed[tag] = true
+		}
+	}
+
+	tags := []string{}
+	for tag := range removed {
+		delete(added, tag)
+		tags = append(tags, tag)
+	}
+	return map[string]interface{}{"added": added, "removed": sortedTags(tags)}, nil
+}
+
+// removal returns the or-set which removes the tags added and removed
+// in set, the value given to <-. Merging it removes the elements the
+// remover has seen, but not those added concurrently under other tags.
+func removal(set seed.Element) (seed.Element, error) {
+	added, removed, err := orsetTags(set)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := removed
+	for tag := range added {
+		tags = append(tags, tag)
+	}
+	return map[string]interface{}{"added": map[string]interface{}{}, "removed": sortedTags(tags)}, nil
+}
+
+// orsetTags returns the added tags and elements, and the removed tags,
+// of an or-set decoded from wsjson or msgpack
+func orsetTags(element seed.Element) (map[string]interface{}, []string, error) {
+	set, ok := stringMap(element)
+	if !ok {
+		return nil, nil, fmt.Errorf("or-set %#v is not a map", element)
+	}
+
+	added, ok := stringMap(set["added"])
+	if set["added"] != nil && !ok {
+		return nil, nil, fmt.Errorf("or-set added %#v does not map tags to elements", set["added"])
+	}
+
+	removed := []string{}
+	for _, tag := range elements(set["removed"]) {
+		name, ok := normalize(tag).(string)
+		if !ok {
+			return nil, nil, fmt.Errorf("or-set removed tag %#v is not a string", tag)
+		}
+		removed = append(removed, name)
+	}
+
+	return added, removed, nil
+}
+
+// sortedTags sorts and deduplicates tags, so equal or-sets encode the
+// same
+func sortedTags(tags []string) []interface{} {
+	sort.Strings(tags)
+	sorted := []interface{}{}
+	for i, tag := range tags {
+		if i > 0 && tags[i-1] == tag {
+			continue
+		}
+		sorted = append(sorted, tag)
+	}
+	return sorted
+}
+
+// latest returns the register in stored and written, which are
+// [timestamp, value] pairs, with the later timestamp. Registers written
+// at the same time keep the value which encodes larger, so every
+// replica keeps the same one.
+func latest(stored, written seed.Element) (seed.Element, error) {
+	w, err := register(written)
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return written, nil
+	}
+	s, err := register(stored)
+	if err != nil {
+		return nil, err
+	}
+
+	comparison, err := seed.Compare(s[0], w[0])
+	if err != nil {
+		return nil, err
+	}
+	if comparison == 0 {
+		storedValue, err := json.Marshal(normalize(s[1]))
+		if err != nil {
+			return nil, err
+		}
+		writtenValue, err := json.Marshal(normalize(w[1]))
+		if err != nil {
+			return nil, err
+		}
+		if string(storedValue) < string(writtenValue) {
+			comparison = -1
+		}
+	}
+	if comparison < 0 {
+		return written, nil
+	}
+	return stored, nil
+}
+
+// register checks that element is a [timestamp, value] pair
+func register(element seed.Element) ([]interface{}, error) {
+	var pair []interface{}
+	switch typed := element.(type) {
+	case []interface{}:
+		pair = typed
+	case seed.Tuple:
+		pair = typed
+	}
+	if len(pair) != 2 {
+		return nil, fmt.Errorf("register %#v is not a [timestamp, value] pair", element)
+	}
+	return pair, nil
+}
@@ -0,0 +1,86 @@
+package golang
+
+import (
+	"github.com/nathankerr/seed"
+	"reflect"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		collectionType  seed.CollectionType
+		stored, written seed.Element
+		expected        seed.Element
+	}{
+		{seed.CollectionLmax, nil, 3.0, 3.0},
+		{seed.CollectionLmax, 3.0, int64(2), 3.0},
+		{seed.CollectionLmax, "a", "b", "b"},
+		{seed.CollectionLset, nil, "b", []interface{}{"b"}},
+		{seed.CollectionLset, []interface{}{"b"}, []interface{}{"a", "b"}, []interface{}{"a", "b"}},
+		{seed.CollectionLset, []interface{}{"a"}, []byte("a"), []interface{}{"a"}},
+		{seed.CollectionLcounter, nil, map[string]interface{}{"r1": 2.0}, map[string]interface{}{"r1": 2.0}},
+		{seed.CollectionLcounter,
+			map[string]interface{}{"r1": 2.0, "r2": 1.0},
+			map[interface{}]interface{}{"r1": int64(1), "r3": int64(4)},
+			map[string]interface{}{"r1": 2.0, "r2": 1.0, "r3": int64(4)}},
+		{seed.CollectionLorset, nil,
+			map[string]interface{}{"added": map[string]interface{}{"t1": "a"}},
+			map[string]interface{}{"added": map[string]interface{}{"t1": "a"}, "removed": []interface{}{}}},
+		// the remove has seen t1 but not t2, which was added concurrently
+		{seed.CollectionLorset,
+			map[string]interface{}{"added": map[string]interface{}{"t1": "a", "t2": "a"}, "removed": []interface{}{}},
+			map[interface{}]interface{}{"added": map[interface{}]interface{}{}, "removed": []interface{}{[]byte("t1"), "t0"}},
+			map[string]interface{}{"added": map[string]interface{}{"t2": "a"}, "removed": []interface{}{"t0", "t1"}}},
+		{seed.CollectionLregister, nil, []interface{}{1.0, "a"}, []interface{}{1.0, "a"}},
+		{seed.CollectionLregister, []interface{}{2.0, "a"}, []interface{}{int64(1), "b"}, []interface{}{2.0, "a"}},
+		{seed.CollectionLregister, []interface{}{1.0, "a"}, []interface{}{int64(2), "b"}, []interface{}{int64(2), "b"}},
+		// concurrent writes keep the same value on every replica
+		{seed.CollectionLregister, []interface{}{1.0, "b"}, []interface{}{1.0, "a"}, []interface{}{1.0, "b"}},
+		{seed.CollectionLregister, []interface{}{1.0, "a"}, []interface{}{1.0, "b"}, []interface{}{1.0, "b"}},
+	}
+
+	for _, test := range tests {
+		merged, err := merge(test.collectionType, test.stored, test.written)
+		if err != nil {
+			t.Errorf("%s: merging %v into %v: %s", test.collectionType, test.written, test.stored, err)
+			continue
+		}
+		if !reflect.DeepEqual(merged, test.expected) {
+			t.Errorf("%s: merging %v into %v: expected %v, got %v", test.collectionType, test.written, test.stored, test.expected, merged)
+		}
+	}
+
+	_, err := merge(seed.CollectionLcounter, nil, 1.0)
+	if err == nil {
+		t.Error("expected an error for a counter which is not a map")
+	}
+	_, err = merge(seed.CollectionLorset, nil, []interface{}{"a"})
+	if err == nil {
+		t.Error("expected an error for an or-set which is not a map")
+	}
+	_, err = merge(seed.CollectionLregister, []interface{}{1.0, "a"}, "b")
+	if err == nil {
+		t.Error("expected an error for a register which is not a pair")
+	}
+}
+
+func TestRemoval(t *testing.T) {
+	set := map[interface{}]interface{}{
+		"added":   map[interface{}]interface{}{"t2": "b", "t1": "a"},
+		"removed": []interface{}{[]byte("t0"), "t1"},
+	}
+	expected := map[string]interface{}{"added": map[string]interface{}{}, "removed": []interface{}{"t0", "t1", "t2"}}
+
+	tombstones, err := removal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tombstones, expected) {
+		t.Errorf("expected %v, got %v", expected, tombstones)
+	}
+
+	_, err = removal("a")
+	if err == nil {
+		t.Error("expected an error for an or-set which is not a map")
+	}
+}
@@ -10,10 +10,11 @@ import (
 
 // control output verbosity by toggling the following constants
 const (
-	logNETWORKERROR = true
-	logFLOWINFO     = false
-	logINFO         = true
-	logCONTROLINFO  = false
+	logNETWORKERROR  = true
+	logFUNCTIONERROR = true
+	logFLOWINFO      = false
+	logINFO          = true
+	logCONTROLINFO   = false
 )
 
 func networkerror(id interface{}, args ...interface{}) {
@@ -22,6 +23,20 @@ func networkerror(id interface{}, args ...interface{}) {
 	}
 }
 
+// map and reduce functions which panicked
+func functionerror(ruleNumber int, name string, arguments interface{}, err error) {
+	if logFUNCTIONERROR {
+		printlog(ruleNumber, "function", name, "failed for", arguments, ":", err)
+	}
+}
+
+// tuples which could not be merged into a lattice
+func mergeerror(collectionName string, tuple interface{}, err error) {
+	if logFUNCTIONERROR {
+		printlog(collectionName, "cannot merge", tuple, ":", err)
+	}
+}
+
 // data sent and received between go routines
 func flowinfo(id interface{}, args ...interface{}) {
 	if logFLOWINFO {
@@ -1,7 +1,6 @@
 package monitor
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"github.com/nathankerr/seed"
@@ -11,7 +10,7 @@ import (
 	"html/template"
 	"io"
 	"net/http"
-	"os/exec"
+	"sort"
 	"strconv"
 )
 
@@ -66,7 +65,7 @@ func removeSockets(toRemove []int, sockets []socket) []socket {
 	return sockets
 }
 
-func sendStartupData(s *seed.Seed, socket socket, runningState string) {
+func sendStartupData(s *seed.Seed, socket socket, runningState string, graph string, active map[string]bool) {
 	messages := []executor.MonitorMessage{}
 
 	// _service block content
@@ -75,21 +74,12 @@ func sendStartupData(s *seed.Seed, socket socket, runningState string) {
 		Data:  fmt.Sprintf("<code>%s</code>", s.String()[1:]), // skip the beginning newline in the string
 	})
 
-	// _graph block content
-	dot, err := dot.ToDot(s, s.Name)
-	if err != nil {
-		panic(err)
-	}
-	graphviz := exec.Command("dot", "-Tsvg")
-	graphviz.Stdin = bytes.NewBuffer(dot)
-	graph, err := graphviz.Output()
-	if err != nil {
-		panic(err)
-	}
+	// _graph block content and its highlighting
 	messages = append(messages, executor.MonitorMessage{
 		Block: "_graph",
-		Data:  string(graph), // skip the beginning newline in the string
+		Data:  graph,
 	})
+	messages = append(messages, activeMessage(active))
 
 	// list of collections for input control
 	collections := ""
@@ -117,16 +107,93 @@ func sendStartupData(s *seed.Seed, socket socket, runningState string) {
 	}
 }
 
+// activeMessage lists the collections and rules to highlight in the
+// graph; the page toggles their classes
+func activeMessage(active map[string]bool) executor.MonitorMessage {
+	ids := []string{}
+	for id := range active {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return executor.MonitorMessage{
+		Block: "_active",
+		Data:  ids,
+	}
+}
+
+func sameActive(a, b map[string]bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for id := range a {
+		if !b[id] {
+			return false
+		}
+	}
+	return true
+}
+
+// markActive records the rules which produced data and the collections
+// they supplied. Tables and lattices always hold data, so the other
+// collections are only active when they have data.
+func markActive(s *seed.Seed, message executor.MonitorMessage, active map[string]bool) {
+	rows, ok := message.Data.([]seed.Tuple)
+	if !ok || len(rows) == 0 {
+		return
+	}
+
+	if collection, ok := s.Collections[message.Block]; ok {
+		if collection.Type != seed.CollectionTable && !collection.Type.Lattice() {
+			active[message.Block] = true
+		}
+		return
+	}
+
+	number, err := strconv.Atoi(message.Block)
+	if err != nil || number < 0 || number >= len(s.Rules) {
+		return
+	}
+	active[message.Block] = true
+	active[s.Rules[number].Supplies] = true
+}
+
 func StartMonitor(address string, channels executor.Channels, s *seed.Seed) {
 	monitorAddress = address
 	go monitorServer(address)
 
+	// the graph is laid out once; only the highlighting changes
+	graph, err := dot.ToSVG(s, s.Name)
+	if err != nil {
+		panic(err)
+	}
+
 	runningState := "running"
 	sockets := []socket{}
+	active := map[string]bool{}     // collections and rules active in this timestep
+	lastActive := map[string]bool{} // those active in the last finished timestep
 	for {
 		select {
 		case message := <-channels.Monitor:
 			monitorinfo("_monitor", message)
+			markActive(s, message, active)
+			if message.Block == "_time" {
+				// highlight the finished timestep when it differs from
+				// the last one
+				changed := !sameActive(active, lastActive)
+				lastActive = active
+				active = map[string]bool{}
+
+				if changed {
+					data, err := json.Marshal(activeMessage(lastActive))
+					if err != nil {
+						panic(err)
+					}
+					toRemove := sendToAllSockets(data, sockets)
+					sockets = removeSockets(toRemove, sockets)
+				}
+			}
+
 			message.Data = renderHTML(message, s)
 
 			// cache the running state so that
@@ -143,7 +210,7 @@ func StartMonitor(address string, channels executor.Channels, s *seed.Seed) {
 			sockets = removeSockets(toRemove, sockets)
 		case socket := <-registerSocket:
 			sockets = append(sockets, socket)
-			sendStartupData(s, socket, runningState)
+			sendStartupData(s, socket, runningState, string(graph), lastActive)
 		case message := <-incomingMessage:
 			channels.Command <- message
 		}
@@ -261,6 +328,9 @@ var rootTemplate = template.Must(template.New("root").Parse(`<!DOCTYPE html>
 
 var websocket, focus, blocks, knownBlockNames, connected
 
+// the ids of the collections and rules to highlight in _graph
+var active = []
+
 // for the service connection
 var service, server, address
 
@@ -288,7 +358,10 @@ function showMessage(m) {
 function onMessage(e) {
 	var message = JSON.parse(e.data)
 
-	if (message.Block == "_command" || message.Block == "_collections") {
+	if (message.Block == "_active") {
+		active = message.Data
+		highlight()
+	} else if (message.Block == "_command" || message.Block == "_collections") {
 		document.getElementById(message.Block).innerHTML = message.Data
 	} else {
 		knownBlockNames[message.Block] = message.Data
@@ -297,10 +370,37 @@ function onMessage(e) {
 		var block = document.getElementById(message.Block)
 		if (block != null) {
 			block.children[1].innerHTML = message.Data
+			highlight()
 		}
 	}
 }
 
+// toggles the active class of the nodes in _graph, and of the edges
+// between them
+function highlight() {
+	var graph = document.getElementById("_graph")
+	if (graph == null) {
+		return
+	}
+
+	var isActive = {}
+	active.forEach(function(id) {
+		isActive[id] = true
+	})
+
+	var nodes = graph.querySelectorAll("g[id]")
+	for (var i = 0; i < nodes.length; i++) {
+		nodes[i].classList.toggle("active", isActive[nodes[i].id] == true)
+	}
+
+	var edges = graph.querySelectorAll("polyline[data-from]")
+	for (var i = 0; i < edges.length; i++) {
+		var from = edges[i].getAttribute("data-from")
+		var to = edges[i].getAttribute("data-to")
+		edges[i].classList.toggle("active", isActive[from] == true && isActive[to] == true)
+	}
+}
+
 // for client
 function onResponseMessage(e) {
 	showMessage(e.data)
@@ -380,6 +480,7 @@ function createBlock(blockTitle) {
 	var data = knownBlockNames[blockTitle]
 	if (data != null) {
 		content.innerHTML = data
+		highlight()
 	}
 }
 
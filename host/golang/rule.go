@@ -12,14 +12,17 @@ type ruleHandler struct {
 	number   int
 	s        *seed.Seed
 	channels Channels
+	options  Options
+	failures []seed.Tuple // error tuples for the function error collection
 }
 
-func handleRule(ruleNumber int, s *seed.Seed, channels Channels) {
+func handleRule(ruleNumber int, s *seed.Seed, channels Channels, options Options) {
 	controlinfo(ruleNumber, "started")
 	handler := ruleHandler{
 		number:   ruleNumber,
 		s:        s,
 		channels: channels,
+		options:  options,
 	}
 
 	input := channels.Rules[ruleNumber]
@@ -71,8 +74,13 @@ func (handler *ruleHandler) run(dataMessages []MessageContainer) MessageContaine
 
 	// send results
 	outputName := handler.s.Rules[handler.number].Supplies
+	operation := "data"
+	// <- deletes only the tuples whose every column matches a result
+	if handler.s.Rules[handler.number].Operation == "<-" {
+		operation = "delete"
+	}
 	outputMessage := MessageContainer{
-		Operation:  "data",
+		Operation:  operation,
 		Collection: outputName,
 		Data:       results,
 	}
@@ -81,6 +89,18 @@ func (handler *ruleHandler) run(dataMessages []MessageContainer) MessageContaine
 	handler.channels.Distribution <- outputMessage
 	flowinfo(handler.number, "sent", outputMessage.String(), "to distribution")
 
+	// error tuples are inserted at the next "immediate"
+	if len(handler.failures) > 0 {
+		failuresMessage := MessageContainer{
+			Operation:  "insert",
+			Collection: handler.options.FunctionErrorCollection,
+			Data:       handler.failures,
+		}
+		handler.channels.Distribution <- failuresMessage
+		flowinfo(handler.number, "sent", failuresMessage.String(), "to distribution")
+		handler.failures = nil
+	}
+
 	return outputMessage
 }
 
@@ -146,11 +166,8 @@ func (handler *ruleHandler) calculateResults(data map[string][]seed.Tuple) []see
 		// get the tuples for this product
 		tuples := tuplesFor(productNumber, collections, lengths, data)
 
-		// skip this product if the predicate is not fulfilled
-		skip := true
-		if len(rule.Predicate) == 0 {
-			skip = false
-		}
+		// skip this product unless every constraint is fulfilled
+		skip := false
 		for _, constraint := range rule.Predicate {
 			// get the left column
 			lqc := constraint.Left
@@ -162,8 +179,9 @@ func (handler *ruleHandler) calculateResults(data map[string][]seed.Tuple) []see
 			rightColumnIndex := indexes[rqc.Collection][rqc.Column]
 			right := tuples[rqc.Collection][rightColumnIndex]
 
-			if left == right {
-				skip = false
+			if left != right {
+				skip = true
+				break
 			}
 		}
 		if skip {
@@ -173,6 +191,7 @@ func (handler *ruleHandler) calculateResults(data map[string][]seed.Tuple) []see
 		// generate the result row and add to the set of results
 		result := seed.Tuple{}
 		localReductions := map[int]seed.Tuple{} // column number: arguments
+		failed := false
 		for columnNumber, expression := range rule.Intension {
 			var element interface{}
 
@@ -190,7 +209,13 @@ func (handler *ruleHandler) calculateResults(data map[string][]seed.Tuple) []see
 				}
 
 				// run function to get result
-				element = value.Function(arguments)
+				// rows whose map functions fail are dropped
+				var err error
+				element, err = handler.callMap(value, arguments)
+				if err != nil {
+					handler.functionError(value.Name, arguments, err)
+					failed = true
+				}
 			case seed.ReduceFunction:
 				// add a place holder to the result tuple
 				element = nil
@@ -208,6 +233,9 @@ func (handler *ruleHandler) calculateResults(data map[string][]seed.Tuple) []see
 
 			result = append(result, element)
 		}
+		if failed {
+			continue
+		}
 
 		setidBytes, err := json.Marshal(result)
 		if err != nil {
@@ -228,16 +256,72 @@ func (handler *ruleHandler) calculateResults(data map[string][]seed.Tuple) []see
 	}
 
 	// run reductions and add results to the appropriate places before returning the results
+	// rows whose reductions fail are dropped
 	resultsSlice := make([]seed.Tuple, 0, len(results))
 	for setid, result := range results {
+		failed := false
 		for columnNumber, reductionTuples := range reductions[setid] {
-			result[columnNumber] = rule.Intension[columnNumber].(seed.ReduceFunction).Function(reductionTuples)
+			function := rule.Intension[columnNumber].(seed.ReduceFunction)
+			element, err := handler.callReduce(function, reductionTuples)
+			if err != nil {
+				handler.functionError(function.Name, reductionTuples, err)
+				failed = true
+				break
+			}
+			result[columnNumber] = element
+		}
+		if failed {
+			continue
 		}
 		resultsSlice = append(resultsSlice, result)
 	}
 	return resultsSlice
 }
 
+// callMap runs a map function, converting any panic into an error
+func (handler *ruleHandler) callMap(function seed.MapFunction, arguments seed.Tuple) (element seed.Element, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	if function.Function == nil {
+		return nil, errors.New("function not available")
+	}
+
+	return function.Function(arguments), nil
+}
+
+// callReduce runs a reduce function, converting any panic into an error
+func (handler *ruleHandler) callReduce(function seed.ReduceFunction, arguments []seed.Tuple) (element seed.Element, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	if function.Function == nil {
+		return nil, errors.New("function not available")
+	}
+
+	return function.Function(arguments), nil
+}
+
+// functionError reports a failed map or reduce function; its row is
+// dropped and, when the policy is ReportFunctionErrors, replaced by an
+// error tuple sent with the rule's results
+func (handler *ruleHandler) functionError(name string, arguments interface{}, err error) {
+	functionerror(handler.number, name, arguments, err)
+
+	if handler.options.FunctionErrors != ReportFunctionErrors {
+		return
+	}
+
+	handler.failures = append(handler.failures,
+		seed.Tuple{handler.number, name, fmt.Sprint(arguments), err.Error()})
+}
+
 func (handler *ruleHandler) validateData(data map[string][]seed.Tuple) error {
 	for collectionName, tuples := range data {
 		collection := handler.s.Collections[collectionName]
@@ -21,9 +21,9 @@ func TestIndexes(t *testing.T) {
 	tests = append(tests, []interface{}{
 		ruleHandler{ // hander
 			number: 0,
-			s: seed.Parse("two collections",
-				"input in [unimportant, key] => [value]"+
-					"table keep [key] => [value]"+
+			s: parse("two collections",
+				"input in [unimportant, key] => [value]\n"+
+					"table keep [key] => [value]\n"+
 					"keep <+ [in.key, in.value]"),
 		},
 		map[string]map[string]int{ // expected
@@ -39,8 +39,8 @@ func TestIndexes(t *testing.T) {
 	tests = append(tests, []interface{}{
 		ruleHandler{
 			number: 0,
-			s: seed.Parse("one collection",
-				"table keep [key] => [value]"+
+			s: parse("one collection",
+				"table keep [key] => [value]\n"+
 					"keep <+ [keep.key, keep.value]"),
 		},
 		map[string]map[string]int{
@@ -55,10 +55,10 @@ func TestIndexes(t *testing.T) {
 	tests = append(tests, []interface{}{
 		ruleHandler{
 			number: 0,
-			s: seed.Parse("three collections",
-				"input in [unimportant, key] => [value]"+
-					"table keep [key] => [value]"+
-					"table other [key] => [value]"+
+			s: parse("three collections",
+				"input in [unimportant, key] => [value]\n"+
+					"table keep [key] => [value]\n"+
+					"table other [key] => [value]\n"+
 					"keep <+ [in.key, in.value]"),
 		},
 		map[string]map[string]int{
@@ -454,9 +454,9 @@ func TestCalculateResults(t *testing.T) {
 	tests = append(tests, []interface{}{
 		ruleHandler{ // handler
 			number: 0,
-			s: seed.Parse("projection test",
-				"input in [unimportant, key] => [value]"+
-					"table keep [key] => [value]"+
+			s: parse("projection test",
+				"input in [unimportant, key] => [value]\n"+
+					"table keep [key] => [value]\n"+
 					"keep <+ [in.key, in.value]"),
 			//channels: ,
 		},
@@ -490,20 +490,20 @@ func TestCalculateResults(t *testing.T) {
 	tests = append(tests, []interface{}{
 		ruleHandler{ // handler
 			number: 0,
-			s: seed.Parse("product test",
-				"input a [key]"+
-					"input b [key]"+
-					"table keep [key]"+
-					"keep <+ [a.key, b.key]"),
+			s: parse("product test",
+				"input left [key]\n"+
+					"input right [key]\n"+
+					"table keep [key]\n"+
+					"keep <+ [left.key, right.key]"),
 			//channels: ,
 		},
 		map[string][]seed.Tuple{ // data
-			"a": []seed.Tuple{
+			"left": []seed.Tuple{
 				seed.Tuple{0: 1},
 				seed.Tuple{0: 2},
 				seed.Tuple{0: 3},
 			},
-			"b": []seed.Tuple{
+			"right": []seed.Tuple{
 				seed.Tuple{0: 4},
 				seed.Tuple{0: 5},
 				seed.Tuple{0: 6},
@@ -553,15 +553,15 @@ func TestCalculateResults(t *testing.T) {
 	tests = append(tests, []interface{}{
 		ruleHandler{ // handler
 			number: 0,
-			s: seed.Parse("filter test",
-				"input a [key]"+
-					"input b [key]"+
-					"table intersection [both]"+
-					"intersection <+ [a.key]: a.key => b.key"),
+			s: parse("filter test",
+				"input left [key]\n"+
+					"input right [key]\n"+
+					"table intersection [both]\n"+
+					"intersection <+ [left.key]: left.key => right.key"),
 			//channels: ,
 		},
 		map[string][]seed.Tuple{ // data
-			"a": []seed.Tuple{
+			"left": []seed.Tuple{
 				seed.Tuple{0: 1},
 				seed.Tuple{0: 2},
 				seed.Tuple{0: 3},
@@ -569,7 +569,7 @@ func TestCalculateResults(t *testing.T) {
 				seed.Tuple{0: 5},
 				seed.Tuple{0: 6},
 			},
-			"b": []seed.Tuple{
+			"right": []seed.Tuple{
 				seed.Tuple{0: 4},
 				seed.Tuple{0: 5},
 				seed.Tuple{0: 6},
@@ -582,6 +582,32 @@ func TestCalculateResults(t *testing.T) {
 		},
 	})
 
+	// every constraint must hold
+	tests = append(tests, []interface{}{
+		ruleHandler{ // handler
+			number: 0,
+			s: parse("conjunction test",
+				"input left [key] => [value]\n"+
+					"input right [key] => [value]\n"+
+					"table both [key] => [value]\n"+
+					"both <+ [left.key, left.value]: left.key => right.key, left.value => right.value"),
+			//channels: ,
+		},
+		map[string][]seed.Tuple{ // data
+			"left": []seed.Tuple{
+				seed.Tuple{0: 1, 1: 2},
+				seed.Tuple{0: 3, 1: 4},
+			},
+			"right": []seed.Tuple{
+				seed.Tuple{0: 1, 1: 2},
+				seed.Tuple{0: 3, 1: 5},
+			},
+		},
+		[]seed.Tuple{ // expected
+			seed.Tuple{0: 1, 1: 2},
+		},
+	})
+
 	for _, test := range tests {
 		handler := test[0].(ruleHandler)
 		data := test[1].(map[string][]seed.Tuple)
@@ -599,7 +625,7 @@ func TestCalculateResults(t *testing.T) {
 
 		// turn the list of result seed.Tuples into a map
 		resultTuples := map[string]seed.Tuple{}
-		for _, tuple := range expected {
+		for _, tuple := range result {
 			jsonified, err := json.Marshal(tuple)
 			if err != nil {
 				panic(err)
@@ -623,3 +649,54 @@ func TestCalculateResults(t *testing.T) {
 		}
 	}
 }
+
+func TestFunctionErrors(t *testing.T) {
+	s := parse("function errors",
+		"input in [key] => [value]\n"+
+			"table keep [key] => [value]\n"+
+			"keep <+ [in.key, (fail in.value)]\n")
+	fail := s.Rules[0].Intension[1].(seed.MapFunction)
+	fail.Function = func(arguments seed.Tuple) seed.Element {
+		if arguments[0] == "bad" {
+			panic("bad value")
+		}
+		return arguments[0]
+	}
+	s.Rules[0].Intension[1] = fail
+
+	data := map[string][]seed.Tuple{
+		"in": []seed.Tuple{{1, "good"}, {2, "bad"}},
+	}
+
+	for _, policy := range []FunctionErrorPolicy{DropFunctionErrors, ReportFunctionErrors} {
+		handler := ruleHandler{
+			number:  0,
+			s:       s,
+			options: Options{FunctionErrors: policy, FunctionErrorCollection: "errors"},
+		}
+
+		results := handler.calculateResults(data)
+		if len(results) != 1 || results[0][1] != "good" {
+			t.Errorf("policy %d: expected only the good row, got %v", policy, results)
+		}
+
+		switch policy {
+		case DropFunctionErrors:
+			if len(handler.failures) != 0 {
+				t.Errorf("dropped rows should not be reported, got %v", handler.failures)
+			}
+		case ReportFunctionErrors:
+			if len(handler.failures) != 1 || handler.failures[0][1] != "fail" || handler.failures[0][3] != "bad value" {
+				t.Errorf("expected an error tuple for the bad row, got %v", handler.failures)
+			}
+		}
+	}
+}
+
+func parse(name, source string) *seed.Seed {
+	s, err := seed.FromSeed(name, []byte(source))
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
@@ -0,0 +1,392 @@
+package wsjson
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/nathankerr/seed"
+	"go/format"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// ToGoClient writes a go package for talking to a seed over wsjson.
+//
+// Dial connects to the seed and sends the address handshake wsHandler
+// expects. Each channel received by the seed gets a method sending a
+// tuple on it, with a parameter for each column; the @ column is filled
+// with the seed's address and any return address columns (those later
+// used as @ columns) with the client's address, so they are not
+// parameters. Each channel sent by the seed gets a struct with a field
+// for each column but the @ column, and an On method setting the
+// function called with each tuple received. Columns inferred to be
+// strings or integers get those types, the others are interface{}.
+func ToGoClient(s *seed.Seed, name string) ([]byte, error) {
+	packageName := strings.ToLower(name) + "client"
+	channels := clientChannels(s)
+
+	buffer := new(bytes.Buffer)
+	fmt.Fprintf(buffer, "// Code generated by seed -t goclient. DO NOT EDIT.\n\n")
+	fmt.Fprintf(buffer, "// Package %s talks to the %s seed using wsjson\n", packageName, name)
+	fmt.Fprintf(buffer, "package %s\n", packageName)
+	fmt.Fprintf(buffer, `
+import (
+	"golang.org/x/net/websocket"
+	"sync"
+)
+
+type message struct {
+	Operation  string
+	Collection string
+	Data       [][]interface{}
+}
+
+// Client is a connection to a %[1]s seed
+type Client struct {
+	ws      *websocket.Conn
+	server  string
+	address string
+	mutex   sync.Mutex
+`, name)
+	for _, channel := range channels {
+		if !channel.sent {
+			continue
+		}
+		fmt.Fprintf(buffer, "\ton%s func(%s)\n", channel.method, channel.method)
+	}
+	fmt.Fprintf(buffer, `}
+
+// Dial connects to the seed at server (host:port). address is sent as
+// the address of this client, which the seed uses to reply.
+func Dial(server string, address string) (*Client, error) {
+	ws, err := websocket.Dial("ws://"+server+"/wsjson", "", "http://"+server)
+	if err != nil {
+		return nil, err
+	}
+
+	err = websocket.JSON.Send(ws, address)
+	if err != nil {
+		ws.Close()
+		return nil, err
+	}
+
+	client := &Client{ws: ws, server: server, address: address}
+	go client.receive()
+
+	return client, nil
+}
+
+// Close closes the connection to the seed
+func (c *Client) Close() error {
+	return c.ws.Close()
+}
+
+func (c *Client) send(collection string, tuple []interface{}) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return websocket.JSON.Send(c.ws, message{
+		Operation:  "<~",
+		Collection: collection,
+		Data:       [][]interface{}{tuple},
+	})
+}
+
+// receive calls the callbacks for incoming tuples until the
+// connection fails. Tuples without the expected columns are dropped.
+func (c *Client) receive() {
+	for {
+		var incoming message
+		err := websocket.JSON.Receive(c.ws, &incoming)
+		if err != nil {
+			return
+		}
+
+		switch incoming.Collection {
+`)
+	for _, channel := range channels {
+		if !channel.sent {
+			continue
+		}
+		fmt.Fprintf(buffer, "\t\tcase %q:\n", channel.name)
+		fmt.Fprintf(buffer, "\t\t\tc.mutex.Lock()\n\t\t\tcallback := c.on%s\n\t\t\tc.mutex.Unlock()\n", channel.method)
+		fmt.Fprintf(buffer, "\t\t\tif callback == nil {\n\t\t\t\tcontinue\n\t\t\t}\n")
+		fmt.Fprintf(buffer, "\t\t\tfor _, tuple := range incoming.Data {\n")
+		fmt.Fprintf(buffer, "\t\t\t\tif reply, ok := decode%s(tuple); ok {\n", channel.method)
+		fmt.Fprintf(buffer, "\t\t\t\t\tcallback(reply)\n\t\t\t\t}\n\t\t\t}\n")
+	}
+	fmt.Fprintf(buffer, "\t\t}\n\t}\n}\n")
+
+	for _, channel := range channels {
+		if channel.sent {
+			goReply(buffer, channel)
+		} else {
+			fmt.Fprintf(buffer, "\n// %s sends [%s] on %s\n", channel.method, strings.Join(channel.columns, ", "), channel.name)
+			fmt.Fprintf(buffer, "func (c *Client) %s(%s) error {\n", channel.method, strings.Join(goParameters(channel), ", "))
+			fmt.Fprintf(buffer, "\treturn c.send(%q, []interface{}{%s})\n}\n", channel.name,
+				strings.Join(channel.tuple("", goIdentifier, "c.server", "c.address"), ", "))
+		}
+	}
+
+	return format.Source(buffer.Bytes())
+}
+
+// goReply writes the struct for the tuples of a channel sent by the
+// seed, the function decoding them and the method setting their
+// callback
+func goReply(buffer *bytes.Buffer, channel clientChannel) {
+	fmt.Fprintf(buffer, "\n// %s is a tuple received on %s\n", channel.method, channel.name)
+	fmt.Fprintf(buffer, "type %s struct {\n", channel.method)
+	for i, column := range channel.columns {
+		if i != channel.address {
+			fmt.Fprintf(buffer, "\t%s %s\n", camelCase(column), goType(channel.types[i]))
+		}
+	}
+	fmt.Fprintf(buffer, "}\n")
+
+	fmt.Fprintf(buffer, "\nfunc decode%s(tuple []interface{}) (%s, bool) {\n", channel.method, channel.method)
+	fmt.Fprintf(buffer, "\tvar reply %s\n", channel.method)
+	fmt.Fprintf(buffer, "\tif len(tuple) != %d {\n\t\treturn reply, false\n\t}\n", len(channel.columns))
+	for i, column := range channel.columns {
+		if i == channel.address {
+			continue
+		}
+		field := camelCase(column)
+		switch channel.types[i] {
+		case "string":
+			fmt.Fprintf(buffer, "\tif value, ok := tuple[%d].(string); ok {\n\t\treply.%s = value\n", i, field)
+		case "integer":
+			// JSON numbers are decoded as float64s
+			fmt.Fprintf(buffer, "\tif value, ok := tuple[%d].(float64); ok && value == float64(int(value)) {\n\t\treply.%s = int(value)\n", i, field)
+		default:
+			fmt.Fprintf(buffer, "\treply.%s = tuple[%d]\n", field, i)
+			continue
+		}
+		fmt.Fprintf(buffer, "\t} else {\n\t\treturn reply, false\n\t}\n")
+	}
+	fmt.Fprintf(buffer, "\treturn reply, true\n}\n")
+
+	fmt.Fprintf(buffer, "\n// On%s sets the function called with each tuple received on %s\n", channel.method, channel.name)
+	fmt.Fprintf(buffer, "func (c *Client) On%s(callback func(%s)) {\n", channel.method, channel.method)
+	fmt.Fprintf(buffer, "\tc.mutex.Lock()\n\tc.on%s = callback\n\tc.mutex.Unlock()\n}\n", channel.method)
+}
+
+// ToJSClient writes a javascript library for talking to a seed over
+// wsjson from a browser. It defines <name>Client(server, address),
+// which connects to the seed at server (host:port) and returns an
+// object with the same functions as ToGoClient, named in lower camel
+// case. Messages sent before the connection opens are queued. When
+// address is not given, a random one is used.
+func ToJSClient(s *seed.Seed, name string) ([]byte, error) {
+	channels := clientChannels(s)
+
+	buffer := new(bytes.Buffer)
+	fmt.Fprintf(buffer, "// %sClient talks to the %s seed using wsjson\n", strings.ToLower(name), name)
+	fmt.Fprintf(buffer, `function %sClient(server, address) {
+	var client = {}
+	var callbacks = {}
+	var queue = []
+	var websocket = new WebSocket("ws://" + server + "/wsjson")
+
+	address = address || Math.random().toString(36).substr(2)
+
+	websocket.onopen = function() {
+		websocket.send(JSON.stringify(address))
+		queue.forEach(function(message) {
+			websocket.send(message)
+		})
+		queue = null
+	}
+
+	websocket.onmessage = function(event) {
+		var message = JSON.parse(event.data)
+		var callback = callbacks[message.Collection]
+		if (callback) {
+			message.Data.forEach(callback)
+		}
+	}
+
+	function send(collection, tuple) {
+		var message = JSON.stringify({
+			Operation: "<~",
+			Collection: collection,
+			Data: [tuple]
+		})
+
+		if (queue) {
+			queue.push(message)
+		} else {
+			websocket.send(message)
+		}
+	}
+
+	client.address = address
+	client.websocket = websocket
+`, strings.ToLower(name))
+
+	for _, channel := range channels {
+		method := strings.ToLower(channel.method[:1]) + channel.method[1:]
+		parameters := strings.Join(channel.tuple("", jsIdentifier, "", ""), ", ")
+		if channel.sent {
+			fmt.Fprintf(buffer, "\n\t// calls callback(%s) with each tuple received on %s\n", parameters, channel.name)
+			fmt.Fprintf(buffer, "\tclient.on%s = function(callback) {\n", channel.method)
+			fmt.Fprintf(buffer, "\t\tcallbacks[%q] = function(tuple) {\n", channel.name)
+			fmt.Fprintf(buffer, "\t\t\tcallback(%s)\n\t\t}\n\t}\n", strings.Join(channel.tuple("tuple[%d]", nil, "", ""), ", "))
+		} else {
+			fmt.Fprintf(buffer, "\n\t// sends [%s] on %s\n", strings.Join(channel.columns, ", "), channel.name)
+			fmt.Fprintf(buffer, "\tclient.%s = function(%s) {\n", method, parameters)
+			fmt.Fprintf(buffer, "\t\tsend(%q, [%s])\n\t}\n", channel.name,
+				strings.Join(channel.tuple("", jsIdentifier, "server", "address"), ", "))
+		}
+	}
+
+	fmt.Fprintf(buffer, "\n\treturn client\n}\n")
+	fmt.Fprintf(buffer, "\nif (typeof module !== \"undefined\") {\n\tmodule.exports = %sClient\n}\n", strings.ToLower(name))
+
+	return buffer.Bytes(), nil
+}
+
+type clientChannel struct {
+	name    string
+	method  string   // name in upper camel case
+	sent    bool     // sent by the seed, otherwise received by it
+	columns []string // key then data order
+	types   []string // the inferred JSON type of each column, or ""
+	address int      // index of the @ column
+	replies map[int]bool
+}
+
+// tuple returns the expressions for the columns of a tuple. The
+// columns given by or to the client are written with identifier, or
+// with argument as a format taking the column index. When set, server
+// and client are written for the @ column and the return addresses.
+func (c clientChannel) tuple(argument string, identifier func(string) string, server string, client string) []string {
+	expressions := []string{}
+	for i, column := range c.columns {
+		switch {
+		case i == c.address:
+			if server != "" {
+				expressions = append(expressions, server)
+			}
+		case c.replies[i]:
+			if client != "" {
+				expressions = append(expressions, client)
+			}
+		case argument == "":
+			expressions = append(expressions, identifier(column))
+		default:
+			expressions = append(expressions, fmt.Sprintf(argument, i))
+		}
+	}
+	return expressions
+}
+
+// clientChannels describes the channels of a seed as seen by a client
+func clientChannels(s *seed.Seed) []clientChannel {
+	types := columnTypes(s)
+
+	supplied := map[string]bool{}
+	for _, rule := range s.Rules {
+		supplied[rule.Supplies] = true
+	}
+
+	channelNames := []string{}
+	for collectionName, collection := range s.Collections {
+		if collection.Type == seed.CollectionChannel {
+			channelNames = append(channelNames, collectionName)
+		}
+	}
+	sort.Strings(channelNames)
+
+	channels := []clientChannel{}
+	for _, channelName := range channelNames {
+		collection := s.Collections[channelName]
+		address, _ := collection.AddressColumn()
+
+		channel := clientChannel{
+			name:    channelName,
+			method:  camelCase(channelName),
+			sent:    supplied[channelName],
+			columns: append(append([]string{}, collection.Key...), collection.Data...),
+			address: address,
+			replies: map[int]bool{},
+		}
+
+		for i, column := range channel.columns {
+			// only addresses are inferred to be strings
+			qualified := seed.QualifiedColumn{Collection: channelName, Column: column}
+			channel.types = append(channel.types, types[qualified])
+			if !channel.sent && i != address && types[qualified] == "string" {
+				channel.replies[i] = true
+			}
+		}
+
+		channels = append(channels, channel)
+	}
+
+	return channels
+}
+
+func camelCase(name string) string {
+	words := strings.Split(name, "_")
+	for i, word := range words {
+		if word == "" {
+			continue
+		}
+		words[i] = strings.ToUpper(word[:1]) + word[1:]
+	}
+	return strings.Join(words, "")
+}
+
+// goIdentifier renames columns which are go keywords or the receiver
+func goIdentifier(column string) string {
+	if column == "c" || token.Lookup(column).IsKeyword() {
+		column += "_"
+	}
+	return column
+}
+
+// goParameters declares a parameter for each column given by the
+// client
+func goParameters(channel clientChannel) []string {
+	parameters := []string{}
+	for i, column := range channel.columns {
+		if i != channel.address && !channel.replies[i] {
+			parameters = append(parameters, goIdentifier(column)+" "+goType(channel.types[i]))
+		}
+	}
+	return parameters
+}
+
+// goType is the go type for an inferred JSON type
+func goType(jsonType string) string {
+	switch jsonType {
+	case "string":
+		return "string"
+	case "integer":
+		return "int"
+	}
+	return "interface{}"
+}
+
+// jsReserved holds the javascript reserved words and the variables
+// used by the client
+var jsReserved = map[string]bool{
+	"break": true, "case": true, "catch": true, "class": true, "const": true,
+	"continue": true, "debugger": true, "default": true, "delete": true,
+	"do": true, "else": true, "enum": true, "export": true, "extends": true,
+	"false": true, "finally": true, "for": true, "function": true, "if": true,
+	"import": true, "in": true, "instanceof": true, "new": true, "null": true,
+	"return": true, "super": true, "switch": true, "this": true, "throw": true,
+	"true": true, "try": true, "typeof": true, "var": true, "void": true,
+	"while": true, "with": true, "yield": true, "let": true, "static": true,
+	"client": true, "callbacks": true, "queue": true, "websocket": true,
+	"send": true, "server": true, "address": true, "callback": true,
+}
+
+func jsIdentifier(column string) string {
+	if jsReserved[column] {
+		column += "_"
+	}
+	return column
+}
@@ -0,0 +1,198 @@
+package wsjson
+
+import (
+	"github.com/nathankerr/seed"
+	executor "github.com/nathankerr/seed/host/golang"
+	"github.com/nathankerr/seed/host/golang/wsjson/internal/kvsclient"
+	"github.com/nathankerr/seed/transformation/network"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClients(t *testing.T) {
+	source, err := ioutil.ReadFile("../../../services/kvs/kvs.seed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service, err := seed.FromSeed("kvs", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service, err = network.Transform(service)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type test struct {
+		writer   func(s *seed.Seed, name string) ([]byte, error)
+		expected []string
+	}
+
+	tests := []test{
+		test{
+			writer: ToGoClient,
+			expected: []string{
+				"package kvsclient",
+				"err = websocket.JSON.Send(ws, address)",
+				"func (c *Client) Kvput(key interface{}, value interface{}) error {\n" +
+					"\treturn c.send(\"kvput\", []interface{}{c.server, key, value})",
+				"return c.send(\"kvget\", []interface{}{c.address, c.server, key})",
+				"type KvgetResponse struct {\n\tKey   interface{}\n\tValue interface{}\n}",
+				"func (c *Client) OnKvgetResponse(callback func(KvgetResponse)) {",
+				"reply.Value = tuple[2]",
+			},
+		},
+		test{
+			writer: ToJSClient,
+			expected: []string{
+				"function kvsClient(server, address) {",
+				"websocket.send(JSON.stringify(address))",
+				"client.kvput = function(key, value) {\n\t\tsend(\"kvput\", [server, key, value])",
+				"send(\"kvget\", [address, server, key])",
+				"client.onKvgetResponse = function(callback) {",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		output, err := test.writer(service, "kvs")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, expected := range test.expected {
+			if !strings.Contains(string(output), expected) {
+				t.Errorf("expected to contain\n%s\ngot\n%s", expected, output)
+			}
+		}
+	}
+}
+
+func TestGoClientTypes(t *testing.T) {
+	source := "channel request [@server, client, item]\n" +
+		"channel total [@client, server] => [items]\n" +
+		"total <~ [request.client, request.@server, {count request.item}]\n"
+	service, err := seed.FromSeed("types", []byte(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := ToGoClient(service, "types")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"func (c *Client) Request(item interface{}) error {",
+		"type Total struct {\n\tServer string\n\tItems  int\n}",
+		"if value, ok := tuple[1].(string); ok {\n\t\treply.Server = value\n\t} else {\n\t\treturn reply, false\n\t}",
+		"if value, ok := tuple[2].(float64); ok && value == float64(int(value)) {\n\t\treply.Items = int(value)",
+	} {
+		if !strings.Contains(string(output), expected) {
+			t.Errorf("expected to contain\n%s\ngot\n%s", expected, output)
+		}
+	}
+}
+
+// kvsService is the kvs service the kvsclient package was generated from
+func kvsService(t *testing.T) *seed.Seed {
+	source, err := ioutil.ReadFile("../../../services/kvs/kvs.seed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service, err := seed.FromSeed("kvs", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service, err = network.Transform(service)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return service
+}
+
+// TestGoClientGenerated checks that the kvsclient package used by
+// TestGoClient is what ToGoClient writes for kvs
+func TestGoClientGenerated(t *testing.T) {
+	output, err := ToGoClient(kvsService(t), "kvs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	generated, err := ioutil.ReadFile("internal/kvsclient/kvsclient.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(output) != string(generated) {
+		t.Errorf("internal/kvsclient/kvsclient.go is out of date; replace it with\n%s", output)
+	}
+}
+
+// TestGoClient runs kvs with a wsjson communicator and talks to it with
+// the generated client
+func TestGoClient(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	service := kvsService(t)
+	channels := executor.Execute(service, time.Millisecond, address, false, executor.Options{})
+	go Communicator(service, channels, address)
+
+	var client *kvsclient.Client
+	deadline := time.After(5 * time.Second)
+	for client == nil {
+		client, err = kvsclient.Dial(address, "client")
+		if err == nil {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal(err)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	defer client.Close()
+
+	replies := make(chan kvsclient.KvgetResponse, 100)
+	client.OnKvgetResponse(func(reply kvsclient.KvgetResponse) {
+		replies <- reply
+	})
+
+	err = client.Kvput("a", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the put is stored at the end of a timestep, so the get is
+	// repeated until it is answered
+	for {
+		err = client.Kvget("a")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case reply := <-replies:
+			if reply.Key != "a" || reply.Value != "1" {
+				t.Errorf("expected a = 1, got %+v", reply)
+			}
+			return
+		case <-time.After(20 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("timed out waiting for the kvget_response")
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package wsjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/nathankerr/seed"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ToJSONSchema describes the wsjson messages for each channel in a
+// seed as a JSON Schema (2020-12) document.
+//
+// Each message is an executor.MessageContainer holding tuples for
+// one channel. Tuples are arrays with the columns in key then data
+// order. The column starting with @ holds the address the message is
+// routed to. Seeds do not annotate column types, so the types are
+// inferred from the rules: addresses are strings and counts are
+// integers. Other columns may be any JSON value.
+func ToJSONSchema(s *seed.Seed, name string) ([]byte, error) {
+	schemas, messages := channelSchemas(s, "#/$defs/")
+
+	document := map[string]interface{}{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"$id":         strings.ToLower(name) + ".schema.json",
+		"title":       name,
+		"description": fmt.Sprintf("wsjson messages for the channels of %s. %s", name, handshakeDescription),
+		"oneOf":       messages,
+		"$defs":       schemas,
+	}
+
+	return marshal(document)
+}
+
+// ToOpenAPI describes the wsjson interface of a seed as an OpenAPI
+// 3.1 document. The channels are sent over a single websocket at
+// /wsjson, so the path only documents the upgrade; the messages are
+// the component schemas, described as in ToJSONSchema.
+func ToOpenAPI(s *seed.Seed, name string) ([]byte, error) {
+	schemas, messages := channelSchemas(s, "#/components/schemas/")
+
+	document := map[string]interface{}{
+		"openapi": "3.1.0",
+		"info": map[string]interface{}{
+			"title":   name,
+			"version": "1.0.0",
+		},
+		"paths": map[string]interface{}{
+			"/wsjson": map[string]interface{}{
+				"get": map[string]interface{}{
+					"operationId": "wsjson",
+					"summary":     "websocket carrying the channel messages",
+					"description": handshakeDescription + " Each message is one of the Message schemas.",
+					"responses": map[string]interface{}{
+						"101": map[string]interface{}{
+							"description": "switching to the websocket protocol",
+							"content": map[string]interface{}{
+								"application/json": map[string]interface{}{
+									"schema": map[string]interface{}{
+										"$ref": "#/components/schemas/Message",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		"components": map[string]interface{}{
+			"schemas": schemas,
+		},
+	}
+	schemas["Message"] = map[string]interface{}{
+		"oneOf": messages,
+	}
+
+	return marshal(document)
+}
+
+// marshal is json.MarshalIndent without escaping the < in <~
+func marshal(document interface{}) ([]byte, error) {
+	buffer := new(bytes.Buffer)
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "\t")
+	err := encoder.Encode(document)
+	return buffer.Bytes(), err
+}
+
+const handshakeDescription = "After connecting, the first message is the JSON string " +
+	"of the address (host:port) other seeds can reach the sender on. " +
+	"Every following message is a JSON object holding tuples for one channel."
+
+// channelSchemas returns the schemas for the messages and tuples of
+// each channel, named <channel> and <channel>_tuple, and references
+// to the message schemas. ref is prefixed to the schema names.
+func channelSchemas(s *seed.Seed, ref string) (map[string]interface{}, []interface{}) {
+	types := columnTypes(s)
+
+	supplied := map[string]bool{}
+	for _, rule := range s.Rules {
+		supplied[rule.Supplies] = true
+	}
+
+	channelNames := []string{}
+	for collectionName, collection := range s.Collections {
+		if collection.Type == seed.CollectionChannel {
+			channelNames = append(channelNames, collectionName)
+		}
+	}
+	sort.Strings(channelNames)
+
+	schemas := map[string]interface{}{}
+	messages := []interface{}{}
+	for _, channelName := range channelNames {
+		collection := s.Collections[channelName]
+
+		operation := map[string]interface{}{
+			"enum":        []string{"data", "<~"},
+			"description": "received by the seed; either operation is accepted",
+		}
+		direction := "received"
+		if supplied[channelName] {
+			operation = map[string]interface{}{
+				"const":       "data",
+				"description": "sent by the seed",
+			}
+			direction = "sent"
+		}
+
+		schemas[channelName] = map[string]interface{}{
+			"title":       channelName,
+			"description": fmt.Sprintf("tuples %s by the seed on the %s channel", direction, channelName),
+			"type":        "object",
+			"properties": map[string]interface{}{
+				"Operation":  operation,
+				"Collection": map[string]interface{}{"const": channelName},
+				"Data": map[string]interface{}{
+					"type":  "array",
+					"items": map[string]interface{}{"$ref": ref + channelName + "_tuple"},
+				},
+			},
+			"required":             []string{"Operation", "Collection", "Data"},
+			"additionalProperties": false,
+		}
+
+		columns := []interface{}{}
+		for i, column := range append(append([]string{}, collection.Key...), collection.Data...) {
+			schema := map[string]interface{}{
+				"title": column,
+			}
+
+			switch {
+			case column[0] == '@':
+				schema["description"] = "the address (host:port) this tuple is routed to"
+			case i < len(collection.Key):
+				schema["description"] = "key column"
+			default:
+				schema["description"] = "data column"
+			}
+
+			if columnType, ok := types[seed.QualifiedColumn{Collection: channelName, Column: column}]; ok {
+				schema["type"] = columnType
+			}
+
+			columns = append(columns, schema)
+		}
+
+		schemas[channelName+"_tuple"] = map[string]interface{}{
+			"title":       channelName + " tuple",
+			"description": fmt.Sprintf("the columns of %s in key then data order", channelName),
+			"type":        "array",
+			"prefixItems": columns,
+			"minItems":    len(columns),
+			"items":       false,
+		}
+
+		messages = append(messages, map[string]interface{}{"$ref": ref + channelName})
+	}
+
+	return schemas, messages
+}
+
+// columnTypes infers the JSON types of columns. Address columns are
+// strings and the results of count are integers. Types are spread
+// between columns which are copied into each other by rules or held
+// equal by predicates.
+func columnTypes(s *seed.Seed) map[seed.QualifiedColumn]string {
+	types := map[seed.QualifiedColumn]string{}
+	equal := [][2]seed.QualifiedColumn{}
+
+	for collectionName, collection := range s.Collections {
+		for _, column := range collection.Key {
+			if column[0] == '@' {
+				types[seed.QualifiedColumn{Collection: collectionName, Column: column}] = "string"
+			}
+		}
+	}
+
+	for _, rule := range s.Rules {
+		supplies := s.Collections[rule.Supplies]
+		columns := append(append([]string{}, supplies.Key...), supplies.Data...)
+
+		for i, expression := range rule.Intension {
+			if i >= len(columns) {
+				break
+			}
+			column := seed.QualifiedColumn{Collection: rule.Supplies, Column: columns[i]}
+
+			switch value := expression.(type) {
+			case seed.QualifiedColumn:
+				equal = append(equal, [2]seed.QualifiedColumn{column, value})
+			case seed.MapFunction:
+				// no-op
+			case seed.ReduceFunction:
+				if value.Name == "count" {
+					types[column] = "integer"
+				}
+			default:
+				panic(fmt.Sprintf("unhandled type: %v", reflect.TypeOf(expression).String()))
+			}
+		}
+
+		for _, constraint := range rule.Predicate {
+			equal = append(equal, [2]seed.QualifiedColumn{constraint.Left, constraint.Right})
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, pair := range equal {
+			left, leftOk := types[pair[0]]
+			right, rightOk := types[pair[1]]
+			switch {
+			case leftOk && !rightOk:
+				types[pair[1]] = left
+				changed = true
+			case rightOk && !leftOk:
+				types[pair[0]] = right
+				changed = true
+			}
+		}
+	}
+
+	return types
+}
@@ -0,0 +1,67 @@
+package wsjson
+
+import (
+	"encoding/json"
+	"github.com/nathankerr/seed"
+	"github.com/nathankerr/seed/transformation/network"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestToJSONSchema(t *testing.T) {
+	source, err := ioutil.ReadFile("../../../services/kvs/kvs.seed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service, err := seed.FromSeed("kvs", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service, err = network.Transform(service)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := ToJSONSchema(service, "kvs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var document struct {
+		Defs map[string]struct {
+			Properties  map[string]map[string]interface{}
+			PrefixItems []map[string]interface{}
+		} `json:"$defs"`
+	}
+	err = json.Unmarshal(output, &document)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// columns are in key then data order, and the return address of
+	// kvget is a string because it is copied into an @ column
+	titles := []interface{}{}
+	types := []interface{}{}
+	for _, column := range document.Defs["kvget_tuple"].PrefixItems {
+		titles = append(titles, column["title"])
+		types = append(types, column["type"])
+	}
+	expected := []interface{}{"kvget_response_addr", "@address", "key"}
+	if !reflect.DeepEqual(titles, expected) {
+		t.Errorf("expected columns %v, got %v", expected, titles)
+	}
+	expected = []interface{}{"string", "string", nil}
+	if !reflect.DeepEqual(types, expected) {
+		t.Errorf("expected types %v, got %v", expected, types)
+	}
+
+	if document.Defs["kvget_response"].Properties["Operation"]["const"] != "data" {
+		t.Errorf("kvget_response should be sent with data: %s", output)
+	}
+	if document.Defs["kvput"].Properties["Collection"]["const"] != "kvput" {
+		t.Errorf("kvput messages should have the kvput collection: %s", output)
+	}
+}
@@ -125,7 +125,9 @@ func Communicator(s *seed.Seed, channels executor.Channels, address string) {
 
 						ws, err := websocket.Dial(fmt.Sprintf("ws://%s/wsjson", tupleAddress), "", "http://locahost:3000")
 						if err != nil {
+							// drop the tuple, the next one will dial again
 							log(err)
+							continue
 						}
 
 						thisSocket = socket{
@@ -156,8 +158,12 @@ func Communicator(s *seed.Seed, channels executor.Channels, address string) {
 
 					_, err = thisSocket.Write(marshalled)
 					if err != nil {
-						// close the handler
-						thisSocket.done <- true
+						// close the handler, or the socket when it was dialed here
+						if thisSocket.done != nil {
+							thisSocket.done <- true
+						} else if ws, ok := thisSocket.ReadWriter.(*websocket.Conn); ok {
+							ws.Close()
+						}
 
 						// remove from the list of sockets
 						delete(sockets, tupleAddress)
@@ -215,8 +221,9 @@ func incomingMessageReader(ws *websocket.Conn) {
 		raw := make([]byte, 1024)
 		n, err := ws.Read(raw)
 		if err != nil {
+			// the socket is closed
 			info(err)
-			continue
+			return
 		}
 		info("received:", string(raw[:n]))
 
@@ -30,7 +30,7 @@ func (ct CollectionType) MarshalJSON() ([]byte, error) {
 }
 
 // UnmarshalJSON is a custom JSON unmarshaller for CollectionType.
-func (ct CollectionType) UnmarshalJSON(input []byte) error {
+func (ct *CollectionType) UnmarshalJSON(input []byte) error {
 	// check for "" at beginning and end
 	if input[0] != '"' && input[len(input)-1] != '"' {
 		panic("not a string")
@@ -38,15 +38,25 @@ func (ct CollectionType) UnmarshalJSON(input []byte) error {
 
 	switch string(input[1 : len(input)-1]) {
 	case "input":
-		ct = CollectionInput
+		*ct = CollectionInput
 	case "output":
-		ct = CollectionOutput
+		*ct = CollectionOutput
 	case "table":
-		ct = CollectionTable
+		*ct = CollectionTable
 	case "channel":
-		ct = CollectionChannel
+		*ct = CollectionChannel
 	case "scratch":
-		ct = CollectionScratch
+		*ct = CollectionScratch
+	case "lmax":
+		*ct = CollectionLmax
+	case "lset":
+		*ct = CollectionLset
+	case "lcounter":
+		*ct = CollectionLcounter
+	case "lorset":
+		*ct = CollectionLorset
+	case "lregister":
+		*ct = CollectionLregister
 	default:
 		return errors.New("Unknown collection type: " + string(input[1:len(input)-1]))
 	}
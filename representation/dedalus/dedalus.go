@@ -5,9 +5,22 @@ import (
 	"fmt"
 	"github.com/nathankerr/seed"
 	"reflect"
+	"sort"
 	"strings"
 )
 
+// SeedToDedalusFile expresses a seed in Dedalus. Rule heads use
+// name_pos for immediate (<=) rules, name_pos@next for deferred
+// inserts (<+), name_neg@next for deletes (<-) and name_pos@async for
+// channels (<~). Updates (<+-) put their rows in rule<n>_update, insert
+// them and delete the stored rows with the same key but other data:
+//
+//	rule<n>_update(key, value) := body
+//	name_pos(key, value)@next := rule<n>_update(key, value)
+//	name_neg(key, old_value)@next := rule<n>_update(key, _), name(key, old_value), ~rule<n>_update(key, old_value)
+//
+// Map function calls are written as name(args) and reduce function
+// calls as name<args>.
 func SeedToDedalusFile(s *seed.Seed, name string) ([]byte, error) {
 	buffer := new(bytes.Buffer)
 
@@ -18,17 +31,20 @@ func SeedToDedalusFile(s *seed.Seed, name string) ([]byte, error) {
 			schema = append(schema, columnName)
 		}
 
+		fmt.Fprintf(buffer, "%[1]s(%[2]s) := %[1]s_pos(%[2]s), ~%[1]s_neg(%[2]s)\n", collectionName, strings.Join(schema, ", "))
+
 		switch collection.Type {
 		case seed.CollectionInput, seed.CollectionOutput, seed.CollectionScratch, seed.CollectionChannel:
-			fmt.Fprintf(buffer, "%[1]s(%[2]s) := %[1]s_pos(%[2]s), ~%[1]s_neg(%[2]s)\n", collectionName, strings.Join(schema, ", "))
-		case seed.CollectionTable:
+			// no-op
+		case seed.CollectionTable, seed.CollectionLmax, seed.CollectionLset, seed.CollectionLcounter, seed.CollectionLorset, seed.CollectionLregister:
+			// persistence; lattices are exported as tables, without merging
 			fmt.Fprintf(buffer, "%[1]s_pos(%[2]s)@next := %[1]s_pos(%[2]s), ~%[1]s_neg(%[2]s)\n", collectionName, strings.Join(schema, ", "))
 		default:
 			panic(collection.Type)
 		}
 	}
 
-	for _, rule := range s.Rules {
+	for ruleNumber, rule := range s.Rules {
 
 		// idea:
 		// init supplies schema with its own column names
@@ -95,6 +111,7 @@ func SeedToDedalusFile(s *seed.Seed, name string) ([]byte, error) {
 		for i, expression := range rule.Intension {
 			var functionName string
 			arguments := []seed.QualifiedColumn{}
+			format := "%s(%s)"
 			switch expression := expression.(type) {
 			case seed.QualifiedColumn:
 				// already handled
@@ -105,6 +122,7 @@ func SeedToDedalusFile(s *seed.Seed, name string) ([]byte, error) {
 			case seed.ReduceFunction:
 				functionName = expression.Name
 				arguments = expression.Arguments
+				format = "%s<%s>"
 			default:
 				panic(fmt.Sprintf("unhandled type: %v", reflect.TypeOf(expression).String()))
 			}
@@ -128,16 +146,67 @@ func SeedToDedalusFile(s *seed.Seed, name string) ([]byte, error) {
 				namedArguments[argumentNumber] = argumentName
 			}
 
-			supplies[i] = fmt.Sprintf("%s(%s)", functionName, strings.Join(namedArguments, ", "))
+			supplies[i] = fmt.Sprintf(format, functionName, strings.Join(namedArguments, ", "))
 		}
 
 		predicate := []string{}
 		for collectionName, columns := range predicates {
 			predicate = append(predicate, fmt.Sprintf("%s(%s)", collectionName, strings.Join(columns, ", ")))
 		}
+		sort.Strings(predicate)
+
+		body := strings.Join(predicate, ", ")
+
+		var head string
+		switch rule.Operation {
+		case "<=":
+			head = "%s_pos(%s)"
+		case "<+":
+			head = "%s_pos(%s)@next"
+		case "<+-":
+			updateToDedalus(buffer, ruleNumber, rule.Supplies, suppliesCollection, supplies, body)
+			continue
+		case "<-":
+			head = "%s_neg(%s)@next"
+		case "<~":
+			head = "%s_pos(%s)@async"
+		default:
+			panic(rule.Operation)
+		}
+		head = fmt.Sprintf(head, rule.Supplies, strings.Join(supplies, ", "))
 
-		fmt.Fprintf(buffer, "%[1]s(%[2]s) := %s\n", rule.Supplies, strings.Join(supplies, ", "), strings.Join(predicate, ", "))
+		fmt.Fprintf(buffer, "%s := %s\n", head, body)
 	}
 
 	return buffer.Bytes(), nil
 }
+
+// updateToDedalus writes an update of collectionName as an insert and
+// a delete of the stored rows with the same key and different data
+func updateToDedalus(buffer *bytes.Buffer, ruleNumber int, collectionName string, collection *seed.Collection, supplies []string, body string) {
+	update := fmt.Sprintf("rule%d_update", ruleNumber)
+
+	columns := []string{}
+	updated := []string{} // the key columns of the update, _ for the others
+	stored := []string{}  // the key columns, old_ for the others
+	for columnNumber, columnName := range append(collection.Key, collection.Data...) {
+		columnName = strings.Replace(columnName, "@", "#", 1)
+		columns = append(columns, columnName)
+
+		if columnNumber < len(collection.Key) {
+			updated = append(updated, columnName)
+			stored = append(stored, columnName)
+			continue
+		}
+		updated = append(updated, "_")
+		stored = append(stored, "old_"+strings.TrimPrefix(columnName, "#"))
+	}
+
+	fmt.Fprintf(buffer, "%s(%s) := %s\n", update, strings.Join(supplies, ", "), body)
+	fmt.Fprintf(buffer, "%s_pos(%s)@next := %s(%s)\n", collectionName, strings.Join(columns, ", "), update, strings.Join(columns, ", "))
+	fmt.Fprintf(buffer, "%s_neg(%s)@next := %s(%s), %s(%s), ~%s(%s)\n",
+		collectionName, strings.Join(stored, ", "),
+		update, strings.Join(updated, ", "),
+		collectionName, strings.Join(stored, ", "),
+		update, strings.Join(stored, ", "))
+}
@@ -0,0 +1,174 @@
+package dedalus
+
+import (
+	"github.com/nathankerr/seed"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func sortedLines(input []byte) []string {
+	lines := strings.Split(strings.TrimSpace(string(input)), "\n")
+	sort.Strings(lines)
+	return lines
+}
+
+func TestRoundTrip(t *testing.T) {
+	filenames := []string{
+		"../../services/kvs/kvs.seed",
+		"../../services/cart/cart.seed",
+		"../../tutorial/map/kvs.seed",
+	}
+
+	for _, filename := range filenames {
+		source, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		original, err := seed.FromSeed(filename, source)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		exported, err := SeedToDedalusFile(original, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		imported, err := DedalusFileToSeed(filename, exported)
+		if err != nil {
+			t.Fatalf("%s: %s\n%s", filename, err, exported)
+		}
+
+		err = imported.Validate()
+		if err != nil {
+			t.Errorf("%s: %s", filename, err)
+		}
+
+		reexported, err := SeedToDedalusFile(imported, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(sortedLines(exported), sortedLines(reexported)) {
+			t.Errorf("%s: expected\n%s\ngot\n%s", filename, exported, reexported)
+		}
+
+		// collections keep their types and columns, though keys are
+		// only kept for updated collections
+		updated := map[string]bool{}
+		for _, rule := range original.Rules {
+			if rule.Operation == "<+-" {
+				updated[rule.Supplies] = true
+			}
+		}
+		for name, collection := range original.Collections {
+			importedCollection, ok := imported.Collections[name]
+			if !ok {
+				t.Errorf("%s: %s missing", filename, name)
+				continue
+			}
+
+			if importedCollection.Type != collection.Type {
+				t.Errorf("%s: %s should be %s, not %s", filename, name, collection.Type, importedCollection.Type)
+			}
+
+			key, data := collection.Key, collection.Data
+			if !updated[name] {
+				key, data = append(append([]string{}, key...), data...), nil
+			}
+			if !reflect.DeepEqual(importedCollection.Key, key) || !reflect.DeepEqual(importedCollection.Data, data) {
+				t.Errorf("%s: %s should have columns %v => %v, not %v => %v", filename, name, key, data, importedCollection.Key, importedCollection.Data)
+			}
+		}
+
+		// rules keep their operations
+		if len(imported.Rules) != len(original.Rules) {
+			t.Fatalf("%s: expected %d rules, got %d", filename, len(original.Rules), len(imported.Rules))
+		}
+		for i, rule := range original.Rules {
+			if imported.Rules[i].Supplies != rule.Supplies || imported.Rules[i].Operation != rule.Operation {
+				t.Errorf("%s: expected %s %s, got %s", filename, rule.Supplies, rule.Operation, imported.Rules[i])
+			}
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	source := "input kvput [key] => [value]\n" +
+		"table kvstate [key] => [value]\n" +
+		"kvstate <+- [kvput.key, kvput.value]\n"
+	s, err := seed.FromSeed("update", []byte(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exported, err := SeedToDedalusFile(s, "update")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the stored row for the key is replaced
+	expected := []string{
+		"rule0_update(key, value) := kvput(key, value)",
+		"kvstate_pos(key, value)@next := rule0_update(key, value)",
+		"kvstate_neg(key, old_value)@next := rule0_update(key, _), kvstate(key, old_value), ~rule0_update(key, old_value)",
+	}
+	for _, line := range expected {
+		if !strings.Contains(string(exported), line+"\n") {
+			t.Errorf("expected %s in\n%s", line, exported)
+		}
+	}
+}
+
+func TestChannelsAndScratches(t *testing.T) {
+	input := `request(#address, key) := request_pos(#address, key), ~request_neg(#address, key)
+pending(key) := pending_pos(key), ~pending_neg(key)
+reply(#address, key) := reply_pos(#address, key), ~reply_neg(#address, key)
+pending_pos(key) := request(#address, key)
+reply_pos(#address, upper(key))@async := pending(key), request(#address, key)
+`
+
+	s, err := DedalusFileToSeed("test", []byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]seed.CollectionType{
+		"request": seed.CollectionChannel,
+		"pending": seed.CollectionScratch,
+		"reply":   seed.CollectionChannel,
+	}
+	for name, collectionType := range expected {
+		if s.Collections[name].Type != collectionType {
+			t.Errorf("%s should be %s, not %s", name, collectionType, s.Collections[name].Type)
+		}
+	}
+
+	if s.Rules[1].Operation != "<~" {
+		t.Errorf("expected <~, got %s", s.Rules[1])
+	}
+	if _, ok := s.Rules[1].Intension[1].(seed.MapFunction); !ok {
+		t.Errorf("expected a map function, got %s", s.Rules[1])
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	inputs := []string{
+		"a(x) := a_pos(x), ~a_neg(x)\nb(x) := b_pos(x), ~b_neg(x)\nb_pos(x) := a(x), ~b(x)",
+		"a(x) := a_pos(x), ~a_neg(x)\nb(x) := b_pos(x), ~b_neg(x)\nb_pos(x) := a(1)",
+		"a(x) := a_pos(x), ~a_neg(x)\nb(x) := b_pos(x), ~b_neg(x)\nb_pos(y) := a(x)",
+		"a(x) := a_pos(x), ~a_neg(x)\nb_pos(x) := a(x)",
+		"a(x) := a_pos(x), ~a_neg(x)\nb(x) := b_pos(x), ~b_neg(x)\nb_neg(x) := a(x)",
+	}
+
+	for _, input := range inputs {
+		_, err := DedalusFileToSeed("test", []byte(input))
+		if err == nil {
+			t.Errorf("expected an error for\n%s", input)
+		}
+	}
+}
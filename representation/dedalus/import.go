@@ -0,0 +1,627 @@
+package dedalus
+
+import (
+	"errors"
+	"fmt"
+	"github.com/nathankerr/seed"
+	"strings"
+	"unicode"
+)
+
+// DedalusFileToSeed loads a Seed from Dedalus in the form written by
+// SeedToDedalusFile.
+//
+// Collections are declared by name(columns) := name_pos(columns),
+// ~name_neg(columns) and are tables when they also have the
+// persistence rule name_pos(columns)@next := name_pos(columns),
+// ~name_neg(columns). Dedalus does not record keys or collection
+// types, so every column is a key, except in updated collections, and
+// the other types are inferred:
+// collections with a #address column are channels, those no rule
+// supplies are inputs, those no rule requires are outputs and the
+// rest are scratches.
+//
+// Rule heads give the operation (see SeedToDedalusFile). Updates are
+// recognized by the statements SeedToDedalusFile writes for them, which
+// also give the keys of the updated collections. Variables appearing in
+// more than one place in a rule body become constraints.
+// Constants, negation in rule bodies and other Dedalus which cannot
+// be expressed in Seed are reported as errors.
+func DedalusFileToSeed(name string, input []byte) (*seed.Seed, error) {
+	s := &seed.Seed{
+		Name:        name,
+		Collections: make(map[string]*seed.Collection),
+	}
+
+	messages := []string{}
+	fail := func(line int, format string, args ...interface{}) {
+		messages = append(messages, fmt.Sprintf("line %d: %s", line, fmt.Sprintf(format, args...)))
+	}
+
+	statements := []statement{}
+	for lineNumber, line := range strings.Split(string(input), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+
+		tokens, err := tokenize(line)
+		if err != nil {
+			fail(lineNumber+1, "%s", err)
+			continue
+		}
+
+		p := &parser{tokens: tokens}
+		statement, err := p.statement()
+		if err != nil {
+			fail(lineNumber+1, "%s", err)
+			continue
+		}
+		statement.line = lineNumber + 1
+
+		statements = append(statements, statement)
+	}
+
+	// collections
+	tables := map[string]bool{}
+	rules := []statement{}
+	for _, statement := range statements {
+		collectionName, persistence, ok := statement.declaration()
+		switch {
+		case !ok:
+			rules = append(rules, statement)
+		case persistence:
+			tables[collectionName] = true
+		default:
+			if _, ok := s.Collections[collectionName]; ok {
+				fail(statement.line, "%s is declared more than once", collectionName)
+				continue
+			}
+
+			collection := &seed.Collection{}
+			for _, column := range statement.head.arguments {
+				collection.Key = append(collection.Key, strings.Replace(column.name, "#", "@", 1))
+			}
+			s.Collections[collectionName] = collection
+		}
+	}
+	for collectionName := range tables {
+		if _, ok := s.Collections[collectionName]; !ok {
+			messages = append(messages, fmt.Sprintf("%s has a persistence rule but is not declared", collectionName))
+		}
+	}
+
+	// rules
+	rules, updates := foldUpdates(rules, s, fail)
+	for i, statement := range rules {
+		rule, err := statement.rule(s)
+		if err != nil {
+			fail(statement.line, "%s", err)
+			continue
+		}
+		if updates[i] {
+			rule.Operation = "<+-"
+		}
+		s.Rules = append(s.Rules, rule)
+	}
+
+	if len(messages) > 0 {
+		return nil, errors.New(strings.Join(messages, "\n"))
+	}
+
+	// infer collection types
+	supplied := map[string]bool{}
+	required := map[string]bool{}
+	for _, rule := range s.Rules {
+		supplied[rule.Supplies] = true
+		for _, collectionName := range rule.Requires() {
+			required[collectionName] = true
+		}
+	}
+	for collectionName, collection := range s.Collections {
+		switch {
+		case tables[collectionName]:
+			collection.Type = seed.CollectionTable
+		case isChannel(collection):
+			collection.Type = seed.CollectionChannel
+		case !supplied[collectionName]:
+			collection.Type = seed.CollectionInput
+		case !required[collectionName]:
+			collection.Type = seed.CollectionOutput
+		default:
+			collection.Type = seed.CollectionScratch
+		}
+	}
+
+	return s, nil
+}
+
+// foldUpdates replaces the statements written for each update with an
+// insert of the update's rows, marked as an update by its index in the
+// returned statements, and uses the deletes of the stored rows to set
+// the keys of the updated collections
+func foldUpdates(statements []statement, s *seed.Seed, fail func(line int, format string, args ...interface{})) ([]statement, map[int]bool) {
+	updates := map[string]statement{}
+	for _, st := range statements {
+		if isUpdate(st.head.name) && st.head.time == "" {
+			updates[st.head.name] = st
+		}
+	}
+
+	folded := []statement{}
+	updated := map[int]bool{}
+	for _, st := range statements {
+		head := st.head
+		if _, ok := updates[head.name]; ok {
+			continue
+		}
+		if len(st.body) == 0 || !isUpdate(st.body[0].name) || head.time != "next" {
+			folded = append(folded, st)
+			continue
+		}
+		update, ok := updates[st.body[0].name]
+		if !ok {
+			fail(st.line, "%s is not defined", st.body[0].name)
+			continue
+		}
+
+		switch {
+		case strings.HasSuffix(head.name, "_pos") && len(st.body) == 1:
+			// name_pos(columns)@next := rule<n>_update(columns)
+			if !sameVariables(head.arguments, st.body[0].arguments) {
+				fail(st.line, "%s should insert the columns of %s", head.name, update.head.name)
+				continue
+			}
+			updated[len(folded)] = true
+			folded = append(folded, statement{
+				line: update.line,
+				head: atom{name: head.name, arguments: update.head.arguments, time: head.time},
+				body: update.body,
+			})
+		case strings.HasSuffix(head.name, "_neg") && len(st.body) == 3:
+			// name_neg(key, old)@next := rule<n>_update(key, _), name(key, old), ~rule<n>_update(key, old)
+			collectionName := strings.TrimSuffix(head.name, "_neg")
+			collection, ok := s.Collections[collectionName]
+			if !ok || st.body[1].name != collectionName {
+				fail(st.line, "%s should delete the stored rows of %s", head.name, collectionName)
+				continue
+			}
+
+			keys := 0
+			for keys < len(st.body[0].arguments) && st.body[0].arguments[keys].name != "_" {
+				keys++
+			}
+			columns := append(append([]string{}, collection.Key...), collection.Data...)
+			if keys == 0 || keys > len(columns) {
+				fail(st.line, "%s should use the key of %s", st.body[0], collectionName)
+				continue
+			}
+			collection.Key, collection.Data = columns[:keys], columns[keys:]
+		default:
+			fail(st.line, "unsupported use of %s", update.head.name)
+		}
+	}
+
+	return folded, updated
+}
+
+// isUpdate reports whether name is one of the rule<n>_update
+// collections SeedToDedalusFile writes for updates
+func isUpdate(name string) bool {
+	return strings.HasPrefix(name, "rule") && strings.HasSuffix(name, "_update")
+}
+
+func isChannel(collection *seed.Collection) bool {
+	for _, column := range collection.Key {
+		if strings.HasPrefix(column, "@") {
+			return true
+		}
+	}
+	return false
+}
+
+// statement is head := body
+type statement struct {
+	line int
+	head atom
+	body []atom
+}
+
+// atom is [~]name(arguments)[@time]
+type atom struct {
+	name      string
+	arguments []argument
+	negated   bool
+	time      string // "", "next" or "async"
+}
+
+// argument is a variable, _, function(variables) for map functions or
+// function<variables> for reduce functions
+type argument struct {
+	name      string
+	function  string // "", "map" or "reduce"
+	arguments []string
+}
+
+// declaration returns the collection declared by the statement, and
+// whether the statement is the persistence rule for a table
+func (st statement) declaration() (string, bool, bool) {
+	head := st.head
+	if len(st.body) != 2 || head.negated {
+		return "", false, false
+	}
+
+	var collectionName string
+	var persistence bool
+	switch {
+	case head.time == "" && !strings.HasSuffix(head.name, "_pos"):
+		collectionName = head.name
+	case head.time == "next" && strings.HasSuffix(head.name, "_pos"):
+		collectionName = strings.TrimSuffix(head.name, "_pos")
+		persistence = true
+	default:
+		return "", false, false
+	}
+
+	pos, neg := st.body[0], st.body[1]
+	if pos.name != collectionName+"_pos" || pos.negated ||
+		neg.name != collectionName+"_neg" || !neg.negated {
+		return "", false, false
+	}
+
+	if !sameVariables(head.arguments, pos.arguments) || !sameVariables(head.arguments, neg.arguments) {
+		return "", false, false
+	}
+
+	return collectionName, persistence, true
+}
+
+func sameVariables(a, b []argument) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i].function != "" || b[i].function != "" || a[i].name != b[i].name || a[i].name == "_" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// rule converts the statement into a rule for the collections in s
+func (st statement) rule(s *seed.Seed) (*seed.Rule, error) {
+	rule := &seed.Rule{}
+
+	// operation
+	head := st.head
+	switch {
+	case strings.HasSuffix(head.name, "_pos") && head.time == "":
+		rule.Operation = "<="
+	case strings.HasSuffix(head.name, "_pos") && head.time == "next":
+		rule.Operation = "<+"
+	case strings.HasSuffix(head.name, "_neg") && head.time == "next":
+		rule.Operation = "<-"
+	case strings.HasSuffix(head.name, "_pos") && head.time == "async":
+		rule.Operation = "<~"
+	default:
+		return nil, fmt.Errorf("unsupported rule head %s (expected name_pos, name_pos@next, name_neg@next or name_pos@async)", head)
+	}
+	rule.Supplies = head.name[:len(head.name)-len("_pos")]
+
+	supplies, ok := s.Collections[rule.Supplies]
+	if !ok {
+		return nil, fmt.Errorf("%s is not a declared collection", rule.Supplies)
+	}
+	if len(head.arguments) != len(supplies.Key)+len(supplies.Data) {
+		return nil, fmt.Errorf("%s has %d columns, not %d", rule.Supplies, len(supplies.Key)+len(supplies.Data), len(head.arguments))
+	}
+
+	// body
+	if len(st.body) == 0 {
+		return nil, errors.New("rules must have a body")
+	}
+	bindings := map[string]seed.QualifiedColumn{}
+	seen := map[string]bool{}
+	for _, literal := range st.body {
+		if literal.negated {
+			return nil, fmt.Errorf("negation of %s is not supported", literal.name)
+		}
+		if literal.time != "" {
+			return nil, fmt.Errorf("%s: times are not supported in rule bodies", literal)
+		}
+		if seen[literal.name] {
+			return nil, fmt.Errorf("%s is used more than once (self joins are not supported)", literal.name)
+		}
+		seen[literal.name] = true
+
+		collection, ok := s.Collections[literal.name]
+		if !ok {
+			return nil, fmt.Errorf("%s is not a declared collection", literal.name)
+		}
+		columns := append(append([]string{}, collection.Key...), collection.Data...)
+		if len(literal.arguments) != len(columns) {
+			return nil, fmt.Errorf("%s has %d columns, not %d", literal.name, len(columns), len(literal.arguments))
+		}
+
+		for columnNumber, variable := range literal.arguments {
+			if variable.function != "" {
+				return nil, fmt.Errorf("%s: functions are not supported in rule bodies", literal)
+			}
+			if variable.name == "_" {
+				continue
+			}
+
+			qc := seed.QualifiedColumn{Collection: literal.name, Column: columns[columnNumber]}
+			bound, ok := bindings[variable.name]
+			if ok {
+				rule.Predicate = append(rule.Predicate, seed.Constraint{Left: bound, Right: qc})
+				continue
+			}
+			bindings[variable.name] = qc
+		}
+	}
+
+	lookup := func(variable string) (seed.QualifiedColumn, error) {
+		qc, ok := bindings[variable]
+		if !ok {
+			return qc, fmt.Errorf("%s is not bound in the rule body", variable)
+		}
+		return qc, nil
+	}
+
+	// intension
+	for _, variable := range head.arguments {
+		if variable.function == "" {
+			qc, err := lookup(variable.name)
+			if err != nil {
+				return nil, err
+			}
+			rule.Intension = append(rule.Intension, qc)
+			continue
+		}
+
+		arguments := []seed.QualifiedColumn{}
+		for _, name := range variable.arguments {
+			qc, err := lookup(name)
+			if err != nil {
+				return nil, err
+			}
+			arguments = append(arguments, qc)
+		}
+
+		switch variable.function {
+		case "map":
+			rule.Intension = append(rule.Intension, seed.MapFunction{Name: variable.name, Arguments: arguments})
+		case "reduce":
+			rule.Intension = append(rule.Intension, seed.ReduceFunction{Name: variable.name, Arguments: arguments})
+		default:
+			panic(variable.function)
+		}
+	}
+
+	return rule, nil
+}
+
+func (a atom) String() string {
+	arguments := []string{}
+	for _, argument := range a.arguments {
+		arguments = append(arguments, argument.String())
+	}
+
+	str := fmt.Sprintf("%s(%s)", a.name, strings.Join(arguments, ", "))
+	if a.negated {
+		str = "~" + str
+	}
+	if a.time != "" {
+		str = fmt.Sprintf("%s@%s", str, a.time)
+	}
+
+	return str
+}
+
+func (a argument) String() string {
+	switch a.function {
+	case "map":
+		return fmt.Sprintf("%s(%s)", a.name, strings.Join(a.arguments, ", "))
+	case "reduce":
+		return fmt.Sprintf("%s<%s>", a.name, strings.Join(a.arguments, ", "))
+	default:
+		return a.name
+	}
+}
+
+// tokenize splits a line into identifiers and punctuation
+func tokenize(line string) ([]string, error) {
+	tokens := []string{}
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			// no-op
+		case r == ':' && i+1 < len(runes) && runes[i+1] == '=':
+			tokens = append(tokens, ":=")
+			i++
+		case strings.ContainsRune("(),<>~@", r):
+			tokens = append(tokens, string(r))
+		case unicode.IsLetter(r) || r == '_' || r == '#':
+			start := i
+			for i+1 < len(runes) && isIdentifier(runes[i+1]) {
+				i++
+			}
+			tokens = append(tokens, string(runes[start:i+1]))
+		case unicode.IsDigit(r) || r == '"' || r == '\'':
+			return nil, fmt.Errorf("constants are not supported (column %d)", i+1)
+		default:
+			return nil, fmt.Errorf("unexpected %q (column %d)", r, i+1)
+		}
+	}
+
+	return tokens, nil
+}
+
+func isIdentifier(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+type parser struct {
+	tokens   []string
+	position int
+}
+
+func (p *parser) peek() string {
+	if p.position >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.position]
+}
+
+func (p *parser) next() string {
+	token := p.peek()
+	p.position++
+	return token
+}
+
+func (p *parser) expect(expected string) error {
+	token := p.next()
+	if token != expected {
+		return fmt.Errorf("expected %q, got %q", expected, token)
+	}
+	return nil
+}
+
+func (p *parser) identifier() (string, error) {
+	token := p.next()
+	if token == "" || !(unicode.IsLetter([]rune(token)[0]) || token[0] == '_' || token[0] == '#') {
+		return "", fmt.Errorf("expected a name, got %q", token)
+	}
+	return token, nil
+}
+
+// statement parses head := literal, literal, ...
+func (p *parser) statement() (statement, error) {
+	st := statement{}
+
+	head, err := p.atom()
+	if err != nil {
+		return st, err
+	}
+	st.head = head
+
+	err = p.expect(":=")
+	if err != nil {
+		return st, err
+	}
+
+	for {
+		literal, err := p.atom()
+		if err != nil {
+			return st, err
+		}
+		st.body = append(st.body, literal)
+
+		if p.peek() != "," {
+			break
+		}
+		p.next()
+	}
+
+	if p.peek() != "" {
+		return st, fmt.Errorf("unexpected %q", p.peek())
+	}
+
+	return st, nil
+}
+
+// atom parses [~]name(arguments)[@time]
+func (p *parser) atom() (atom, error) {
+	a := atom{}
+
+	if p.peek() == "~" {
+		p.next()
+		a.negated = true
+	}
+
+	name, err := p.identifier()
+	if err != nil {
+		return a, err
+	}
+	a.name = name
+
+	err = p.expect("(")
+	if err != nil {
+		return a, err
+	}
+	for p.peek() != ")" {
+		argument, err := p.argument()
+		if err != nil {
+			return a, err
+		}
+		a.arguments = append(a.arguments, argument)
+
+		if p.peek() == "," {
+			p.next()
+		}
+	}
+	p.next()
+
+	if p.peek() == "@" {
+		p.next()
+		a.time = p.next()
+		switch a.time {
+		case "next", "async":
+			// supported
+		default:
+			return a, fmt.Errorf("unsupported time %q", a.time)
+		}
+	}
+
+	return a, nil
+}
+
+// argument parses variable, function(variables) or function<variables>
+func (p *parser) argument() (argument, error) {
+	a := argument{}
+
+	name, err := p.identifier()
+	if err != nil {
+		return a, err
+	}
+	a.name = name
+
+	var end string
+	switch p.peek() {
+	case "(":
+		a.function = "map"
+		end = ")"
+	case "<":
+		a.function = "reduce"
+		end = ">"
+	default:
+		return a, nil
+	}
+	p.next()
+
+	for p.peek() != end {
+		variable, err := p.identifier()
+		if err != nil {
+			return a, err
+		}
+		a.arguments = append(a.arguments, variable)
+
+		switch p.peek() {
+		case ",":
+			p.next()
+		case end:
+			// no-op
+		default:
+			return a, fmt.Errorf("expected \",\" or %q, got %q", end, p.peek())
+		}
+	}
+	p.next()
+
+	return a, nil
+}
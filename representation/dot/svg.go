@@ -0,0 +1,558 @@
+package dot
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/nathankerr/seed"
+	"html"
+	"sort"
+	"strings"
+)
+
+// ToSVG lays out and draws the graph written by ToDot without graphviz
+func ToSVG(s *seed.Seed, name string) ([]byte, error) {
+	return ToHighlightedSVG(s, name, nil)
+}
+
+// ToHighlightedSVG draws the graph written by ToDot, highlighting the
+// collections and rules in active. Active is keyed by collection name
+// and rule number, as used for monitor blocks. Nodes are groups with
+// these ids and edges have data-from and data-to attributes holding
+// them, so the highlighting can be changed by toggling the active class.
+//
+// The layout is layered: cycles are broken by reversing edges, nodes
+// are put in layers by their longest path from a source, long edges
+// are split by dummy nodes, crossings are reduced with barycenter
+// sweeps, and each node is moved towards its neighbours.
+func ToHighlightedSVG(s *seed.Seed, name string, active map[string]bool) ([]byte, error) {
+	l := newLayout(s)
+	l.breakCycles()
+	l.assignLayers()
+	l.addDummies()
+	l.orderLayers()
+	l.position()
+
+	return l.svg(name, active), nil
+}
+
+const (
+	charWidth   = 7.0
+	lineHeight  = 16.0
+	padding     = 8.0
+	nodeSep     = 24.0
+	rankSep     = 48.0
+	margin      = 8.0
+	sweeps      = 8
+	placePasses = 4
+)
+
+type layoutNode struct {
+	id         string // collection name or rule number
+	collection *seed.Collection
+	dummy      bool
+
+	width, height float64
+	x, y          float64 // center
+	layer         int
+	index         int // position in its layer
+}
+
+type layoutEdge struct {
+	from, to int
+	reversed bool  // reversed to break a cycle
+	path     []int // nodes from from to to, including dummies
+}
+
+type layout struct {
+	nodes  []*layoutNode
+	edges  []*layoutEdge
+	layers [][]int
+}
+
+func newLayout(s *seed.Seed) *layout {
+	l := &layout{}
+	index := map[string]int{}
+
+	collectionNames := []string{}
+	for collectionName := range s.Collections {
+		collectionNames = append(collectionNames, collectionName)
+	}
+	sort.Strings(collectionNames)
+
+	for _, collectionName := range collectionNames {
+		collection := s.Collections[collectionName]
+		node := &layoutNode{id: collectionName, collection: collection}
+
+		titleWidth := float64(len(collectionName))
+		if typeWidth := float64(len(collection.Type.String()) + 2); typeWidth > titleWidth {
+			titleWidth = typeWidth
+		}
+		columnsWidth := 0.0
+		for _, column := range columns(collection) {
+			if float64(len(column)) > columnsWidth {
+				columnsWidth = float64(len(column))
+			}
+		}
+		node.width = (titleWidth+columnsWidth)*charWidth + 4*padding
+		node.height = float64(len(columns(collection))) * lineHeight
+		if node.height < 2*lineHeight {
+			node.height = 2 * lineHeight
+		}
+		node.height += padding
+
+		index[collectionName] = len(l.nodes)
+		l.nodes = append(l.nodes, node)
+	}
+
+	for ruleNumber, rule := range s.Rules {
+		node := &layoutNode{id: fmt.Sprint(ruleNumber)}
+		node.width = float64(len(ruleLabel(node.id)))*charWidth + 4*padding
+		node.height = lineHeight + 4*padding
+
+		ruleIndex := len(l.nodes)
+		l.nodes = append(l.nodes, node)
+
+		requires := rule.Requires()
+		sort.Strings(requires)
+		for _, collectionName := range requires {
+			l.edges = append(l.edges, &layoutEdge{from: index[collectionName], to: ruleIndex})
+		}
+		l.edges = append(l.edges, &layoutEdge{from: ruleIndex, to: index[rule.Supplies]})
+	}
+
+	return l
+}
+
+func columns(collection *seed.Collection) []string {
+	return append(append([]string{}, collection.Key...), collection.Data...)
+}
+
+func ruleLabel(id string) string {
+	return "rule " + id
+}
+
+// edge endpoints with reversed edges pointing the other way
+func (e *layoutEdge) ends() (int, int) {
+	if e.reversed {
+		return e.to, e.from
+	}
+	return e.from, e.to
+}
+
+// breakCycles reverses the edges which close cycles, as found by a
+// depth first search
+func (l *layout) breakCycles() {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(l.nodes))
+
+	outgoing := make([][]*layoutEdge, len(l.nodes))
+	for _, edge := range l.edges {
+		outgoing[edge.from] = append(outgoing[edge.from], edge)
+	}
+
+	var visit func(node int)
+	visit = func(node int) {
+		state[node] = visiting
+		for _, edge := range outgoing[node] {
+			switch state[edge.to] {
+			case unvisited:
+				visit(edge.to)
+			case visiting:
+				edge.reversed = true
+			case visited:
+				// no-op
+			}
+		}
+		state[node] = visited
+	}
+
+	// start from the sources so that the reversed edges go back
+	// towards them
+	hasIncoming := make([]bool, len(l.nodes))
+	for _, edge := range l.edges {
+		hasIncoming[edge.to] = true
+	}
+	for node := range l.nodes {
+		if !hasIncoming[node] && state[node] == unvisited {
+			visit(node)
+		}
+	}
+	for node := range l.nodes {
+		if state[node] == unvisited {
+			visit(node)
+		}
+	}
+}
+
+// assignLayers puts each node one layer below its lowest predecessor
+func (l *layout) assignLayers() {
+	incoming := make([]int, len(l.nodes))
+	outgoing := make([][]int, len(l.nodes))
+	for _, edge := range l.edges {
+		from, to := edge.ends()
+		incoming[to]++
+		outgoing[from] = append(outgoing[from], to)
+	}
+
+	queue := []int{}
+	for node := range l.nodes {
+		if incoming[node] == 0 {
+			queue = append(queue, node)
+		}
+	}
+
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for _, successor := range outgoing[node] {
+			if l.nodes[node].layer+1 > l.nodes[successor].layer {
+				l.nodes[successor].layer = l.nodes[node].layer + 1
+			}
+			incoming[successor]--
+			if incoming[successor] == 0 {
+				queue = append(queue, successor)
+			}
+		}
+	}
+}
+
+// addDummies splits edges spanning more than one layer so that every
+// path step is between adjacent layers
+func (l *layout) addDummies() {
+	for _, edge := range l.edges {
+		from, to := edge.ends()
+		path := []int{from}
+		for layer := l.nodes[from].layer + 1; layer < l.nodes[to].layer; layer++ {
+			path = append(path, len(l.nodes))
+			l.nodes = append(l.nodes, &layoutNode{dummy: true, layer: layer})
+		}
+		path = append(path, to)
+
+		if edge.reversed {
+			for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+				path[i], path[j] = path[j], path[i]
+			}
+		}
+		edge.path = path
+	}
+
+	for node, layoutNode := range l.nodes {
+		for len(l.layers) <= layoutNode.layer {
+			l.layers = append(l.layers, []int{})
+		}
+		layoutNode.index = len(l.layers[layoutNode.layer])
+		l.layers[layoutNode.layer] = append(l.layers[layoutNode.layer], node)
+	}
+}
+
+// neighbours returns the nodes adjacent to node in the layer above
+// (up) or below
+func (l *layout) neighbours(up bool) [][]int {
+	neighbours := make([][]int, len(l.nodes))
+	for _, edge := range l.edges {
+		for i := 1; i < len(edge.path); i++ {
+			a, b := edge.path[i-1], edge.path[i]
+			if l.nodes[a].layer > l.nodes[b].layer {
+				a, b = b, a
+			}
+			if up {
+				neighbours[b] = append(neighbours[b], a)
+			} else {
+				neighbours[a] = append(neighbours[a], b)
+			}
+		}
+	}
+	return neighbours
+}
+
+// orderLayers reduces crossings by sorting each layer by the average
+// position of its neighbours in the previous layer, sweeping down and
+// up, and keeps the order with the fewest crossings
+func (l *layout) orderLayers() {
+	above := l.neighbours(true)
+	below := l.neighbours(false)
+
+	best := l.copyLayers()
+	bestCrossings := l.crossings(below)
+
+	for sweep := 0; sweep < sweeps; sweep++ {
+		for layer := 1; layer < len(l.layers); layer++ {
+			l.sortLayer(layer, above)
+		}
+		for layer := len(l.layers) - 2; layer >= 0; layer-- {
+			l.sortLayer(layer, below)
+		}
+
+		crossings := l.crossings(below)
+		if crossings < bestCrossings {
+			best = l.copyLayers()
+			bestCrossings = crossings
+		}
+	}
+
+	l.layers = best
+	for _, layer := range l.layers {
+		for index, node := range layer {
+			l.nodes[node].index = index
+		}
+	}
+}
+
+func (l *layout) sortLayer(layer int, neighbours [][]int) {
+	barycenter := map[int]float64{}
+	for _, node := range l.layers[layer] {
+		if len(neighbours[node]) == 0 {
+			barycenter[node] = float64(l.nodes[node].index)
+			continue
+		}
+
+		sum := 0.0
+		for _, neighbour := range neighbours[node] {
+			sum += float64(l.nodes[neighbour].index)
+		}
+		barycenter[node] = sum / float64(len(neighbours[node]))
+	}
+
+	nodes := l.layers[layer]
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return barycenter[nodes[i]] < barycenter[nodes[j]]
+	})
+	for index, node := range nodes {
+		l.nodes[node].index = index
+	}
+}
+
+func (l *layout) copyLayers() [][]int {
+	layers := [][]int{}
+	for _, layer := range l.layers {
+		layers = append(layers, append([]int{}, layer...))
+	}
+	return layers
+}
+
+func (l *layout) crossings(below [][]int) int {
+	crossings := 0
+	for _, layer := range l.layers {
+		for i, a := range layer {
+			for _, b := range layer[i+1:] {
+				for _, aBelow := range below[a] {
+					for _, bBelow := range below[b] {
+						if (l.nodes[a].index < l.nodes[b].index) != (l.nodes[aBelow].index < l.nodes[bBelow].index) &&
+							aBelow != bBelow {
+							crossings++
+						}
+					}
+				}
+			}
+		}
+	}
+	return crossings
+}
+
+// position sets the coordinates of the nodes. Layers are stacked top
+// to bottom. Nodes are moved towards the average x of their neighbours
+// in the previous layer, without changing their order or overlapping.
+func (l *layout) position() {
+	y := margin
+	for _, layer := range l.layers {
+		height := 0.0
+		for _, node := range layer {
+			if l.nodes[node].height > height {
+				height = l.nodes[node].height
+			}
+		}
+		for _, node := range layer {
+			l.nodes[node].y = y + height/2
+		}
+		y += height + rankSep
+	}
+
+	for _, layer := range l.layers {
+		x := 0.0
+		for _, node := range layer {
+			l.nodes[node].x = x + l.nodes[node].width/2
+			x += l.nodes[node].width + nodeSep
+		}
+	}
+
+	above := l.neighbours(true)
+	below := l.neighbours(false)
+	for pass := 0; pass < placePasses; pass++ {
+		for layer := 1; layer < len(l.layers); layer++ {
+			l.placeLayer(layer, above)
+		}
+		for layer := len(l.layers) - 2; layer >= 0; layer-- {
+			l.placeLayer(layer, below)
+		}
+	}
+
+	minX := 0.0
+	for i, node := range l.nodes {
+		if left := node.x - node.width/2; i == 0 || left < minX {
+			minX = left
+		}
+	}
+	for _, node := range l.nodes {
+		node.x += margin - minX
+	}
+}
+
+// placeLayer moves nodes towards their neighbours. The nodes are
+// pushed apart from the left and from the right and the two results
+// averaged, which keeps the layer centered under its neighbours.
+func (l *layout) placeLayer(layer int, neighbours [][]int) {
+	nodes := l.layers[layer]
+	desired := make([]float64, len(nodes))
+	for i, node := range nodes {
+		desired[i] = l.nodes[node].x
+		if len(neighbours[node]) == 0 {
+			continue
+		}
+
+		sum := 0.0
+		for _, neighbour := range neighbours[node] {
+			sum += l.nodes[neighbour].x
+		}
+		desired[i] = sum / float64(len(neighbours[node]))
+	}
+
+	fromLeft := make([]float64, len(nodes))
+	for i, node := range nodes {
+		fromLeft[i] = desired[i]
+		if i > 0 {
+			previous := l.nodes[nodes[i-1]]
+			minimum := fromLeft[i-1] + previous.width/2 + nodeSep + l.nodes[node].width/2
+			if fromLeft[i] < minimum {
+				fromLeft[i] = minimum
+			}
+		}
+	}
+
+	fromRight := make([]float64, len(nodes))
+	for i := len(nodes) - 1; i >= 0; i-- {
+		fromRight[i] = desired[i]
+		if i < len(nodes)-1 {
+			next := l.nodes[nodes[i+1]]
+			maximum := fromRight[i+1] - next.width/2 - nodeSep - l.nodes[nodes[i]].width/2
+			if fromRight[i] > maximum {
+				fromRight[i] = maximum
+			}
+		}
+	}
+
+	for i, node := range nodes {
+		l.nodes[node].x = (fromLeft[i] + fromRight[i]) / 2
+	}
+}
+
+func (l *layout) svg(name string, active map[string]bool) []byte {
+	width, height := 0.0, 0.0
+	for _, node := range l.nodes {
+		if right := node.x + node.width/2 + margin; right > width {
+			width = right
+		}
+		if bottom := node.y + node.height/2 + margin; bottom > height {
+			height = bottom
+		}
+	}
+
+	buffer := new(bytes.Buffer)
+	fmt.Fprintf(buffer, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%.0fpt\" height=\"%.0fpt\" viewBox=\"0 0 %.0f %.0f\" font-family=\"sans-serif\" font-size=\"12\">\n",
+		width, height, width, height)
+	fmt.Fprintf(buffer, "<title>%s</title>\n", html.EscapeString(name))
+	fmt.Fprintf(buffer, "<style>\n")
+	fmt.Fprintf(buffer, ".node { fill: white; stroke: black; }\n")
+	fmt.Fprintf(buffer, ".edge { fill: none; stroke: black; }\n")
+	fmt.Fprintf(buffer, ".active .node { fill: #fde68a; stroke: #b45309; stroke-width: 2; }\n")
+	fmt.Fprintf(buffer, ".edge.active { stroke: #b45309; stroke-width: 2; }\n")
+	fmt.Fprintf(buffer, "text { text-anchor: middle; dominant-baseline: central; }\n")
+	fmt.Fprintf(buffer, "</style>\n")
+	fmt.Fprintf(buffer, "<defs><marker id=\"arrow\" viewBox=\"0 0 10 10\" refX=\"10\" refY=\"5\" markerWidth=\"8\" markerHeight=\"8\" orient=\"auto\"><path d=\"M0,0 L10,5 L0,10 z\"/></marker></defs>\n")
+
+	for _, edge := range l.edges {
+		from := l.nodes[edge.from]
+		to := l.nodes[edge.to]
+
+		class := "edge"
+		if active[from.id] && active[to.id] {
+			class += " active"
+		}
+
+		points := []string{}
+		for i, node := range edge.path {
+			x, y := l.nodes[node].x, l.nodes[node].y
+			switch i {
+			case 0:
+				y = l.attach(node, edge.path[1])
+			case len(edge.path) - 1:
+				y = l.attach(node, edge.path[i-1])
+			}
+			points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+		}
+
+		fmt.Fprintf(buffer, "<polyline class=\"%s\" data-from=\"%s\" data-to=\"%s\" points=\"%s\" marker-end=\"url(#arrow)\"/>\n",
+			class, html.EscapeString(from.id), html.EscapeString(to.id), strings.Join(points, " "))
+	}
+
+	for _, node := range l.nodes {
+		if node.dummy {
+			continue
+		}
+
+		class := ""
+		if active[node.id] {
+			class = " class=\"active\""
+		}
+		fmt.Fprintf(buffer, "<g id=\"%s\"%s>\n", html.EscapeString(node.id), class)
+
+		left, top := node.x-node.width/2, node.y-node.height/2
+		if node.collection == nil {
+			fmt.Fprintf(buffer, "<polygon class=\"node\" points=\"%.1f,%.1f %.1f,%.1f %.1f,%.1f %.1f,%.1f\"/>\n",
+				node.x, top, left+node.width, node.y, node.x, top+node.height, left, node.y)
+			fmt.Fprintf(buffer, "<text x=\"%.1f\" y=\"%.1f\">%s</text>\n", node.x, node.y, ruleLabel(node.id))
+		} else {
+			cols := columns(node.collection)
+			columnsWidth := 0.0
+			for _, column := range cols {
+				if float64(len(column)) > columnsWidth {
+					columnsWidth = float64(len(column))
+				}
+			}
+			columnsWidth = columnsWidth*charWidth + 2*padding
+			divider := left + node.width - columnsWidth
+
+			fmt.Fprintf(buffer, "<rect class=\"node\" x=\"%.1f\" y=\"%.1f\" width=\"%.1f\" height=\"%.1f\"/>\n", left, top, node.width, node.height)
+			fmt.Fprintf(buffer, "<line class=\"node\" x1=\"%.1f\" y1=\"%.1f\" x2=\"%.1f\" y2=\"%.1f\"/>\n", divider, top, divider, top+node.height)
+			titleX := (left + divider) / 2
+			fmt.Fprintf(buffer, "<text x=\"%.1f\" y=\"%.1f\">%s</text>\n", titleX, node.y-lineHeight/2, html.EscapeString(node.id))
+			fmt.Fprintf(buffer, "<text x=\"%.1f\" y=\"%.1f\">(%s)</text>\n", titleX, node.y+lineHeight/2, node.collection.Type)
+
+			rowHeight := node.height / float64(len(cols))
+			for i, column := range cols {
+				rowTop := top + float64(i)*rowHeight
+				if i > 0 {
+					fmt.Fprintf(buffer, "<line class=\"node\" x1=\"%.1f\" y1=\"%.1f\" x2=\"%.1f\" y2=\"%.1f\"/>\n", divider, rowTop, left+node.width, rowTop)
+				}
+				fmt.Fprintf(buffer, "<text x=\"%.1f\" y=\"%.1f\">%s</text>\n", divider+columnsWidth/2, rowTop+rowHeight/2, html.EscapeString(column))
+			}
+		}
+
+		fmt.Fprintf(buffer, "</g>\n")
+	}
+
+	fmt.Fprintf(buffer, "</svg>\n")
+	return buffer.Bytes()
+}
+
+// attach returns the y where an edge from node towards other meets
+// the top or bottom of node
+func (l *layout) attach(node int, other int) float64 {
+	if l.nodes[other].y < l.nodes[node].y {
+		return l.nodes[node].y - l.nodes[node].height/2
+	}
+	return l.nodes[node].y + l.nodes[node].height/2
+}
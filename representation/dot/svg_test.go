@@ -0,0 +1,91 @@
+package dot
+
+import (
+	"github.com/nathankerr/seed"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestLayout(t *testing.T) {
+	filenames := []string{
+		"../../services/cart/cart.seed",
+		"../../services/kvs/kvs.seed",
+		"../../services/price/price.seed",
+		"../../services/time/time.seed",
+	}
+
+	for _, filename := range filenames {
+		source, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s, err := seed.FromSeed(filename, source)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		l := newLayout(s)
+		l.breakCycles()
+		l.assignLayers()
+		l.addDummies()
+		l.orderLayers()
+		l.position()
+
+		// nodes in a layer do not overlap
+		for _, layer := range l.layers {
+			for i := 1; i < len(layer); i++ {
+				left, right := l.nodes[layer[i-1]], l.nodes[layer[i]]
+				if left.x+left.width/2 > right.x-right.width/2 {
+					t.Errorf("%s: %q overlaps %q", filename, left.id, right.id)
+				}
+			}
+		}
+
+		// edges only step between adjacent layers
+		for _, edge := range l.edges {
+			for i := 1; i < len(edge.path); i++ {
+				step := l.nodes[edge.path[i]].layer - l.nodes[edge.path[i-1]].layer
+				if step != 1 && step != -1 {
+					t.Errorf("%s: edge from %q to %q steps %d layers", filename, l.nodes[edge.from].id, l.nodes[edge.to].id, step)
+				}
+			}
+		}
+	}
+}
+
+func TestHighlightedSVG(t *testing.T) {
+	source, err := ioutil.ReadFile("../../services/kvs/kvs.seed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := seed.FromSeed("kvs", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svg, err := ToHighlightedSVG(s, "kvs", map[string]bool{"0": true, "kvput": true, "kvstate": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		`<g id="0" class="active">`,
+		`<g id="kvput" class="active">`,
+		`<g id="kvget">`,
+		`<polyline class="edge active" data-from="kvput" data-to="0" points="`,
+		`<text x="`,
+		`>(table)</text>`,
+	}
+	for _, e := range expected {
+		if !strings.Contains(string(svg), e) {
+			t.Errorf("expected to contain\n%s\ngot\n%s", e, svg)
+		}
+	}
+
+	if strings.Count(string(svg), `class="edge active"`) != 2 {
+		t.Errorf("expected kvput -> rule 0 -> kvstate to be highlighted, got\n%s", svg)
+	}
+}
@@ -0,0 +1,137 @@
+package graph
+
+import (
+	"github.com/nathankerr/seed"
+	"io/ioutil"
+	"testing"
+)
+
+func TestGolden(t *testing.T) {
+	source, err := ioutil.ReadFile("../../services/kvs/kvs.seed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := seed.FromSeed("kvs", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type test struct {
+		name     string
+		format   func(*seed.Seed, string) ([]byte, error)
+		expected string
+	}
+
+	tests := []test{
+		test{
+			name:   "ToMermaid",
+			format: ToMermaid,
+			expected: `---
+title: kvs
+---
+flowchart TD
+	kvdel["kvdel"]
+	kvget["kvget"]
+	kvget_response["kvget_response"]
+	kvput["kvput"]
+	kvstate["kvstate"]
+	rule0["rule 0"]
+	rule1["rule 1"]
+	rule2["rule 2"]
+	kvdel --> rule1
+	kvget --> rule2
+	kvput --> rule0
+	kvstate --> rule1
+	kvstate --> rule2
+	rule0 --> kvstate
+	rule1 --> kvstate
+	rule2 --> kvget_response
+`,
+		},
+		test{
+			name:   "ToFieldMermaid",
+			format: ToFieldMermaid,
+			expected: `---
+title: kvs
+---
+flowchart TD
+	kvdel_key["kvdel.key"]
+	kvget_key["kvget.key"]
+	kvget_response_key["kvget_response.key"]
+	kvget_response_value["kvget_response.value"]
+	kvput_key["kvput.key"]
+	kvput_value["kvput.value"]
+	kvstate_key["kvstate.key"]
+	kvstate_value["kvstate.value"]
+	kvdel_key -->|"rule 1"| kvstate_key
+	kvget_key -->|"rule 2"| kvget_response_key
+	kvput_key -->|"rule 0"| kvstate_key
+	kvput_value -->|"rule 0"| kvstate_value
+	kvstate_key -->|"rule 2"| kvget_response_key
+	kvstate_key -->|"rule 1"| kvstate_key
+	kvstate_value -->|"rule 2"| kvget_response_value
+	kvstate_value -->|"rule 1"| kvstate_value
+`,
+		},
+		test{
+			name:   "ToPlantUML",
+			format: ToPlantUML,
+			expected: `@startuml kvs
+rectangle "kvdel" as kvdel
+rectangle "kvget" as kvget
+rectangle "kvget_response" as kvget_response
+rectangle "kvput" as kvput
+rectangle "kvstate" as kvstate
+rectangle "rule 0" as rule0
+rectangle "rule 1" as rule1
+rectangle "rule 2" as rule2
+
+kvdel --> rule1
+kvget --> rule2
+kvput --> rule0
+kvstate --> rule1
+kvstate --> rule2
+rule0 --> kvstate
+rule1 --> kvstate
+rule2 --> kvget_response
+@enduml
+`,
+		},
+		test{
+			name:   "ToFieldPlantUML",
+			format: ToFieldPlantUML,
+			expected: `@startuml kvs
+rectangle "kvdel.key" as kvdel_key
+rectangle "kvget.key" as kvget_key
+rectangle "kvget_response.key" as kvget_response_key
+rectangle "kvget_response.value" as kvget_response_value
+rectangle "kvput.key" as kvput_key
+rectangle "kvput.value" as kvput_value
+rectangle "kvstate.key" as kvstate_key
+rectangle "kvstate.value" as kvstate_value
+
+kvdel_key --> kvstate_key : rule 1
+kvget_key --> kvget_response_key : rule 2
+kvput_key --> kvstate_key : rule 0
+kvput_value --> kvstate_value : rule 0
+kvstate_key --> kvget_response_key : rule 2
+kvstate_key --> kvstate_key : rule 1
+kvstate_value --> kvget_response_value : rule 2
+kvstate_value --> kvstate_value : rule 1
+@enduml
+`,
+		},
+	}
+
+	for _, test := range tests {
+		output, err := test.format(s, "kvs")
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+		}
+
+		if string(output) != test.expected {
+			t.Errorf("%s: expected\n%s\ngot\n%s", test.name, test.expected, output)
+		}
+	}
+}
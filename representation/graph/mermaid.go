@@ -0,0 +1,82 @@
+package graph
+
+import (
+	"fmt"
+	"github.com/nathankerr/graph"
+	"github.com/nathankerr/seed"
+	"sort"
+	"strings"
+)
+
+func ToMermaid(seed *seed.Seed, name string) ([]byte, error) {
+	return GraphToMermaid(SeedAsGraph(seed), name)
+}
+
+func ToFieldMermaid(seed *seed.Seed, name string) ([]byte, error) {
+	return GraphToMermaid(SeedAsFieldGraph(seed), name)
+}
+
+// GraphToMermaid writes a graph as a mermaid flowchart, which renders
+// in markdown without graphviz. Nodes and edges are sorted so the
+// output does not change between runs.
+func GraphToMermaid(graph graph.Graph, name string) ([]byte, error) {
+	mermaid := fmt.Sprintf("---\ntitle: %s\n---\nflowchart TD", name)
+
+	for _, node := range sortedNodes(graph) {
+		mermaid = fmt.Sprintf("%s\n\t%s[\"%s\"]", mermaid, mermaidID(node), mermaidLabel(labelFor(node)))
+	}
+
+	for _, edge := range sortedEdges(graph) {
+		from := mermaidID(edge.Head())
+		to := mermaidID(edge.Tail())
+
+		label := ""
+		switch edge := edge.(type) {
+		case FieldEdge:
+			label = fmt.Sprintf("|\"%s\"|", mermaidLabel(edge.Label))
+		}
+
+		mermaid = fmt.Sprintf("%s\n\t%s -->%s %s", mermaid, from, label, to)
+	}
+
+	return []byte(mermaid + "\n"), nil
+}
+
+// mermaid ends subgraphs with end, so it cannot be used as a node id
+func mermaidID(node graph.Node) string {
+	id := nameFor(node)
+	if strings.ToLower(id) == "end" {
+		id += "_"
+	}
+	return id
+}
+
+func mermaidLabel(label string) string {
+	return strings.Replace(label, "\"", "#quot;", -1)
+}
+
+// sortedNodes orders the nodes of a graph by name
+func sortedNodes(g graph.Graph) []graph.Node {
+	nodes := append([]graph.Node{}, g.NodeList()...)
+	sort.Slice(nodes, func(i, j int) bool {
+		return nameFor(nodes[i]) < nameFor(nodes[j])
+	})
+	return nodes
+}
+
+// sortedEdges orders the edges of a graph by the names of their nodes
+// and their labels
+func sortedEdges(g graph.Graph) []graph.Edge {
+	edges := append([]graph.Edge{}, g.EdgeList()...)
+	key := func(edge graph.Edge) string {
+		label := ""
+		if edge, ok := edge.(FieldEdge); ok {
+			label = edge.Label
+		}
+		return nameFor(edge.Head()) + " " + nameFor(edge.Tail()) + " " + label
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		return key(edges[i]) < key(edges[j])
+	})
+	return edges
+}
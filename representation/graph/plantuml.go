@@ -0,0 +1,42 @@
+package graph
+
+import (
+	"fmt"
+	"github.com/nathankerr/graph"
+	"github.com/nathankerr/seed"
+)
+
+func ToPlantUML(seed *seed.Seed, name string) ([]byte, error) {
+	return GraphToPlantUML(SeedAsGraph(seed), name)
+}
+
+func ToFieldPlantUML(seed *seed.Seed, name string) ([]byte, error) {
+	return GraphToPlantUML(SeedAsFieldGraph(seed), name)
+}
+
+// GraphToPlantUML writes a graph as a plantuml diagram with a
+// rectangle for each node. Nodes and edges are sorted so the output
+// does not change between runs.
+func GraphToPlantUML(graph graph.Graph, name string) ([]byte, error) {
+	plantuml := fmt.Sprintf("@startuml %s", name)
+
+	for _, node := range sortedNodes(graph) {
+		plantuml = fmt.Sprintf("%s\nrectangle \"%s\" as %s", plantuml, labelFor(node), nameFor(node))
+	}
+	plantuml = fmt.Sprintf("%s\n", plantuml)
+
+	for _, edge := range sortedEdges(graph) {
+		from := nameFor(edge.Head())
+		to := nameFor(edge.Tail())
+
+		label := ""
+		switch edge := edge.(type) {
+		case FieldEdge:
+			label = fmt.Sprintf(" : %s", edge.Label)
+		}
+
+		plantuml = fmt.Sprintf("%s\n%s --> %s%s", plantuml, from, to, label)
+	}
+
+	return []byte(fmt.Sprintf("%s\n@enduml\n", plantuml)), nil
+}
@@ -0,0 +1,332 @@
+package opennet
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Omega marks a place which can hold any number of tokens
+const Omega = -1
+
+// MaxMarkings limits the size of a coverability graph
+var MaxMarkings = 100000
+
+// A Marking holds the number of tokens in each place, in the order of
+// CoverabilityGraph.Places
+type Marking []int
+
+// CoverabilityGraph is a Karp-Miller coverability graph. The
+// environment may put a token on an input place at any time; these
+// steps are labelled with the input place's name.
+type CoverabilityGraph struct {
+	Places      []string // sorted
+	Transitions []string // sorted, without the environment
+	Markings    []Marking
+	Edges       []CoverabilityEdge
+}
+
+type CoverabilityEdge struct {
+	From, To   int // index in Markings
+	Transition string
+}
+
+func (m Marking) String() string {
+	tokens := []string{}
+	for _, count := range m {
+		if count == Omega {
+			tokens = append(tokens, "ω")
+		} else {
+			tokens = append(tokens, fmt.Sprint(count))
+		}
+	}
+	return "(" + strings.Join(tokens, ", ") + ")"
+}
+
+// covers reports whether m has at least as many tokens as that in
+// every place
+func (m Marking) covers(that Marking) bool {
+	for place := range m {
+		if m[place] != Omega && (that[place] == Omega || m[place] < that[place]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Coverability builds the coverability graph of a net, starting from
+// the empty marking. Markings which strictly cover one of their
+// ancestors have the increased places set to Omega.
+func (net *OpenNet) Coverability() (*CoverabilityGraph, error) {
+	graph := &CoverabilityGraph{}
+	for placeName := range net.Places {
+		graph.Places = append(graph.Places, placeName)
+	}
+	sort.Strings(graph.Places)
+	for transitionName := range net.Transitions {
+		graph.Transitions = append(graph.Transitions, transitionName)
+	}
+	sort.Strings(graph.Transitions)
+
+	index := map[string]int{}
+	for i, placeName := range graph.Places {
+		index[placeName] = i
+	}
+
+	// steps are the transitions and the environment filling inputs
+	type step struct {
+		name             string
+		consume, produce []int
+	}
+	steps := []step{}
+	for _, transitionName := range graph.Transitions {
+		transition := net.Transitions[transitionName]
+		s := step{name: transitionName}
+		for _, placeName := range transition.Consume {
+			s.consume = append(s.consume, index[placeName])
+		}
+		for _, placeName := range transition.Produce {
+			s.produce = append(s.produce, index[placeName])
+		}
+		steps = append(steps, s)
+	}
+	for _, placeName := range graph.Places {
+		if net.Places[placeName].Type == INPUT {
+			steps = append(steps, step{name: placeName, produce: []int{index[placeName]}})
+		}
+	}
+
+	parent := []int{-1}
+	known := map[string]int{}
+	graph.Markings = append(graph.Markings, make(Marking, len(graph.Places)))
+	known[graph.Markings[0].String()] = 0
+
+	for work := []int{0}; len(work) > 0; {
+		current := work[0]
+		work = work[1:]
+		marking := graph.Markings[current]
+
+		for _, s := range steps {
+			if !marking.enables(s.consume) {
+				continue
+			}
+
+			next := append(Marking{}, marking...)
+			for _, place := range s.consume {
+				if next[place] != Omega {
+					next[place]--
+				}
+			}
+			for _, place := range s.produce {
+				if next[place] != Omega {
+					next[place]++
+				}
+			}
+
+			// accelerate places which grow along a path from an ancestor
+			for ancestor := current; ancestor != -1; ancestor = parent[ancestor] {
+				previous := graph.Markings[ancestor]
+				if !next.covers(previous) {
+					continue
+				}
+				for place := range next {
+					if next[place] != Omega && (previous[place] == Omega || next[place] > previous[place]) {
+						next[place] = Omega
+					}
+				}
+			}
+
+			to, ok := known[next.String()]
+			if !ok {
+				if len(graph.Markings) >= MaxMarkings {
+					return nil, errors.New(fmt.Sprint("coverability graph has more than ", MaxMarkings, " markings"))
+				}
+
+				to = len(graph.Markings)
+				graph.Markings = append(graph.Markings, next)
+				parent = append(parent, current)
+				known[next.String()] = to
+				work = append(work, to)
+			}
+
+			graph.Edges = append(graph.Edges, CoverabilityEdge{From: current, To: to, Transition: s.name})
+		}
+	}
+
+	return graph, nil
+}
+
+func (m Marking) enables(consume []int) bool {
+	for _, place := range consume {
+		if m[place] == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Bound returns the largest number of tokens on a place in any marking,
+// or Omega when the place is unbounded
+func (graph *CoverabilityGraph) Bound(place int) int {
+	bound := 0
+	for _, marking := range graph.Markings {
+		if marking[place] == Omega {
+			return Omega
+		}
+		if marking[place] > bound {
+			bound = marking[place]
+		}
+	}
+	return bound
+}
+
+// DeadTransitions returns the transitions which never fire, and so
+// belong to rules which can never run
+func (graph *CoverabilityGraph) DeadTransitions() []string {
+	fired := map[string]bool{}
+	for _, edge := range graph.Edges {
+		fired[edge.Transition] = true
+	}
+
+	dead := []string{}
+	for _, transitionName := range graph.Transitions {
+		if !fired[transitionName] {
+			dead = append(dead, transitionName)
+		}
+	}
+	return dead
+}
+
+// Deadlocks returns the markings where tokens are left on internal
+// places but no transition can fire, so the net can only wait for
+// more input
+func (graph *CoverabilityGraph) Deadlocks(net *OpenNet) []Marking {
+	fires := map[int]bool{}
+	for _, edge := range graph.Edges {
+		if _, ok := net.Transitions[edge.Transition]; ok {
+			fires[edge.From] = true
+		}
+	}
+
+	deadlocks := []Marking{}
+	for i, marking := range graph.Markings {
+		if fires[i] {
+			continue
+		}
+		for place, count := range marking {
+			if count != 0 && net.Places[graph.Places[place]].Type == INTERNAL {
+				deadlocks = append(deadlocks, marking)
+				break
+			}
+		}
+	}
+	return deadlocks
+}
+
+// Covered reports whether some marking has a token on place
+func (graph *CoverabilityGraph) Covered(place int) bool {
+	for _, marking := range graph.Markings {
+		if marking[place] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// InputsReaching returns the input places connected to place by a
+// path through the net
+func (net *OpenNet) InputsReaching(place string) []string {
+	producers := map[string][]Transition{}
+	for _, transition := range net.Transitions {
+		for _, produce := range transition.Produce {
+			producers[produce] = append(producers[produce], transition)
+		}
+	}
+
+	inputs := []string{}
+	seen := map[string]bool{place: true}
+	for work := []string{place}; len(work) > 0; {
+		current := work[0]
+		work = work[1:]
+		if net.Places[current].Type == INPUT {
+			inputs = append(inputs, current)
+		}
+
+		for _, transition := range producers[current] {
+			for _, consume := range transition.Consume {
+				if !seen[consume] {
+					seen[consume] = true
+					work = append(work, consume)
+				}
+			}
+		}
+	}
+
+	sort.Strings(inputs)
+	return inputs
+}
+
+// Analyze reports on the boundedness of the places, the dead
+// transitions, deadlocks, and which outputs can be reached from which
+// inputs
+func (net *OpenNet) Analyze(name string) ([]byte, error) {
+	graph, err := net.Coverability()
+	if err != nil {
+		return nil, err
+	}
+
+	buffer := new(bytes.Buffer)
+	fmt.Fprintf(buffer, "%s: %d places, %d transitions, %d markings in the coverability graph\n",
+		name, len(graph.Places), len(graph.Transitions), len(graph.Markings))
+
+	fmt.Fprintf(buffer, "\nplaces:\n")
+	for place, placeName := range graph.Places {
+		bound := graph.Bound(place)
+		if bound == Omega {
+			fmt.Fprintf(buffer, "\t%s: unbounded\n", placeName)
+		} else {
+			fmt.Fprintf(buffer, "\t%s: bounded by %d\n", placeName, bound)
+		}
+	}
+
+	fmt.Fprintf(buffer, "\ndead transitions:\n")
+	dead := graph.DeadTransitions()
+	if len(dead) == 0 {
+		fmt.Fprintf(buffer, "\tnone\n")
+	}
+	for _, transitionName := range dead {
+		fmt.Fprintf(buffer, "\t%s: needs %s\n", transitionName, strings.Join(net.Transitions[transitionName].Consume, ", "))
+	}
+
+	fmt.Fprintf(buffer, "\ndeadlocks:\n")
+	deadlocks := graph.Deadlocks(net)
+	if len(deadlocks) == 0 {
+		fmt.Fprintf(buffer, "\tnone\n")
+	} else {
+		fmt.Fprintf(buffer, "\tmarkings over (%s)\n", strings.Join(graph.Places, ", "))
+	}
+	for _, marking := range deadlocks {
+		fmt.Fprintf(buffer, "\t%s\n", marking)
+	}
+
+	fmt.Fprintf(buffer, "\noutputs:\n")
+	for place, placeName := range graph.Places {
+		if net.Places[placeName].Type != OUTPUT {
+			continue
+		}
+
+		inputs := net.InputsReaching(placeName)
+		switch {
+		case !graph.Covered(place):
+			fmt.Fprintf(buffer, "\t%s: unreachable\n", placeName)
+		case len(inputs) == 0:
+			fmt.Fprintf(buffer, "\t%s: reachable without input\n", placeName)
+		default:
+			fmt.Fprintf(buffer, "\t%s: reachable from %s\n", placeName, strings.Join(inputs, ", "))
+		}
+	}
+
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,62 @@
+package opennet
+
+import (
+	"github.com/nathankerr/seed"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	source := `input in [value]
+table state [value]
+scratch never [value]
+output out [value]
+output stuck [value]
+
+state <+ [in.value]
+out <= [state.value]
+stuck <= [never.value]
+`
+	s, err := seed.FromSeed("test", []byte(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	net := SeedAsOpenNet(s)
+
+	graph, err := net.Coverability()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dead := graph.DeadTransitions(); !reflect.DeepEqual(dead, []string{"rule2"}) {
+		t.Errorf("expected rule2 to be dead, got %v", dead)
+	}
+
+	expected := map[string]int{
+		"in":    Omega,
+		"state": Omega,
+		"never": 0,
+		"out":   Omega,
+		"stuck": 0,
+	}
+	for place, placeName := range graph.Places {
+		if bound := graph.Bound(place); bound != expected[placeName] {
+			t.Errorf("expected %s to be bounded by %d, got %d", placeName, expected[placeName], bound)
+		}
+	}
+
+	report, err := net.Analyze("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"\tout: reachable from in\n",
+		"\tstuck: unreachable\n",
+		"\trule2: needs never\n",
+	} {
+		if !strings.Contains(string(report), line) {
+			t.Errorf("expected report to contain %q, got\n%s", line, report)
+		}
+	}
+}
@@ -45,7 +45,7 @@ func SeedAsOpenNet(s *seed.Seed) *OpenNet {
 			place.Type = INPUT
 		case seed.CollectionOutput:
 			place.Type = OUTPUT
-		case seed.CollectionTable, seed.CollectionScratch:
+		case seed.CollectionTable, seed.CollectionScratch, seed.CollectionLmax, seed.CollectionLset, seed.CollectionLcounter, seed.CollectionLorset, seed.CollectionLregister:
 			place.Type = INTERNAL
 		case seed.CollectionChannel:
 			// creates two places, one for input and one for output
@@ -70,7 +70,8 @@ func SeedAsOpenNet(s *seed.Seed) *OpenNet {
 		for _, collectionName := range rule.Requires() {
 			collection := s.Collections[collectionName]
 			switch collection.Type {
-			case seed.CollectionInput, seed.CollectionOutput, seed.CollectionTable, seed.CollectionScratch:
+			case seed.CollectionInput, seed.CollectionOutput, seed.CollectionTable, seed.CollectionScratch,
+				seed.CollectionLmax, seed.CollectionLset, seed.CollectionLcounter, seed.CollectionLorset, seed.CollectionLregister:
 				transition.Consume = append(transition.Consume, collectionName)
 			case seed.CollectionChannel:
 				transition.Consume = append(transition.Consume, collectionName+"_channel_input")
@@ -82,7 +83,8 @@ func SeedAsOpenNet(s *seed.Seed) *OpenNet {
 		// fill transition.Produce
 		collection := s.Collections[rule.Supplies]
 		switch collection.Type {
-		case seed.CollectionInput, seed.CollectionOutput, seed.CollectionTable, seed.CollectionScratch:
+		case seed.CollectionInput, seed.CollectionOutput, seed.CollectionTable, seed.CollectionScratch,
+			seed.CollectionLmax, seed.CollectionLset, seed.CollectionLcounter, seed.CollectionLorset, seed.CollectionLregister:
 			transition.Produce = append(transition.Produce, rule.Supplies)
 		case seed.CollectionChannel:
 			transition.Produce = append(transition.Produce, rule.Supplies+"_channel_output")
@@ -0,0 +1,430 @@
+// Package souffle exports a seed as a Soufflé Datalog program
+package souffle
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/nathankerr/seed"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ToSouffle converts a seed into a Soufflé Datalog program.
+//
+// Every relation has a time column, t, as its first column. All other
+// columns are symbols. Immediate (<=) rules derive facts at the same
+// time as their bodies. Deferred rules derive facts for the next time:
+// <+ and <~ into <collection>_ins, <- into <collection>_del and <+-
+// into <collection>_upd, which replaces the rows with the same key
+// (listed in <collection>_replaced). Channel messages (<~) are delivered at
+// the next time. Tables persist their rows to the next time unless
+// they are deleted or replaced, the other collections only hold what
+// is derived for each time.
+//
+// Input and channel collections are read from <collection>.facts (with
+// the time as the first column) and output and channel collections are
+// written. Times run
+// from 0 to MAX_TIME, which can be set with souffle -M "MAX_TIME=n".
+//
+// Map functions are user-defined functors on symbols. count, sum, min
+// and max reductions become aggregates; other reductions cannot be
+// expressed and their rules are left out with a warning.
+//
+// Soufflé requires negation to be stratified. When a table's deletes or
+// updates depend on the table itself (e.g. delete the rows matching a
+// request), they cannot be stratified and the table's persistence
+// ignores them. The program then over-approximates the table: facts
+// which cannot be derived still cannot happen in the service. These
+// tables are listed in a warning.
+func ToSouffle(s *seed.Seed, name string) ([]byte, error) {
+	buffer := new(bytes.Buffer)
+
+	collectionNames := []string{}
+	for collectionName := range s.Collections {
+		collectionNames = append(collectionNames, collectionName)
+	}
+	sort.Strings(collectionNames)
+
+	derived := derivedRelations(s)
+	ignoreDeletes := unstratifiable(s, "<-")
+	ignoreUpdates := unstratifiable(s, "<+-")
+
+	fmt.Fprintf(buffer, "// %s\n", name)
+	for _, collectionName := range collectionNames {
+		if ignoreDeletes[collectionName] {
+			fmt.Fprintf(buffer, "// WARNING: the deletes from %s depend on %s and cannot be stratified.\n", collectionName, collectionName)
+			fmt.Fprintf(buffer, "// %s is over-approximated: its rows persist even when deleted.\n", collectionName)
+		}
+		if ignoreUpdates[collectionName] {
+			fmt.Fprintf(buffer, "// WARNING: the updates of %s depend on %s and cannot be stratified.\n", collectionName, collectionName)
+			fmt.Fprintf(buffer, "// %s is over-approximated: its rows persist even when replaced.\n", collectionName)
+		}
+	}
+
+	fmt.Fprintf(buffer, "\n#ifndef MAX_TIME\n#define MAX_TIME 10\n#endif\n")
+	fmt.Fprintf(buffer, "\n.decl timestep(t:number)\n")
+	fmt.Fprintf(buffer, "timestep(0).\n")
+	fmt.Fprintf(buffer, "timestep(T + 1) :- timestep(T), T < MAX_TIME.\n")
+
+	// relations
+	for _, collectionName := range collectionNames {
+		collection := s.Collections[collectionName]
+		attributes := []string{"t:number"}
+		for _, column := range columns(collection) {
+			attributes = append(attributes, fmt.Sprintf("%s:symbol", identifier(column)))
+		}
+
+		fmt.Fprintf(buffer, "\n// %s\n", collection.String(collectionName))
+		fmt.Fprintf(buffer, ".decl %s(%s)\n", collectionName, strings.Join(attributes, ", "))
+		for _, suffix := range derived[collectionName] {
+			fmt.Fprintf(buffer, ".decl %s%s(%s)\n", collectionName, suffix, strings.Join(attributes, ", "))
+
+			if suffix == "_upd" {
+				keys := attributes[:len(collection.Key)+1]
+				fmt.Fprintf(buffer, ".decl %s_replaced(%s)\n", collectionName, strings.Join(keys, ", "))
+			}
+		}
+
+		switch collection.Type {
+		case seed.CollectionInput:
+			fmt.Fprintf(buffer, ".input %s\n", collectionName)
+		case seed.CollectionOutput:
+			fmt.Fprintf(buffer, ".output %s\n", collectionName)
+		case seed.CollectionChannel:
+			// received and sent messages
+			fmt.Fprintf(buffer, ".input %s\n.output %s\n", collectionName, collectionName)
+		case seed.CollectionTable, seed.CollectionScratch, seed.CollectionLmax, seed.CollectionLset, seed.CollectionLcounter, seed.CollectionLorset, seed.CollectionLregister:
+			// no-op; lattices are exported as tables, without merging
+		default:
+			panic(collection.Type)
+		}
+
+		fmt.Fprintf(buffer, "%s", collectionToSouffle(collectionName, collection, derived[collectionName], ignoreDeletes[collectionName], ignoreUpdates[collectionName]))
+	}
+
+	// functors
+	functors := map[string]int{}
+	for _, rule := range s.Rules {
+		for _, expression := range rule.Intension {
+			if function, ok := expression.(seed.MapFunction); ok {
+				functors[function.Name] = len(function.Arguments)
+			}
+		}
+	}
+	if len(functors) > 0 {
+		fmt.Fprintf(buffer, "\n// map functions\n")
+		names := []string{}
+		for functorName := range functors {
+			names = append(names, functorName)
+		}
+		sort.Strings(names)
+		for _, functorName := range names {
+			parameters := []string{}
+			for i := 0; i < functors[functorName]; i++ {
+				parameters = append(parameters, fmt.Sprintf("a%d:symbol", i))
+			}
+			fmt.Fprintf(buffer, ".functor %s(%s):symbol\n", functorName, strings.Join(parameters, ", "))
+		}
+	}
+
+	// rules
+	fmt.Fprintf(buffer, "\n// rules\n")
+	for ruleNumber, rule := range s.Rules {
+		fmt.Fprintf(buffer, "// rule %d: %s\n", ruleNumber, rule)
+
+		clause, err := ruleToSouffle(s, rule)
+		if err != nil {
+			fmt.Fprintf(buffer, "// WARNING: rule %d is left out: %s\n", ruleNumber, err)
+			continue
+		}
+		fmt.Fprintf(buffer, "%s\n", clause)
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func columns(collection *seed.Collection) []string {
+	return append(append([]string{}, collection.Key...), collection.Data...)
+}
+
+// identifier removes the @ from address columns
+func identifier(column string) string {
+	return strings.Replace(column, "@", "", -1)
+}
+
+func variable(qc seed.QualifiedColumn) string {
+	return fmt.Sprintf("%s_%s", qc.Collection, identifier(qc.Column))
+}
+
+// the relation each deferred operation derives
+func suffix(operation string) string {
+	switch operation {
+	case "<+", "<~":
+		return "_ins"
+	case "<-":
+		return "_del"
+	case "<+-":
+		return "_upd"
+	default:
+		panic(operation)
+	}
+}
+
+// derivedRelations lists the extra relations for each collection
+func derivedRelations(s *seed.Seed) map[string][]string {
+	needed := map[string]map[string]bool{}
+	for _, rule := range s.Rules {
+		if rule.Operation == "<=" {
+			continue
+		}
+
+		if _, ok := needed[rule.Supplies]; !ok {
+			needed[rule.Supplies] = map[string]bool{}
+		}
+		needed[rule.Supplies][suffix(rule.Operation)] = true
+
+		// updates insert the new rows and stop the rows with the
+		// same key (in _replaced) from persisting
+		if rule.Operation == "<+-" {
+			needed[rule.Supplies]["_ins"] = true
+		}
+	}
+
+	derived := map[string][]string{}
+	for collectionName, suffixes := range needed {
+		for _, suffix := range []string{"_ins", "_del", "_upd"} {
+			if suffixes[suffix] {
+				derived[collectionName] = append(derived[collectionName], suffix)
+			}
+		}
+	}
+
+	return derived
+}
+
+func contains(list []string, item string) bool {
+	for _, element := range list {
+		if element == item {
+			return true
+		}
+	}
+	return false
+}
+
+// unstratifiable finds the collections whose rules for the operation
+// (<- or <+-) depend on the collection itself
+func unstratifiable(s *seed.Seed, operation string) map[string]bool {
+	// collection: collections it depends on
+	dependencies := map[string]map[string]bool{}
+	for collectionName, collection := range s.Collections {
+		dependencies[collectionName] = map[string]bool{}
+		if collection.Type == seed.CollectionTable || collection.Type.Lattice() {
+			dependencies[collectionName][collectionName] = true
+		}
+	}
+	for _, rule := range s.Rules {
+		for _, required := range rule.Requires() {
+			dependencies[rule.Supplies][required] = true
+		}
+	}
+
+	found := map[string]bool{}
+	for collectionName := range s.Collections {
+		// the collections the operation's rules depend on
+		reached := map[string]bool{}
+		pending := []string{}
+		for _, rule := range s.Rules {
+			if rule.Supplies == collectionName && rule.Operation == operation {
+				pending = append(pending, rule.Requires()...)
+			}
+		}
+		for len(pending) > 0 {
+			next := pending[0]
+			pending = pending[1:]
+			if reached[next] {
+				continue
+			}
+			reached[next] = true
+
+			for dependency := range dependencies[next] {
+				pending = append(pending, dependency)
+			}
+		}
+
+		if reached[collectionName] {
+			found[collectionName] = true
+		}
+	}
+
+	return found
+}
+
+// collectionToSouffle writes the clauses deriving a collection from
+// its inserts and updates and, for tables, from the previous time less
+// the deletes and updated keys
+func collectionToSouffle(collectionName string, collection *seed.Collection, derived []string, ignoreDeletes bool, ignoreUpdates bool) string {
+	str := ""
+
+	variables := []string{}
+	for _, column := range columns(collection) {
+		variables = append(variables, identifier(column))
+	}
+	row := strings.Join(append([]string{"T"}, variables...), ", ")
+	previous := strings.Join(append([]string{"P"}, variables...), ", ")
+
+	keys := []string{"T"}
+	for _, column := range collection.Key {
+		keys = append(keys, identifier(column))
+	}
+
+	removed := ""
+	if contains(derived, "_del") && !ignoreDeletes {
+		removed = fmt.Sprintf("%s, !%s_del(%s)", removed, collectionName, row)
+	}
+	if contains(derived, "_upd") {
+		str = fmt.Sprintf("%s%s_ins(%s) :- %s_upd(%s).\n",
+			str, collectionName, row, collectionName, row)
+
+		updated := append([]string{}, keys...)
+		for range collection.Data {
+			updated = append(updated, "_")
+		}
+		str = fmt.Sprintf("%s%s_replaced(%s) :- %s_upd(%s).\n",
+			str, collectionName, strings.Join(keys, ", "), collectionName, strings.Join(updated, ", "))
+
+		if !ignoreUpdates {
+			removed = fmt.Sprintf("%s, !%s_replaced(%s)", removed, collectionName, strings.Join(keys, ", "))
+		}
+	}
+
+	if contains(derived, "_ins") {
+		// inserts take effect after deletes
+		str = fmt.Sprintf("%s%s(%s) :- %s_ins(%s).\n",
+			str, collectionName, row, collectionName, row)
+	}
+
+	if collection.Type == seed.CollectionTable || collection.Type.Lattice() {
+		str = fmt.Sprintf("%s%s(%s) :- %s(%s), T = P + 1, timestep(T)%s.\n",
+			str, collectionName, row, collectionName, previous, removed)
+	}
+
+	return str
+}
+
+// ruleToSouffle writes the clause for a rule
+func ruleToSouffle(s *seed.Seed, rule *seed.Rule) (string, error) {
+	// body
+	time := "T"
+	if rule.Operation != "<=" {
+		time = "P"
+	}
+	body := bodyToSouffle(s, rule, time, nil)
+
+	// variables used outside of reductions
+	grouped := map[string]bool{"T": true, "P": true}
+	for _, expression := range rule.Intension {
+		switch value := expression.(type) {
+		case seed.QualifiedColumn:
+			grouped[variable(value)] = true
+		case seed.MapFunction:
+			for _, qc := range value.Arguments {
+				grouped[variable(qc)] = true
+			}
+		case seed.ReduceFunction:
+			// no-op
+		default:
+			panic(fmt.Sprintf("unhandled type: %v", reflect.TypeOf(expression).String()))
+		}
+	}
+
+	// head
+	head := []string{"T"}
+	for i, expression := range rule.Intension {
+		switch value := expression.(type) {
+		case seed.QualifiedColumn:
+			head = append(head, variable(value))
+		case seed.MapFunction:
+			arguments := []string{}
+			for _, qc := range value.Arguments {
+				arguments = append(arguments, variable(qc))
+			}
+			head = append(head, fmt.Sprintf("@%s(%s)", value.Name, strings.Join(arguments, ", ")))
+		case seed.ReduceFunction:
+			result := fmt.Sprintf("r%d", i)
+			aggregate, err := reduceToSouffle(s, rule, value, time, grouped)
+			if err != nil {
+				return "", err
+			}
+			body = append(body, fmt.Sprintf("%s = %s", result, aggregate))
+			head = append(head, result)
+		default:
+			panic(fmt.Sprintf("unhandled type: %v", reflect.TypeOf(expression).String()))
+		}
+	}
+
+	relation := rule.Supplies
+	if rule.Operation != "<=" {
+		relation += suffix(rule.Operation)
+		body = append(body, "T = P + 1", "timestep(T)")
+	}
+
+	return fmt.Sprintf("%s(%s) :- %s.",
+		relation, strings.Join(head, ", "), strings.Join(body, ", ")), nil
+}
+
+// bodyToSouffle writes the atoms and constraints of a rule's body.
+// Variables which are not grouped are renamed for use in aggregates.
+func bodyToSouffle(s *seed.Seed, rule *seed.Rule, time string, grouped map[string]bool) []string {
+	rename := func(qc seed.QualifiedColumn) string {
+		name := variable(qc)
+		if grouped != nil && !grouped[name] {
+			name += "_"
+		}
+		return name
+	}
+
+	requires := rule.Requires()
+	sort.Strings(requires)
+
+	body := []string{}
+	for _, collectionName := range requires {
+		arguments := []string{time}
+		for _, column := range columns(s.Collections[collectionName]) {
+			arguments = append(arguments, rename(seed.QualifiedColumn{Collection: collectionName, Column: column}))
+		}
+		body = append(body, fmt.Sprintf("%s(%s)", collectionName, strings.Join(arguments, ", ")))
+	}
+
+	for _, constraint := range rule.Predicate {
+		body = append(body, fmt.Sprintf("%s = %s", rename(constraint.Left), rename(constraint.Right)))
+	}
+
+	return body
+}
+
+// reduceToSouffle writes an aggregate over the rule's body for each
+// group
+func reduceToSouffle(s *seed.Seed, rule *seed.Rule, reduction seed.ReduceFunction, time string, grouped map[string]bool) (string, error) {
+	body := strings.Join(bodyToSouffle(s, rule, time, grouped), ", ")
+
+	var argument string
+	if len(reduction.Arguments) > 0 {
+		argument = variable(reduction.Arguments[0])
+		if !grouped[argument] {
+			argument += "_"
+		}
+	}
+
+	switch reduction.Name {
+	case "count":
+		return fmt.Sprintf("to_string(count : { %s })", body), nil
+	case "sum", "min", "max":
+		if argument == "" {
+			return "", fmt.Errorf("%s needs an argument", reduction.Name)
+		}
+		return fmt.Sprintf("to_string(%s to_number(%s) : { %s })", reduction.Name, argument, body), nil
+	default:
+		return "", fmt.Errorf("the reduce function %s has no Soufflé equivalent", reduction.Name)
+	}
+}
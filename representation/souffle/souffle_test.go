@@ -0,0 +1,67 @@
+package souffle
+
+import (
+	"github.com/nathankerr/seed"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestToSouffle(t *testing.T) {
+	type test struct {
+		filename string
+		expected []string
+	}
+
+	tests := []test{
+		test{
+			filename: "../../services/kvs/kvs.seed",
+			expected: []string{
+				"// WARNING: the deletes from kvstate depend on kvstate and cannot be stratified.",
+				".decl kvstate(t:number, key:symbol, value:symbol)",
+				".input kvput",
+				".output kvget_response",
+				"kvstate_replaced(T, key) :- kvstate_upd(T, key, _).",
+				"kvstate(T, key, value) :- kvstate(P, key, value), T = P + 1, timestep(T), !kvstate_replaced(T, key).",
+				"kvstate_upd(T, kvput_key, kvput_value) :- kvput(P, kvput_key, kvput_value), T = P + 1, timestep(T).",
+			},
+		},
+		test{
+			filename: "../../services/price/price.seed",
+			expected: []string{
+				"response_ins(T, request_item, r1) :- request(P, request_item, request_number_of_item), " +
+					"r1 = to_string(sum to_number(request_number_of_item_) : { request(P, request_item, request_number_of_item_) }), " +
+					"T = P + 1, timestep(T).",
+			},
+		},
+		test{
+			filename: "../../services/cart/cart.seed",
+			expected: []string{
+				"// WARNING: rule 1 is left out: the reduce function accumulate_items has no Soufflé equivalent",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		source, err := ioutil.ReadFile(test.filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		service, err := seed.FromSeed(test.filename, source)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		output, err := ToSouffle(service, "test")
+		if err != nil {
+			t.Errorf("%s: %s", test.filename, err)
+		}
+
+		for _, expected := range test.expected {
+			if !strings.Contains(string(output), expected) {
+				t.Errorf("%s: expected to contain\n%s\ngot\n%s", test.filename, expected, output)
+			}
+		}
+	}
+}
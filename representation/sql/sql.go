@@ -0,0 +1,392 @@
+// Package sql exports a seed as a SQLite script running one timestep
+package sql
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/nathankerr/seed"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ToSQL converts a seed into a SQLite script which runs one timestep.
+//
+// Tables are persistent tables and the other collections are temporary
+// tables, each with their key columns as the primary key. To run a
+// timestep, fill the input and channel tables, run the script and read
+// the output tables. Messages sent on channels (<~) are left in
+// <channel>_send.
+//
+// Each run of the script:
+//
+//	empties the output and scratch collections and the sent messages
+//	applies the changes deferred by the previous run: deletes (<-),
+//	    then inserts (<+), then upserts (<+-)
+//	runs the immediate (<=) rules in dependency order
+//	stages the deferred rules into <collection>_delete, _insert and
+//	    _update for the next run
+//	empties the input and channel collections
+//
+// SQLite does not have DELETE ... USING, so deletes are written as
+// DELETE ... WHERE (columns) IN (SELECT ...). Like the go executor,
+// inserts and upserts both replace the data columns of rows with the
+// same key. The standard reduce functions are
+// converted to SQL aggregates; other map and reduce functions must be
+// registered with SQLite as application-defined functions of the same
+// name.
+func ToSQL(s *seed.Seed, name string) ([]byte, error) {
+	buffer := new(bytes.Buffer)
+	fmt.Fprintf(buffer, "-- %s: one timestep\n", name)
+
+	staged := stagedCollections(s)
+	collectionNames := []string{}
+	for collectionName := range s.Collections {
+		collectionNames = append(collectionNames, collectionName)
+	}
+	sort.Strings(collectionNames)
+
+	// collections
+	fmt.Fprintf(buffer, "\n-- collections\n")
+	for _, collectionName := range collectionNames {
+		collection := s.Collections[collectionName]
+		fmt.Fprintf(buffer, "%s\n", createTable(collectionName, collection, true))
+
+		for _, suffix := range staged[collectionName] {
+			fmt.Fprintf(buffer, "%s\n", createTable(collectionName+suffix, collection, false))
+		}
+	}
+
+	// empty the outputs of the previous timestep
+	fmt.Fprintf(buffer, "\n-- empty the outputs of the previous timestep\n")
+	for _, collectionName := range collectionNames {
+		switch s.Collections[collectionName].Type {
+		case seed.CollectionOutput, seed.CollectionScratch:
+			fmt.Fprintf(buffer, "DELETE FROM %s;\n", quote(collectionName))
+		case seed.CollectionChannel:
+			if contains(staged[collectionName], "_send") {
+				fmt.Fprintf(buffer, "DELETE FROM %s;\n", quote(collectionName+"_send"))
+			}
+		case seed.CollectionInput, seed.CollectionTable, seed.CollectionLmax, seed.CollectionLset, seed.CollectionLcounter, seed.CollectionLorset, seed.CollectionLregister:
+			// no-op
+		default:
+			panic(s.Collections[collectionName].Type)
+		}
+	}
+
+	// deferred changes
+	fmt.Fprintf(buffer, "\n-- apply the changes deferred by the previous timestep\n")
+	for _, collectionName := range collectionNames {
+		collection := s.Collections[collectionName]
+		columns := quoteAll(append(append([]string{}, collection.Key...), collection.Data...))
+		table := quote(collectionName)
+
+		for _, suffix := range staged[collectionName] {
+			pending := quote(collectionName + suffix)
+			switch suffix {
+			case "_delete":
+				fmt.Fprintf(buffer, "DELETE FROM %s WHERE (%s) IN (SELECT %s FROM %s);\n",
+					table, strings.Join(columns, ", "), strings.Join(columns, ", "), pending)
+			case "_insert", "_update":
+				fmt.Fprintf(buffer, "%s\n", insert(table, collection,
+					fmt.Sprintf("SELECT %s FROM %s", strings.Join(columns, ", "), pending)))
+			case "_send":
+				// sent by the host
+				continue
+			default:
+				panic(suffix)
+			}
+			fmt.Fprintf(buffer, "DELETE FROM %s;\n", pending)
+		}
+	}
+
+	// immediates
+	fmt.Fprintf(buffer, "\n-- immediate rules\n")
+	ordered, cyclic := immediateOrder(s)
+	if cyclic {
+		fmt.Fprintf(buffer, "-- WARNING: the immediate rules are recursive and are only run once here;\n")
+		fmt.Fprintf(buffer, "-- repeat this section until no rows change to reach the fixpoint\n")
+	}
+	for _, ruleNumber := range ordered {
+		rule := s.Rules[ruleNumber]
+		fmt.Fprintf(buffer, "-- rule %d: %s\n", ruleNumber, rule)
+		fmt.Fprintf(buffer, "%s\n", insert(quote(rule.Supplies), s.Collections[rule.Supplies], selectToSQL(s, rule)))
+	}
+
+	// deferreds
+	fmt.Fprintf(buffer, "\n-- stage the deferred rules for the next timestep\n")
+	for ruleNumber, rule := range s.Rules {
+		if rule.Operation == "<=" {
+			continue
+		}
+
+		fmt.Fprintf(buffer, "-- rule %d: %s\n", ruleNumber, rule)
+		fmt.Fprintf(buffer, "INSERT INTO %s\n  %s;\n",
+			quote(rule.Supplies+stagingSuffix(rule.Operation)), selectToSQL(s, rule))
+	}
+
+	// inputs
+	fmt.Fprintf(buffer, "\n-- empty the inputs of this timestep\n")
+	for _, collectionName := range collectionNames {
+		switch s.Collections[collectionName].Type {
+		case seed.CollectionInput, seed.CollectionChannel:
+			fmt.Fprintf(buffer, "DELETE FROM %s;\n", quote(collectionName))
+		case seed.CollectionOutput, seed.CollectionScratch, seed.CollectionTable, seed.CollectionLmax, seed.CollectionLset, seed.CollectionLcounter, seed.CollectionLorset, seed.CollectionLregister:
+			// no-op
+		default:
+			panic(s.Collections[collectionName].Type)
+		}
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// the staging tables for each deferred operation
+func stagingSuffix(operation string) string {
+	switch operation {
+	case "<-":
+		return "_delete"
+	case "<+":
+		return "_insert"
+	case "<+-":
+		return "_update"
+	case "<~":
+		return "_send"
+	default:
+		panic(operation)
+	}
+}
+
+// stagedCollections lists the staging table suffixes needed by each
+// collection, in the order they are applied
+func stagedCollections(s *seed.Seed) map[string][]string {
+	needed := map[string]map[string]bool{}
+	for _, rule := range s.Rules {
+		if rule.Operation == "<=" {
+			continue
+		}
+
+		if _, ok := needed[rule.Supplies]; !ok {
+			needed[rule.Supplies] = map[string]bool{}
+		}
+		needed[rule.Supplies][stagingSuffix(rule.Operation)] = true
+	}
+
+	staged := map[string][]string{}
+	for collectionName, suffixes := range needed {
+		for _, suffix := range []string{"_delete", "_insert", "_update", "_send"} {
+			if suffixes[suffix] {
+				staged[collectionName] = append(staged[collectionName], suffix)
+			}
+		}
+	}
+
+	return staged
+}
+
+// createTable creates a table with the columns of the collection.
+// Tables for seed tables and lattices persist, all others are
+// temporary. Lattices are not merged.
+func createTable(tableName string, collection *seed.Collection, primaryKey bool) string {
+	temporary := " TEMPORARY"
+	if collection.Type == seed.CollectionTable || collection.Type.Lattice() {
+		temporary = ""
+	}
+
+	columns := quoteAll(append(append([]string{}, collection.Key...), collection.Data...))
+	if primaryKey {
+		key := quoteAll(collection.Key)
+		if len(key) == 0 {
+			key = columns
+		}
+		columns = append(columns, fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(key, ", ")))
+	}
+
+	return fmt.Sprintf("CREATE%s TABLE IF NOT EXISTS %s (%s);",
+		temporary, quote(tableName), strings.Join(columns, ", "))
+}
+
+// insert writes the selected rows into table, replacing the data
+// columns of rows with existing keys. The WHERE clause keeps SQLite from
+// reading ON CONFLICT as the ON of a join.
+func insert(table string, collection *seed.Collection, selection string) string {
+	return fmt.Sprintf("INSERT INTO %s SELECT * FROM (%s) WHERE true\n  %s;",
+		table, selection, onConflict(collection))
+}
+
+// onConflict replaces the data columns of rows with existing keys
+func onConflict(collection *seed.Collection) string {
+	if len(collection.Key) == 0 || len(collection.Data) == 0 {
+		return "ON CONFLICT DO NOTHING"
+	}
+
+	assignments := []string{}
+	for _, column := range quoteAll(collection.Data) {
+		assignments = append(assignments, fmt.Sprintf("%s = excluded.%s", column, column))
+	}
+
+	return fmt.Sprintf("ON CONFLICT (%s) DO UPDATE SET %s",
+		strings.Join(quoteAll(collection.Key), ", "),
+		strings.Join(assignments, ", "))
+}
+
+// immediateOrder orders the immediate rules so that rules supplying a
+// collection run before the rules requiring it. Rules in cycles are
+// kept in seed order after the others.
+func immediateOrder(s *seed.Seed) ([]int, bool) {
+	remaining := []int{}
+	for ruleNumber, rule := range s.Rules {
+		if rule.Operation == "<=" {
+			remaining = append(remaining, ruleNumber)
+		}
+	}
+
+	ordered := []int{}
+	for len(remaining) > 0 {
+		// collections still to be supplied
+		unsupplied := map[string]bool{}
+		for _, ruleNumber := range remaining {
+			unsupplied[s.Rules[ruleNumber].Supplies] = true
+		}
+
+		next := []int{}
+		progress := false
+		for _, ruleNumber := range remaining {
+			ready := true
+			for _, collectionName := range s.Rules[ruleNumber].Requires() {
+				if unsupplied[collectionName] {
+					ready = false
+				}
+			}
+
+			if ready {
+				ordered = append(ordered, ruleNumber)
+				progress = true
+			} else {
+				next = append(next, ruleNumber)
+			}
+		}
+
+		if !progress {
+			return append(ordered, next...), true
+		}
+		remaining = next
+	}
+
+	return ordered, false
+}
+
+// selectToSQL writes the SELECT giving the rule's results
+func selectToSQL(s *seed.Seed, rule *seed.Rule) string {
+	columns := []string{}
+	groups := []string{}
+	reduces := false
+	for _, expression := range rule.Intension {
+		switch value := expression.(type) {
+		case seed.QualifiedColumn, seed.MapFunction:
+			column := expressionToSQL(value)
+			columns = append(columns, column)
+			groups = append(groups, column)
+		case seed.ReduceFunction:
+			columns = append(columns, reduceToSQL(value))
+			reduces = true
+		default:
+			panic(fmt.Sprintf("unhandled type: %v", reflect.TypeOf(expression).String()))
+		}
+	}
+
+	requires := rule.Requires()
+	sort.Strings(requires)
+	tables := quoteAll(requires)
+
+	str := fmt.Sprintf("SELECT DISTINCT %s FROM %s",
+		strings.Join(columns, ", "),
+		strings.Join(tables, ", "))
+
+	if len(rule.Predicate) > 0 {
+		constraints := []string{}
+		for _, constraint := range rule.Predicate {
+			constraints = append(constraints, fmt.Sprintf("%s = %s",
+				expressionToSQL(constraint.Left), expressionToSQL(constraint.Right)))
+		}
+		str = fmt.Sprintf("%s WHERE %s", str, strings.Join(constraints, " AND "))
+	}
+
+	if reduces && len(groups) > 0 {
+		str = fmt.Sprintf("%s GROUP BY %s", str, strings.Join(groups, ", "))
+	}
+
+	return str
+}
+
+func expressionToSQL(expression seed.Expression) string {
+	switch value := expression.(type) {
+	case seed.QualifiedColumn:
+		return fmt.Sprintf("%s.%s", quote(value.Collection), quote(value.Column))
+	case seed.MapFunction:
+		return fmt.Sprintf("%s(%s)", value.Name, strings.Join(argumentsToSQL(value.Arguments), ", "))
+	default:
+		panic(fmt.Sprintf("unhandled type: %v", reflect.TypeOf(expression).String()))
+	}
+}
+
+func argumentsToSQL(arguments []seed.QualifiedColumn) []string {
+	converted := []string{}
+	for _, argument := range arguments {
+		converted = append(converted, expressionToSQL(argument))
+	}
+	return converted
+}
+
+// reduceToSQL uses SQL aggregates for the standard reduce functions.
+// Like the standard reduce functions, only the first argument is
+// aggregated except by collect and distinct.
+func reduceToSQL(reduction seed.ReduceFunction) string {
+	arguments := argumentsToSQL(reduction.Arguments)
+
+	// collect and distinct gather tuples of multiple arguments
+	gathered := ""
+	switch len(arguments) {
+	case 0:
+		gathered = "NULL"
+	case 1:
+		gathered = arguments[0]
+	default:
+		gathered = fmt.Sprintf("json_array(%s)", strings.Join(arguments, ", "))
+	}
+
+	switch reduction.Name {
+	case "count":
+		return "COUNT(*)"
+	case "sum", "min", "max", "avg":
+		return fmt.Sprintf("%s(%s)", strings.ToUpper(reduction.Name), arguments[0])
+	case "collect":
+		return fmt.Sprintf("json_group_array(%s)", gathered)
+	case "distinct":
+		return fmt.Sprintf("json_group_array(DISTINCT %s)", gathered)
+	default:
+		return fmt.Sprintf("%s(%s)", reduction.Name, strings.Join(arguments, ", "))
+	}
+}
+
+// quote quotes identifiers, which may be SQL keywords or contain @
+func quote(identifier string) string {
+	return fmt.Sprintf("\"%s\"", strings.Replace(identifier, "\"", "\"\"", -1))
+}
+
+func quoteAll(identifiers []string) []string {
+	quoted := []string{}
+	for _, identifier := range identifiers {
+		quoted = append(quoted, quote(identifier))
+	}
+	return quoted
+}
+
+func contains(list []string, item string) bool {
+	for _, element := range list {
+		if element == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,185 @@
+package sql
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/nathankerr/seed"
+	executor "github.com/nathankerr/seed/host/golang"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestToSQL(t *testing.T) {
+	type test struct {
+		filename string
+		expected []string
+	}
+
+	tests := []test{
+		test{
+			filename: "../../services/kvs/kvs.seed",
+			expected: []string{
+				`CREATE TABLE IF NOT EXISTS "kvstate" ("key", "value", PRIMARY KEY ("key"));`,
+				`CREATE TEMPORARY TABLE IF NOT EXISTS "kvput" ("key", "value", PRIMARY KEY ("key"));`,
+				`DELETE FROM "kvstate" WHERE ("key", "value") IN (SELECT "key", "value" FROM "kvstate_delete");`,
+				`ON CONFLICT ("key") DO UPDATE SET "value" = excluded."value";`,
+				`INSERT INTO "kvstate_delete"` + "\n" +
+					`  SELECT DISTINCT "kvstate"."key", "kvstate"."value" FROM "kvdel", "kvstate" WHERE "kvdel"."key" = "kvstate"."key";`,
+			},
+		},
+		test{
+			filename: "../../services/price/price.seed",
+			expected: []string{
+				`SELECT DISTINCT "request"."item", SUM("request"."number_of_item") FROM "request" GROUP BY "request"."item";`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		source, err := ioutil.ReadFile(test.filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		service, err := seed.FromSeed(test.filename, source)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		output, err := ToSQL(service, "test")
+		if err != nil {
+			t.Errorf("%s: %s", test.filename, err)
+		}
+
+		for _, expected := range test.expected {
+			if !strings.Contains(string(output), expected) {
+				t.Errorf("%s: expected to contain\n%s\ngot\n%s", test.filename, expected, output)
+			}
+		}
+	}
+}
+
+// TestAgainstExecutor runs a service in sqlite3 and the go executor with
+// the same inputs and compares the tables they end up with. Rewriting a
+// key with <+ replaces its value in both.
+func TestAgainstExecutor(t *testing.T) {
+	sqlite, err := exec.LookPath("sqlite3")
+	if err != nil {
+		t.Skip("sqlite3 is not installed")
+	}
+
+	source := "input put [key] => [value]\n" +
+		"input del [key]\n" +
+		"table kv [key] => [value]\n" +
+		"scratch latest [key] => [value]\n" +
+		"latest <= [put.key, put.value]\n" +
+		"kv <+ [latest.key, latest.value]\n" +
+		"kv <- [kv.key, kv.value]: del.key => kv.key\n"
+	service, err := seed.FromSeed("against", []byte(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the inputs of each timestep
+	timesteps := []map[string][]seed.Tuple{
+		{"put": {{"a", "1"}, {"b", "2"}}},
+		{"put": {{"a", "3"}}, "del": {{"b"}}},
+		{"put": {{"c", "4"}}},
+		{},
+	}
+
+	// sqlite3 applies the deferred changes at the start of the next
+	// timestep, so it runs one more
+	script, err := ToSQL(service, "against")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var stored []seed.Tuple
+	for _, inputs := range append(timesteps, map[string][]seed.Tuple{}) {
+		run := new(strings.Builder)
+		for collectionName, tuples := range inputs {
+			fmt.Fprintf(run, "%s\n", createTable(collectionName, service.Collections[collectionName], true))
+			for _, tuple := range tuples {
+				values := []string{}
+				for _, value := range tuple {
+					values = append(values, fmt.Sprintf("'%s'", value))
+				}
+				fmt.Fprintf(run, "INSERT INTO %s VALUES (%s);\n", quote(collectionName), strings.Join(values, ", "))
+			}
+		}
+		run.Write(script)
+		fmt.Fprintf(run, "SELECT json_group_array(json_array(\"key\", \"value\")) FROM \"kv\";\n")
+
+		command := exec.Command(sqlite, filepath.Join(dir, "against.db"))
+		command.Stdin = strings.NewReader(run.String())
+		output, err := command.CombinedOutput()
+		if err != nil {
+			t.Fatalf("%s: %s", err, output)
+		}
+		stored = nil
+		err = json.Unmarshal(output, &stored)
+		if err != nil {
+			t.Fatalf("%s: %s", err, output)
+		}
+	}
+	sortTuples(stored)
+
+	// each timestep's inputs are sent once the executor has read the
+	// previous ones
+	channels := executor.Execute(service, time.Millisecond, "", true, executor.Options{})
+	deadline := time.After(5 * time.Second)
+	timestep := 0
+	sent, read := false, false
+	var kv []seed.Tuple
+	for {
+		if !sent && timestep < len(timesteps) {
+			for collectionName, tuples := range timesteps[timestep] {
+				channels.Collections[collectionName] <- executor.MessageContainer{
+					Operation:  "<~",
+					Collection: collectionName,
+					Data:       tuples,
+				}
+			}
+			sent = true
+		}
+
+		select {
+		case message := <-channels.Monitor:
+			switch message.Block {
+			case "put", "del":
+				read = read || len(message.Data.([]seed.Tuple)) > 0
+			case "kv":
+				kv = message.Data.([]seed.Tuple)
+				sortTuples(kv)
+				if timestep == len(timesteps) && reflect.DeepEqual(kv, stored) {
+					return
+				}
+			case "_time":
+				if sent && (read || len(timesteps[timestep]) == 0) {
+					timestep++
+					sent, read = false, false
+				}
+			}
+		case <-deadline:
+			t.Fatalf("sqlite3 stored %v, the executor %v", stored, kv)
+		}
+	}
+}
+
+func sortTuples(tuples []seed.Tuple) {
+	sort.Slice(tuples, func(i, j int) bool {
+		return fmt.Sprint(tuples[i]) < fmt.Sprint(tuples[j])
+	})
+}
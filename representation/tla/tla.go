@@ -0,0 +1,619 @@
+// Package tla exports a seed as a TLA+ specification
+package tla
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/nathankerr/seed"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ToTLA converts a seed into a TLA+ specification for model checking
+// with TLC. The module is named after the lowercased name so that it
+// matches the written filename.
+//
+// The nodes running the seed each have their own tables, outputs and
+// rows deferred into other collections by their previous step
+// (<collection>_pending); these variables map each node to its rows.
+// The messages in flight on each channel (<channel>_net, a bag) are
+// shared. Step(n) chooses node n's inputs (any subset of the possible
+// rows) and which of the messages addressed to n are delivered,
+// evaluates the immediate rules in dependency order and then applies
+// the deferred rules: deletes, then inserts and updates. Messages sent
+// on channels (<~) are added to the channel's bag. Messages are
+// addressed by the channel's first @ column; channels without one
+// deliver to any node.
+//
+// Clients send any message on channels no rule sends on (Send_<channel>)
+// and take the messages from channels no rule reads
+// (Receive_<channel>). Next is a step of any node or client.
+//
+// The model has these constants:
+//
+//	Values               the values a column may hold; keep it small
+//	Nodes                the nodes, a subset of Values so that they
+//	                     can be addressed
+//	Initial_<table>      the initial rows of each table on every node
+//	<map function>(...)  an operator for each map function
+//	<reduce function>(_) an operator for each non-standard reduce
+//	                     function, applied to the set of argument tuples
+//
+// Sets do not hold duplicates, so collect and distinct both give the
+// set of arguments. Immediate rules which depend on each other in a
+// cycle cannot be evaluated in order and are reported as an error.
+func ToTLA(s *seed.Seed, name string) ([]byte, error) {
+	buffer := new(bytes.Buffer)
+	moduleName := strings.ToLower(name)
+
+	collectionNames := []string{}
+	for collectionName := range s.Collections {
+		collectionNames = append(collectionNames, collectionName)
+	}
+	sort.Strings(collectionNames)
+
+	ordered, err := immediateOrder(s)
+	if err != nil {
+		return nil, err
+	}
+
+	// collections other than tables keep deferred rows for the next
+	// step, except for messages sent on channels
+	pending := map[string]bool{}
+	for _, rule := range s.Rules {
+		collection := s.Collections[rule.Supplies]
+		switch {
+		case rule.Operation == "<=", collection.Type == seed.CollectionTable, collection.Type.Lattice():
+			// no-op
+		case rule.Operation == "<~" && collection.Type == seed.CollectionChannel:
+			// no-op
+		default:
+			pending[rule.Supplies] = true
+		}
+	}
+
+	// channels used by clients
+	sent := map[string]bool{}
+	read := map[string]bool{}
+	for _, rule := range s.Rules {
+		if rule.Operation == "<~" {
+			sent[rule.Supplies] = true
+		}
+		for _, collectionName := range rule.Requires() {
+			read[collectionName] = true
+		}
+	}
+
+	// variables
+	variables := []string{}
+	for _, collectionName := range collectionNames {
+		switch s.Collections[collectionName].Type {
+		case seed.CollectionTable, seed.CollectionOutput, seed.CollectionLmax, seed.CollectionLset, seed.CollectionLcounter, seed.CollectionLorset, seed.CollectionLregister:
+			// lattices are exported as tables, without merging
+			variables = append(variables, collectionName)
+		case seed.CollectionChannel:
+			variables = append(variables, collectionName+"_net")
+		case seed.CollectionInput, seed.CollectionScratch:
+			// no-op
+		default:
+			panic(s.Collections[collectionName].Type)
+		}
+		if pending[collectionName] {
+			variables = append(variables, collectionName+"_pending")
+		}
+	}
+
+	fmt.Fprintf(buffer, "---- MODULE %s ----\n", moduleName)
+	fmt.Fprintf(buffer, "EXTENDS Naturals, FiniteSets, Bags\n")
+
+	// constants
+	fmt.Fprintf(buffer, "\nCONSTANT Values\n")
+	fmt.Fprintf(buffer, "CONSTANT Nodes\n")
+	for _, collectionName := range collectionNames {
+		if s.Collections[collectionName].Type == seed.CollectionTable || s.Collections[collectionName].Type.Lattice() {
+			fmt.Fprintf(buffer, "CONSTANT Initial_%s\n", collectionName)
+		}
+	}
+	for _, operator := range functionOperators(s) {
+		fmt.Fprintf(buffer, "CONSTANT %s\n", operator)
+	}
+
+	fmt.Fprintf(buffer, "\nVARIABLES %s\n", strings.Join(variables, ", "))
+	fmt.Fprintf(buffer, "vars == <<%s>>\n", strings.Join(variables, ", "))
+
+	// helpers
+	fmt.Fprintf(buffer, "\n\\* sums the second elements of a set of pairs\n")
+	fmt.Fprintf(buffer, "RECURSIVE SumSecond(_)\n")
+	fmt.Fprintf(buffer, "SumSecond(S) == IF S = {} THEN 0\n")
+	fmt.Fprintf(buffer, "                ELSE LET p == CHOOSE q \\in S : TRUE IN p[2] + SumSecond(S \\ {p})\n")
+	fmt.Fprintf(buffer, "Min(S) == CHOOSE x \\in S : \\A y \\in S : x <= y\n")
+	fmt.Fprintf(buffer, "Max(S) == CHOOSE x \\in S : \\A y \\in S : x >= y\n")
+
+	// rows
+	fmt.Fprintf(buffer, "\n")
+	for _, collectionName := range collectionNames {
+		fields := []string{}
+		for _, column := range columns(s.Collections[collectionName]) {
+			fields = append(fields, fmt.Sprintf("%s : Values", column))
+		}
+		fmt.Fprintf(buffer, "Rows_%s == [%s]\n", collectionName, strings.Join(fields, ", "))
+	}
+
+	// init
+	fmt.Fprintf(buffer, "\nInit ==\n")
+	for _, variable := range variables {
+		var initial string
+		switch {
+		case strings.HasSuffix(variable, "_pending"):
+			initial = "{}"
+		case strings.HasSuffix(variable, "_net"):
+			initial = "EmptyBag"
+		case s.Collections[variable].Type == seed.CollectionTable, s.Collections[variable].Type.Lattice():
+			initial = "Initial_" + variable
+		default:
+			initial = "{}"
+		}
+		if !strings.HasSuffix(variable, "_net") {
+			initial = fmt.Sprintf("[n \\in Nodes |-> %s]", initial)
+		}
+		fmt.Fprintf(buffer, "  /\\ %s = %s\n", variable, initial)
+	}
+
+	// step
+	choices := []string{}
+	for _, collectionName := range collectionNames {
+		switch s.Collections[collectionName].Type {
+		case seed.CollectionInput:
+			choices = append(choices, fmt.Sprintf("%s_in \\in SUBSET Rows_%s", collectionName, collectionName))
+		case seed.CollectionChannel:
+			if !read[collectionName] {
+				// taken by clients
+				continue
+			}
+			messages := fmt.Sprintf("BagToSet(%s_net)", collectionName)
+			if address, ok := addressColumn(s.Collections[collectionName]); ok {
+				messages = fmt.Sprintf("{m \\in %s : m.%s = n}", messages, address)
+			}
+			choices = append(choices, fmt.Sprintf("%s_in \\in SUBSET %s", collectionName, messages))
+		}
+	}
+
+	definitions := []string{}
+
+	// the collections at the start of the step
+	for _, collectionName := range collectionNames {
+		sources := []string{}
+		switch s.Collections[collectionName].Type {
+		case seed.CollectionInput:
+			sources = append(sources, collectionName+"_in")
+		case seed.CollectionChannel:
+			if read[collectionName] {
+				sources = append(sources, collectionName+"_in")
+			}
+		case seed.CollectionTable, seed.CollectionLmax, seed.CollectionLset, seed.CollectionLcounter, seed.CollectionLorset, seed.CollectionLregister:
+			sources = append(sources, collectionName+"[n]")
+		case seed.CollectionOutput, seed.CollectionScratch:
+			// no-op
+		}
+		if pending[collectionName] {
+			sources = append(sources, collectionName+"_pending[n]")
+		}
+		if len(sources) == 0 {
+			sources = append(sources, "{}")
+		}
+
+		definitions = append(definitions, fmt.Sprintf("%s_start == %s", collectionName, strings.Join(sources, " \\cup ")))
+	}
+
+	// immediates
+	current := map[string]string{} // collection name: definition of its rows
+	for _, collectionName := range collectionNames {
+		current[collectionName] = collectionName + "_start"
+	}
+	for _, collectionName := range ordered {
+		sources := []string{collectionName + "_start"}
+		for ruleNumber, rule := range s.Rules {
+			if rule.Operation != "<=" || rule.Supplies != collectionName {
+				continue
+			}
+			definitions = append(definitions, fmt.Sprintf("\\* rule %d: %s", ruleNumber, rule))
+			definitions = append(definitions, fmt.Sprintf("rule%d == %s", ruleNumber, ruleToTLA(s, rule, current)))
+			sources = append(sources, fmt.Sprintf("rule%d", ruleNumber))
+		}
+		definitions = append(definitions, fmt.Sprintf("%s_now == %s", collectionName, strings.Join(sources, " \\cup ")))
+		current[collectionName] = collectionName + "_now"
+	}
+
+	// deferreds
+	for ruleNumber, rule := range s.Rules {
+		if rule.Operation == "<=" {
+			continue
+		}
+		definitions = append(definitions, fmt.Sprintf("\\* rule %d: %s", ruleNumber, rule))
+		definitions = append(definitions, fmt.Sprintf("rule%d == %s", ruleNumber, ruleToTLA(s, rule, current)))
+	}
+
+	// next values
+	updates := []string{}
+	for _, variable := range variables {
+		var next string
+		switch {
+		case strings.HasSuffix(variable, "_pending"):
+			collectionName := strings.TrimSuffix(variable, "_pending")
+			next = deferredToTLA(s, collectionName, "{}", "<+", "<+-")
+		case strings.HasSuffix(variable, "_net"):
+			collectionName := strings.TrimSuffix(variable, "_net")
+			messages := []string{}
+			for ruleNumber, rule := range s.Rules {
+				if rule.Supplies == collectionName && rule.Operation == "<~" {
+					messages = append(messages, fmt.Sprintf("SetToBag(rule%d)", ruleNumber))
+				}
+			}
+			next = variable
+			if read[collectionName] {
+				next = fmt.Sprintf("%s (-) SetToBag(%s_in)", variable, collectionName)
+			}
+			if len(messages) > 0 {
+				if read[collectionName] {
+					next = fmt.Sprintf("(%s)", next)
+				}
+				next = fmt.Sprintf("%s (+) %s", next, strings.Join(messages, " (+) "))
+			}
+		case s.Collections[variable].Type == seed.CollectionTable, s.Collections[variable].Type.Lattice():
+			next = deferredToTLA(s, variable, current[variable], "<+", "<+-", "<~")
+		default:
+			next = current[variable]
+		}
+		if !strings.HasSuffix(variable, "_net") {
+			next = fmt.Sprintf("[%s EXCEPT ![n] = %s]", variable, next)
+		}
+		updates = append(updates, fmt.Sprintf("%s' = %s", variable, next))
+	}
+
+	fmt.Fprintf(buffer, "\nStep(n) ==\n")
+	indent := "  "
+	if len(choices) > 0 {
+		fmt.Fprintf(buffer, "  \\E %s :\n", strings.Join(choices, ",\n     "))
+		indent = "    "
+	}
+	fmt.Fprintf(buffer, "%sLET %s\n", indent, strings.Join(definitions, "\n"+indent+"    "))
+	fmt.Fprintf(buffer, "%sIN  /\\ %s\n", indent, strings.Join(updates, "\n"+indent+"    /\\ "))
+
+	// clients
+	actions := []string{"\\E n \\in Nodes : Step(n)"}
+	for _, collectionName := range collectionNames {
+		if s.Collections[collectionName].Type != seed.CollectionChannel {
+			continue
+		}
+		variable := collectionName + "_net"
+		unchanged := []string{}
+		for _, other := range variables {
+			if other != variable {
+				unchanged = append(unchanged, other)
+			}
+		}
+
+		if !sent[collectionName] {
+			fmt.Fprintf(buffer, "\nSend_%s ==\n", collectionName)
+			fmt.Fprintf(buffer, "  \\E m \\in Rows_%s :\n", collectionName)
+			fmt.Fprintf(buffer, "    /\\ %[1]s' = %[1]s (+) SetToBag({m})\n", variable)
+			fmt.Fprintf(buffer, "    /\\ UNCHANGED <<%s>>\n", strings.Join(unchanged, ", "))
+			actions = append(actions, "Send_"+collectionName)
+		}
+		if !read[collectionName] {
+			fmt.Fprintf(buffer, "\nReceive_%s ==\n", collectionName)
+			fmt.Fprintf(buffer, "  \\E m \\in BagToSet(%s) :\n", variable)
+			fmt.Fprintf(buffer, "    /\\ %[1]s' = %[1]s (-) SetToBag({m})\n", variable)
+			fmt.Fprintf(buffer, "    /\\ UNCHANGED <<%s>>\n", strings.Join(unchanged, ", "))
+			actions = append(actions, "Receive_"+collectionName)
+		}
+	}
+
+	fmt.Fprintf(buffer, "\nNext ==\n  \\/ %s\n", strings.Join(actions, "\n  \\/ "))
+	fmt.Fprintf(buffer, "\nSpec == Init /\\ [][Next]_vars\n")
+	fmt.Fprintf(buffer, "====\n")
+
+	return buffer.Bytes(), nil
+}
+
+// columns lists the collection's columns as field names
+func columns(collection *seed.Collection) []string {
+	fields := []string{}
+	for _, column := range append(append([]string{}, collection.Key...), collection.Data...) {
+		fields = append(fields, field(column))
+	}
+	return fields
+}
+
+// addressColumn gives the field of the channel's first @ column
+func addressColumn(collection *seed.Collection) (string, bool) {
+	for _, column := range collection.Key {
+		if strings.HasPrefix(column, "@") {
+			return field(column), true
+		}
+	}
+	return "", false
+}
+
+// field removes the @ from address columns
+func field(column string) string {
+	return strings.Replace(column, "@", "", -1)
+}
+
+// functionOperators declares the map functions and the non-standard
+// reduce functions
+func functionOperators(s *seed.Seed) []string {
+	arities := map[string]int{}
+	for _, rule := range s.Rules {
+		for _, expression := range rule.Intension {
+			switch value := expression.(type) {
+			case seed.QualifiedColumn:
+				// no-op
+			case seed.MapFunction:
+				arities[value.Name] = len(value.Arguments)
+			case seed.ReduceFunction:
+				if !standard[value.Name] {
+					arities[value.Name] = 1
+				}
+			default:
+				panic(fmt.Sprintf("unhandled type: %v", reflect.TypeOf(expression).String()))
+			}
+		}
+	}
+
+	operators := []string{}
+	for name, arity := range arities {
+		parameters := []string{}
+		for i := 0; i < arity; i++ {
+			parameters = append(parameters, "_")
+		}
+		operator := name
+		if arity > 0 {
+			operator = fmt.Sprintf("%s(%s)", name, strings.Join(parameters, ", "))
+		}
+		operators = append(operators, operator)
+	}
+	sort.Strings(operators)
+
+	return operators
+}
+
+// the standard reduce functions
+var standard = map[string]bool{
+	"count":    true,
+	"sum":      true,
+	"min":      true,
+	"max":      true,
+	"avg":      true,
+	"collect":  true,
+	"distinct": true,
+}
+
+// immediateOrder orders the collections supplied by immediate rules so
+// that each comes after the collections it requires
+func immediateOrder(s *seed.Seed) ([]string, error) {
+	dependencies := map[string]map[string]bool{}
+	for _, rule := range s.Rules {
+		if rule.Operation != "<=" {
+			continue
+		}
+		if _, ok := dependencies[rule.Supplies]; !ok {
+			dependencies[rule.Supplies] = map[string]bool{}
+		}
+		for _, required := range rule.Requires() {
+			dependencies[rule.Supplies][required] = true
+		}
+	}
+
+	remaining := []string{}
+	for collectionName := range dependencies {
+		remaining = append(remaining, collectionName)
+	}
+	sort.Strings(remaining)
+
+	ordered := []string{}
+	for len(remaining) > 0 {
+		next := []string{}
+		for _, collectionName := range remaining {
+			ready := true
+			for _, other := range remaining {
+				if dependencies[collectionName][other] {
+					ready = false
+				}
+			}
+
+			if ready {
+				ordered = append(ordered, collectionName)
+			} else {
+				next = append(next, collectionName)
+			}
+		}
+
+		if len(next) == len(remaining) {
+			return nil, errors.New(fmt.Sprint("the immediate rules supplying ", strings.Join(remaining, ", "), " depend on each other"))
+		}
+		remaining = next
+	}
+
+	return ordered, nil
+}
+
+// deferredToTLA gives the rows of a collection after the deferred
+// rules: deletes first, then inserts and updates
+func deferredToTLA(s *seed.Seed, collectionName string, rows string, inserts ...string) string {
+	collection := s.Collections[collectionName]
+	for ruleNumber, rule := range s.Rules {
+		if rule.Supplies != collectionName {
+			continue
+		}
+
+		switch rule.Operation {
+		case "<-":
+			rows = fmt.Sprintf("(%s \\ rule%d)", rows, ruleNumber)
+		case "<+-":
+			// rows with updated keys are replaced
+			conditions := []string{}
+			for _, column := range collection.Key {
+				conditions = append(conditions, fmt.Sprintf("r.%s = u.%s", field(column), field(column)))
+			}
+			if len(conditions) == 0 {
+				conditions = append(conditions, "TRUE")
+			}
+			rows = fmt.Sprintf("{r \\in %s : ~\\E u \\in rule%d : %s}", rows, ruleNumber, strings.Join(conditions, " /\\ "))
+		}
+	}
+
+	sources := []string{}
+	if rows != "{}" {
+		sources = append(sources, rows)
+	}
+	for ruleNumber, rule := range s.Rules {
+		if rule.Supplies != collectionName {
+			continue
+		}
+		for _, operation := range inserts {
+			if rule.Operation == operation {
+				sources = append(sources, fmt.Sprintf("rule%d", ruleNumber))
+			}
+		}
+	}
+	if len(sources) == 0 {
+		return "{}"
+	}
+
+	return strings.Join(sources, " \\cup ")
+}
+
+// ruleToTLA writes the set of rows supplied by the rule. current gives
+// the definition holding each collection's rows.
+func ruleToTLA(s *seed.Seed, rule *seed.Rule, current map[string]string) string {
+	supplies := columns(s.Collections[rule.Supplies])
+
+	requires := rule.Requires()
+	sort.Strings(requires)
+
+	bound := []string{}
+	sets := []string{}
+	for _, collectionName := range requires {
+		bound = append(bound, "x_"+collectionName)
+		sets = append(sets, current[collectionName])
+	}
+
+	binder := bound[0]
+	set := sets[0]
+	if len(bound) > 1 {
+		binder = fmt.Sprintf("<<%s>>", strings.Join(bound, ", "))
+		set = strings.Join(sets, " \\X ")
+	}
+
+	conditions := []string{}
+	for _, constraint := range rule.Predicate {
+		conditions = append(conditions, fmt.Sprintf("%s = %s",
+			qualifiedColumnToTLA(constraint.Left), qualifiedColumnToTLA(constraint.Right)))
+	}
+	if len(conditions) > 0 {
+		set = fmt.Sprintf("{%s \\in %s : %s}", binder, set, strings.Join(conditions, " /\\ "))
+	}
+
+	reduces := false
+	groups := []string{}
+	for _, expression := range rule.Intension {
+		switch value := expression.(type) {
+		case seed.QualifiedColumn, seed.MapFunction:
+			groups = append(groups, expressionToTLA(value))
+		case seed.ReduceFunction:
+			reduces = true
+		default:
+			panic(fmt.Sprintf("unhandled type: %v", reflect.TypeOf(expression).String()))
+		}
+	}
+
+	if !reduces {
+		fields := []string{}
+		for i, expression := range rule.Intension {
+			fields = append(fields, fmt.Sprintf("%s |-> %s", supplies[i], expressionToTLA(expression)))
+		}
+		return fmt.Sprintf("{[%s] : %s \\in %s}", strings.Join(fields, ", "), binder, set)
+	}
+
+	// reductions are over the rows in each group, g
+	group := fmt.Sprintf("<<%s>>", strings.Join(groups, ", "))
+	members := fmt.Sprintf("{%s \\in rows : %s = g}", binder, group)
+
+	fields := []string{}
+	groupNumber := 0
+	for i, expression := range rule.Intension {
+		switch value := expression.(type) {
+		case seed.QualifiedColumn, seed.MapFunction:
+			groupNumber++
+			fields = append(fields, fmt.Sprintf("%s |-> g[%d]", supplies[i], groupNumber))
+		case seed.ReduceFunction:
+			fields = append(fields, fmt.Sprintf("%s |-> %s", supplies[i], reduceToTLA(value, binder, members)))
+		}
+	}
+
+	return fmt.Sprintf("LET rows == %s IN {[%s] : g \\in {%s : %s \\in rows}}",
+		set, strings.Join(fields, ", "), group, binder)
+}
+
+func qualifiedColumnToTLA(qc seed.QualifiedColumn) string {
+	return fmt.Sprintf("x_%s.%s", qc.Collection, field(qc.Column))
+}
+
+func expressionToTLA(expression seed.Expression) string {
+	switch value := expression.(type) {
+	case seed.QualifiedColumn:
+		return qualifiedColumnToTLA(value)
+	case seed.MapFunction:
+		arguments := []string{}
+		for _, qc := range value.Arguments {
+			arguments = append(arguments, qualifiedColumnToTLA(qc))
+		}
+		if len(arguments) == 0 {
+			return value.Name
+		}
+		return fmt.Sprintf("%s(%s)", value.Name, strings.Join(arguments, ", "))
+	default:
+		panic(fmt.Sprintf("unhandled type: %v", reflect.TypeOf(expression).String()))
+	}
+}
+
+// reduceToTLA reduces the rows in members. Like the standard reduce
+// functions, only the first argument is used except by collect and
+// distinct.
+func reduceToTLA(reduction seed.ReduceFunction, binder string, members string) string {
+	arguments := []string{}
+	for _, qc := range reduction.Arguments {
+		arguments = append(arguments, qualifiedColumnToTLA(qc))
+	}
+
+	first := "0"
+	if len(arguments) > 0 {
+		first = arguments[0]
+	}
+
+	gathered := fmt.Sprintf("<<%s>>", strings.Join(arguments, ", "))
+	if len(arguments) == 1 {
+		gathered = arguments[0]
+	}
+
+	switch reduction.Name {
+	case "count":
+		return fmt.Sprintf("Cardinality(%s)", members)
+	case "sum":
+		// pairs with the rows keep equal values from merging
+		return fmt.Sprintf("SumSecond({<<%s, %s>> : %s \\in %s})", binder, first, binder, members)
+	case "avg":
+		return fmt.Sprintf("SumSecond({<<%s, %s>> : %s \\in %s}) \\div Cardinality(%s)", binder, first, binder, members, members)
+	case "min":
+		return fmt.Sprintf("Min({%s : %s \\in %s})", first, binder, members)
+	case "max":
+		return fmt.Sprintf("Max({%s : %s \\in %s})", first, binder, members)
+	case "collect", "distinct":
+		return fmt.Sprintf("{%s : %s \\in %s}", gathered, binder, members)
+	default:
+		return fmt.Sprintf("%s({<<%s>> : %s \\in %s})", reduction.Name, strings.Join(arguments, ", "), binder, members)
+	}
+}
@@ -0,0 +1,112 @@
+package tla
+
+import (
+	"github.com/nathankerr/seed"
+	"github.com/nathankerr/seed/transformation/network"
+	"github.com/nathankerr/seed/transformation/replicate"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestToTLA(t *testing.T) {
+	type test struct {
+		filename string
+		expected []string
+	}
+
+	tests := []test{
+		test{
+			filename: "../../services/kvs/kvs.seed",
+			expected: []string{
+				"---- MODULE test ----",
+				"VARIABLES kvget_response, kvget_response_pending, kvstate",
+				"  \\E kvdel_in \\in SUBSET Rows_kvdel,",
+				"        /\\ kvget_response_pending' = [kvget_response_pending EXCEPT ![n] = rule2]",
+				"        /\\ kvstate' = [kvstate EXCEPT ![n] = ({r \\in kvstate_start : ~\\E u \\in rule0 : r.key = u.key} \\ rule1) \\cup rule0]",
+				"  /\\ kvstate = [n \\in Nodes |-> Initial_kvstate]",
+				"        kvstate_start == kvstate[n]",
+			},
+		},
+		test{
+			filename: "../../services/cart/cart.seed",
+			expected: []string{
+				"CONSTANT accumulate_items(_)",
+				"rule1 == LET rows == {<<x_checkout, x_log>> \\in checkout_start \\X log_start : x_checkout.cart = x_log.cart} IN " +
+					"{[cart |-> g[1], items |-> accumulate_items({<<x_log.item, x_log.num>> : <<x_checkout, x_log>> \\in " +
+					"{<<x_checkout, x_log>> \\in rows : <<x_checkout.cart>> = g}})] : g \\in {<<x_checkout.cart>> : <<x_checkout, x_log>> \\in rows}}",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		source, err := ioutil.ReadFile(test.filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		service, err := seed.FromSeed(test.filename, source)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		output, err := ToTLA(service, "test")
+		if err != nil {
+			t.Errorf("%s: %s", test.filename, err)
+		}
+
+		for _, expected := range test.expected {
+			if !strings.Contains(string(output), expected) {
+				t.Errorf("%s: expected to contain\n%s\ngot\n%s", test.filename, expected, output)
+			}
+		}
+	}
+}
+
+func TestReplicatedToTLA(t *testing.T) {
+	source, err := ioutil.ReadFile("../../services/kvs/kvs.seed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service, err := seed.FromSeed("kvs", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service, err = network.Transform(service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service, err = replicate.Transform(service)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := ToTLA(service, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"CONSTANT Nodes\n",
+		// clients send requests and take responses
+		"Send_kvput ==\n  \\E m \\in Rows_kvput :\n    /\\ kvput_net' = kvput_net (+) SetToBag({m})\n",
+		"Receive_kvget_response ==\n  \\E m \\in BagToSet(kvget_response_net) :\n    /\\ kvget_response_net' = kvget_response_net (-) SetToBag({m})\n",
+		// nodes receive the messages addressed to them
+		"kvput_in \\in SUBSET {m \\in BagToSet(kvput_net) : m.address = n}",
+		"kvstate_update_channel_in \\in SUBSET {m \\in BagToSet(kvstate_update_channel_net) : m.address = n}",
+		"/\\ kvput_net' = kvput_net (-) SetToBag(kvput_in)\n",
+		"/\\ kvget_response_net' = kvget_response_net (+) SetToBag(rule2)\n",
+		"/\\ kvstate_replicants' = [kvstate_replicants EXCEPT ![n] = kvstate_replicants_start]\n",
+		"Next ==\n  \\/ \\E n \\in Nodes : Step(n)\n",
+		"  \\/ Send_kvput\n",
+	}
+	for _, expected := range expected {
+		if !strings.Contains(string(output), expected) {
+			t.Errorf("expected to contain\n%s\ngot\n%s", expected, output)
+		}
+	}
+	if strings.Contains(string(output), "kvget_response_in") {
+		t.Errorf("nodes should not receive kvget_response\n%s", output)
+	}
+}
@@ -11,6 +11,7 @@ type yyinterface interface{}
 
 type yystype struct {
 	collectionType CollectionType
+	host           bool
 	string         string
 	strings        []string
 	expression     Expression
@@ -145,6 +146,7 @@ func (p *yyParser) Init() {
 
 			p.Collections[n.string] = &Collection{
 				Type: t.collectionType,
+				Host: t.host,
 				Key:  k.strings,
 				Data: d.strings,
 			}
@@ -156,37 +158,65 @@ func (p *yyParser) Init() {
 		},
 		/* 2 CollectionType */
 		func(yytext string, _ int) {
-			yy.collectionType = CollectionInput
+			yy.host = false
 		},
 		/* 3 CollectionType */
 		func(yytext string, _ int) {
-			yy.collectionType = CollectionOutput
+			yy.host = true
 		},
 		/* 4 CollectionType */
 		func(yytext string, _ int) {
-			yy.collectionType = CollectionTable
+			yy.collectionType = CollectionInput
 		},
 		/* 5 CollectionType */
 		func(yytext string, _ int) {
-			yy.collectionType = CollectionChannel
+			yy.collectionType = CollectionOutput
 		},
 		/* 6 CollectionType */
+		func(yytext string, _ int) {
+			yy.collectionType = CollectionTable
+		},
+		/* 7 CollectionType */
+		func(yytext string, _ int) {
+			yy.collectionType = CollectionChannel
+		},
+		/* 8 CollectionType */
 		func(yytext string, _ int) {
 			yy.collectionType = CollectionScratch
 		},
-		/* 7 IdentifierArray */
+		/* 9 CollectionType */
+		func(yytext string, _ int) {
+			yy.collectionType = CollectionLmax
+		},
+		/* 10 CollectionType */
+		func(yytext string, _ int) {
+			yy.collectionType = CollectionLset
+		},
+		/* 11 CollectionType */
+		func(yytext string, _ int) {
+			yy.collectionType = CollectionLcounter
+		},
+		/* 12 CollectionType */
+		func(yytext string, _ int) {
+			yy.collectionType = CollectionLorset
+		},
+		/* 13 CollectionType */
+		func(yytext string, _ int) {
+			yy.collectionType = CollectionLregister
+		},
+		/* 14 IdentifierArray */
 		func(yytext string, _ int) {
 			yy.strings = []string{}
 		},
-		/* 8 IdentifierArray */
+		/* 15 IdentifierArray */
 		func(yytext string, _ int) {
 			yy.strings = append(yy.strings, yytext)
 		},
-		/* 9 IdentifierArray */
+		/* 16 IdentifierArray */
 		func(yytext string, _ int) {
 			yy.strings = append(yy.strings, yytext)
 		},
-		/* 10 Rule */
+		/* 17 Rule */
 		func(yytext string, _ int) {
 			c := yyval[yyp-1]
 			o := yyval[yyp-2]
@@ -201,7 +231,7 @@ func (p *yyParser) Init() {
 			yyval[yyp-3] = proj
 			yyval[yyp-4] = pred
 		},
-		/* 11 Rule */
+		/* 18 Rule */
 		func(yytext string, _ int) {
 			c := yyval[yyp-1]
 			o := yyval[yyp-2]
@@ -220,29 +250,29 @@ func (p *yyParser) Init() {
 			yyval[yyp-3] = proj
 			yyval[yyp-4] = pred
 		},
-		/* 12 Operation */
+		/* 19 Operation */
 		func(yytext string, _ int) {
 			yy.string = yytext
 		},
-		/* 13 Intension */
+		/* 20 Intension */
 		func(yytext string, _ int) {
 			e := yyval[yyp-1]
 			yy.expressions = []Expression{}
 			yyval[yyp-1] = e
 		},
-		/* 14 Intension */
+		/* 21 Intension */
 		func(yytext string, _ int) {
 			e := yyval[yyp-1]
 			yy.expressions = append(yy.expressions, e.expression)
 			yyval[yyp-1] = e
 		},
-		/* 15 Intension */
+		/* 22 Intension */
 		func(yytext string, _ int) {
 			e := yyval[yyp-1]
 			yy.expressions = append(yy.expressions, e.expression)
 			yyval[yyp-1] = e
 		},
-		/* 16 QualifiedColumn */
+		/* 23 QualifiedColumn */
 		func(yytext string, _ int) {
 			collection := yyval[yyp-1]
 			column := yyval[yyp-2]
@@ -253,7 +283,7 @@ func (p *yyParser) Init() {
 			yyval[yyp-1] = collection
 			yyval[yyp-2] = column
 		},
-		/* 17 MapFunction */
+		/* 24 MapFunction */
 		func(yytext string, _ int) {
 			n := yyval[yyp-1]
 			c := yyval[yyp-2]
@@ -261,7 +291,7 @@ func (p *yyParser) Init() {
 			yyval[yyp-1] = n
 			yyval[yyp-2] = c
 		},
-		/* 18 MapFunction */
+		/* 25 MapFunction */
 		func(yytext string, _ int) {
 			c := yyval[yyp-2]
 			n := yyval[yyp-1]
@@ -269,7 +299,7 @@ func (p *yyParser) Init() {
 			yyval[yyp-1] = n
 			yyval[yyp-2] = c
 		},
-		/* 19 MapFunction */
+		/* 26 MapFunction */
 		func(yytext string, _ int) {
 			n := yyval[yyp-1]
 			c := yyval[yyp-2]
@@ -277,7 +307,7 @@ func (p *yyParser) Init() {
 			yyval[yyp-1] = n
 			yyval[yyp-2] = c
 		},
-		/* 20 MapFunction */
+		/* 27 MapFunction */
 		func(yytext string, _ int) {
 			c := yyval[yyp-2]
 			n := yyval[yyp-1]
@@ -285,7 +315,7 @@ func (p *yyParser) Init() {
 			yyval[yyp-1] = n
 			yyval[yyp-2] = c
 		},
-		/* 21 ReduceFunction */
+		/* 28 ReduceFunction */
 		func(yytext string, _ int) {
 			n := yyval[yyp-1]
 			c := yyval[yyp-2]
@@ -293,7 +323,7 @@ func (p *yyParser) Init() {
 			yyval[yyp-1] = n
 			yyval[yyp-2] = c
 		},
-		/* 22 ReduceFunction */
+		/* 29 ReduceFunction */
 		func(yytext string, _ int) {
 			c := yyval[yyp-2]
 			n := yyval[yyp-1]
@@ -301,7 +331,7 @@ func (p *yyParser) Init() {
 			yyval[yyp-1] = n
 			yyval[yyp-2] = c
 		},
-		/* 23 ReduceFunction */
+		/* 30 ReduceFunction */
 		func(yytext string, _ int) {
 			n := yyval[yyp-1]
 			c := yyval[yyp-2]
@@ -309,7 +339,7 @@ func (p *yyParser) Init() {
 			yyval[yyp-2] = c
 			yyval[yyp-1] = n
 		},
-		/* 24 ReduceFunction */
+		/* 31 ReduceFunction */
 		func(yytext string, _ int) {
 			n := yyval[yyp-1]
 			c := yyval[yyp-2]
@@ -317,25 +347,25 @@ func (p *yyParser) Init() {
 			yyval[yyp-1] = n
 			yyval[yyp-2] = c
 		},
-		/* 25 Predicate */
+		/* 32 Predicate */
 		func(yytext string, _ int) {
 			c := yyval[yyp-1]
 			yy.constraints = []Constraint{}
 			yyval[yyp-1] = c
 		},
-		/* 26 Predicate */
+		/* 33 Predicate */
 		func(yytext string, _ int) {
 			c := yyval[yyp-1]
 			yy.constraints = append(yy.constraints, c.constraint)
 			yyval[yyp-1] = c
 		},
-		/* 27 Predicate */
+		/* 34 Predicate */
 		func(yytext string, _ int) {
 			c := yyval[yyp-1]
 			yy.constraints = append(yy.constraints, c.constraint)
 			yyval[yyp-1] = c
 		},
-		/* 28 Constraint */
+		/* 35 Constraint */
 		func(yytext string, _ int) {
 			l := yyval[yyp-1]
 			r := yyval[yyp-2]
@@ -346,7 +376,7 @@ func (p *yyParser) Init() {
 			yyval[yyp-1] = l
 			yyval[yyp-2] = r
 		},
-		/* 29 Identifier */
+		/* 36 Identifier */
 		func(yytext string, _ int) {
 			yy.string = yytext
 		},
@@ -370,7 +400,7 @@ func (p *yyParser) Init() {
 		},
 	}
 	const (
-		yyPush = 30 + iota
+		yyPush = 37 + iota
 		yyPop
 		yySet
 	)
@@ -579,6 +609,7 @@ func (p *yyParser) Init() {
 		/* 3 Collection <- (CollectionType Spaces* Identifier Spaces* IdentifierArray { d.strings = []string{} } (Spaces* '=>' Spaces* IdentifierArray)? Spaces* {
 			p.Collections[n.string] = &Collection{
 				Type: t.collectionType,
+				Host: t.host,
 				Key: k.strings,
 				Data: d.strings,
 			}
@@ -671,43 +702,103 @@ func (p *yyParser) Init() {
 			position, thunkPosition = position0, thunkPosition0
 			return
 		},
-		/* 4 CollectionType <- (('input' { yy.collectionType = CollectionInput }) / ('output' { yy.collectionType = CollectionOutput }) / ('table' { yy.collectionType = CollectionTable }) / ('channel' { yy.collectionType = CollectionChannel }) / ('scratch' { yy.collectionType = CollectionScratch })) */
+		/* 4 CollectionType <- ({ yy.host = false } ('host' Spaces+ { yy.host = true })? (('input' { yy.collectionType = CollectionInput }) / ('output' { yy.collectionType = CollectionOutput }) / ('table' { yy.collectionType = CollectionTable }) / ('channel' { yy.collectionType = CollectionChannel }) / ('scratch' { yy.collectionType = CollectionScratch }) / ('lmax' { yy.collectionType = CollectionLmax }) / ('lset' { yy.collectionType = CollectionLset }) / ('lcounter' { yy.collectionType = CollectionLcounter }) / ('lorset' { yy.collectionType = CollectionLorset }) / ('lregister' { yy.collectionType = CollectionLregister }))) */
 		func() (match bool) {
 			position0, thunkPosition0 := position, thunkPosition
+			do(2)
+			{
+				position1, thunkPosition1 := position, thunkPosition
+				if !matchString("host") {
+					goto ko1
+				}
+				if !p.rules[ruleSpaces]() {
+					goto ko1
+				}
+			loop:
+				{
+					position2, thunkPosition2 := position, thunkPosition
+					if !p.rules[ruleSpaces]() {
+						goto out
+					}
+					goto loop
+				out:
+					position, thunkPosition = position2, thunkPosition2
+				}
+				do(3)
+				goto ok1
+			ko1:
+				position, thunkPosition = position1, thunkPosition1
+			}
+		ok1:
 			{
 				position1, thunkPosition1 := position, thunkPosition
 				if !matchString("input") {
 					goto nextAlt
 				}
-				do(2)
+				do(4)
 				goto ok
 			nextAlt:
 				position, thunkPosition = position1, thunkPosition1
 				if !matchString("output") {
 					goto nextAlt3
 				}
-				do(3)
+				do(5)
 				goto ok
 			nextAlt3:
 				position, thunkPosition = position1, thunkPosition1
 				if !matchString("table") {
 					goto nextAlt4
 				}
-				do(4)
+				do(6)
 				goto ok
 			nextAlt4:
 				position, thunkPosition = position1, thunkPosition1
 				if !matchString("channel") {
 					goto nextAlt5
 				}
-				do(5)
+				do(7)
 				goto ok
 			nextAlt5:
 				position, thunkPosition = position1, thunkPosition1
 				if !matchString("scratch") {
+					goto nextAlt6
+				}
+				do(8)
+				goto ok
+			nextAlt6:
+				position, thunkPosition = position1, thunkPosition1
+				if !matchString("lmax") {
+					goto nextAlt7
+				}
+				do(9)
+				goto ok
+			nextAlt7:
+				position, thunkPosition = position1, thunkPosition1
+				if !matchString("lset") {
+					goto nextAlt8
+				}
+				do(10)
+				goto ok
+			nextAlt8:
+				position, thunkPosition = position1, thunkPosition1
+				if !matchString("lcounter") {
+					goto nextAlt9
+				}
+				do(11)
+				goto ok
+			nextAlt9:
+				position, thunkPosition = position1, thunkPosition1
+				if !matchString("lorset") {
+					goto nextAlt10
+				}
+				do(12)
+				goto ok
+			nextAlt10:
+				position, thunkPosition = position1, thunkPosition1
+				if !matchString("lregister") {
 					goto ko
 				}
-				do(6)
+				do(13)
 			}
 		ok:
 			match = true
@@ -722,7 +813,7 @@ func (p *yyParser) Init() {
 			if !matchChar('[') {
 				goto ko
 			}
-			do(7)
+			do(14)
 		loop:
 			{
 				position1, thunkPosition1 := position, thunkPosition
@@ -736,7 +827,7 @@ func (p *yyParser) Init() {
 			if !p.rules[ruleIdentifier]() {
 				goto ko
 			}
-			do(8)
+			do(15)
 		loop3:
 			{
 				position2, thunkPosition2 := position, thunkPosition
@@ -766,7 +857,7 @@ func (p *yyParser) Init() {
 				if !p.rules[ruleIdentifier]() {
 					goto out6
 				}
-				do(9)
+				do(16)
 			loop9:
 				{
 					position5, thunkPosition5 := position, thunkPosition
@@ -804,7 +895,7 @@ func (p *yyParser) Init() {
 		func() (match bool) {
 			position0, thunkPosition0 := position, thunkPosition
 			doarg(yyPush, 4)
-			do(10)
+			do(17)
 			if !p.rules[ruleIdentifier]() {
 				goto ko
 			}
@@ -871,7 +962,7 @@ func (p *yyParser) Init() {
 			out10:
 				position, thunkPosition = position5, thunkPosition5
 			}
-			do(11)
+			do(18)
 			doarg(yyPop, 4)
 			match = true
 			return
@@ -915,7 +1006,7 @@ func (p *yyParser) Init() {
 			}
 		ok:
 			end = position
-			do(12)
+			do(19)
 			match = true
 			return
 		ko:
@@ -929,7 +1020,7 @@ func (p *yyParser) Init() {
 			if !matchChar('[') {
 				goto ko
 			}
-			do(13)
+			do(20)
 		loop:
 			{
 				position1, thunkPosition1 := position, thunkPosition
@@ -944,7 +1035,7 @@ func (p *yyParser) Init() {
 				goto ko
 			}
 			doarg(yySet, -1)
-			do(14)
+			do(21)
 		loop3:
 			{
 				position2, thunkPosition2 := position, thunkPosition
@@ -965,7 +1056,7 @@ func (p *yyParser) Init() {
 					goto out4
 				}
 				doarg(yySet, -1)
-				do(15)
+				do(22)
 				goto loop3
 			out4:
 				position, thunkPosition = position2, thunkPosition2
@@ -1036,7 +1127,7 @@ func (p *yyParser) Init() {
 				goto ko
 			}
 			doarg(yySet, -2)
-			do(16)
+			do(23)
 			doarg(yyPop, 2)
 			match = true
 			return
@@ -1065,7 +1156,7 @@ func (p *yyParser) Init() {
 				goto ko
 			}
 			doarg(yySet, -1)
-			do(17)
+			do(24)
 		loop3:
 			{
 				position2, thunkPosition2 := position, thunkPosition
@@ -1080,7 +1171,7 @@ func (p *yyParser) Init() {
 				goto ko
 			}
 			doarg(yySet, -2)
-			do(18)
+			do(25)
 		loop5:
 			{
 				position3, thunkPosition3 := position, thunkPosition
@@ -1098,7 +1189,7 @@ func (p *yyParser) Init() {
 					goto out8
 				}
 				doarg(yySet, -2)
-				do(19)
+				do(26)
 			loop9:
 				{
 					position5, thunkPosition5 := position, thunkPosition
@@ -1126,7 +1217,7 @@ func (p *yyParser) Init() {
 			out12:
 				position, thunkPosition = position6, thunkPosition6
 			}
-			do(20)
+			do(27)
 			doarg(yyPop, 2)
 			match = true
 			return
@@ -1155,7 +1246,7 @@ func (p *yyParser) Init() {
 				goto ko
 			}
 			doarg(yySet, -1)
-			do(21)
+			do(28)
 		loop3:
 			{
 				position2, thunkPosition2 := position, thunkPosition
@@ -1170,7 +1261,7 @@ func (p *yyParser) Init() {
 				goto ko
 			}
 			doarg(yySet, -2)
-			do(22)
+			do(29)
 		loop5:
 			{
 				position3, thunkPosition3 := position, thunkPosition
@@ -1188,7 +1279,7 @@ func (p *yyParser) Init() {
 					goto out8
 				}
 				doarg(yySet, -2)
-				do(23)
+				do(30)
 			loop9:
 				{
 					position5, thunkPosition5 := position, thunkPosition
@@ -1216,7 +1307,7 @@ func (p *yyParser) Init() {
 			out12:
 				position, thunkPosition = position6, thunkPosition6
 			}
-			do(24)
+			do(31)
 			doarg(yyPop, 2)
 			match = true
 			return
@@ -1228,12 +1319,12 @@ func (p *yyParser) Init() {
 		func() (match bool) {
 			position0, thunkPosition0 := position, thunkPosition
 			doarg(yyPush, 1)
-			do(25)
+			do(32)
 			if !p.rules[ruleConstraint]() {
 				goto ko
 			}
 			doarg(yySet, -1)
-			do(26)
+			do(33)
 		loop:
 			{
 				position1, thunkPosition1 := position, thunkPosition
@@ -1264,7 +1355,7 @@ func (p *yyParser) Init() {
 					goto out4
 				}
 				doarg(yySet, -1)
-				do(27)
+				do(34)
 			loop7:
 				{
 					position4, thunkPosition4 := position, thunkPosition
@@ -1324,7 +1415,7 @@ func (p *yyParser) Init() {
 				goto ko
 			}
 			doarg(yySet, -2)
-			do(28)
+			do(35)
 			doarg(yyPop, 2)
 			match = true
 			return
@@ -1353,7 +1444,7 @@ func (p *yyParser) Init() {
 				position, thunkPosition = position1, thunkPosition1
 			}
 			end = position
-			do(29)
+			do(36)
 			match = true
 			return
 		ko:
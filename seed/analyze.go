@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/nathankerr/seed/representation/opennet"
+	"github.com/nathankerr/seed/transformation/network"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// analyze runs the analyses selected by its options on a seed and
+// prints their reports
+func analyze(args []string) {
+	flags := flag.NewFlagSet("analyze", flag.ExitOnError)
+	var from_format = flags.String("f", "seed",
+		"format to load (seed, json, dedalus, bloom)")
+	var transformations = flags.String("transformations", "",
+		"transformations to perform before analysis, separated by spaces (network replicate")
+	var opennetAnalysis = flags.Bool("opennet", false,
+		"analyze the seed as an open net: boundedness, dead transitions, deadlocks and output reachability")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n  %s analyze ", os.Args[0])
+		fmt.Fprintf(os.Stderr, "[options] [input filename]\nOptions:\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 || !*opennetAnalysis {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	service, err := load(filepath.Clean(flags.Arg(0)), *from_format)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	for _, transformation := range strings.Fields(*transformations) {
+		service, err = transform(service, transformation, network.Options{})
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	if *opennetAnalysis {
+		report, err := opennet.SeedAsOpenNet(service).Analyze(service.Name)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		os.Stdout.Write(report)
+	}
+}
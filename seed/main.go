@@ -16,8 +16,17 @@ import (
 	"github.com/nathankerr/seed/representation/dot"
 	"github.com/nathankerr/seed/representation/graph"
 	"github.com/nathankerr/seed/representation/opennet"
+	"github.com/nathankerr/seed/representation/souffle"
+	"github.com/nathankerr/seed/representation/sql"
+	"github.com/nathankerr/seed/representation/tla"
+	"github.com/nathankerr/seed/transformation/causal"
+	"github.com/nathankerr/seed/transformation/membership"
 	"github.com/nathankerr/seed/transformation/network"
+	"github.com/nathankerr/seed/transformation/primary"
+	"github.com/nathankerr/seed/transformation/quorum"
+	"github.com/nathankerr/seed/transformation/reliable"
 	"github.com/nathankerr/seed/transformation/replicate"
+	"github.com/nathankerr/seed/transformation/shard"
 	"io/ioutil"
 	"log"
 	"os"
@@ -29,14 +38,23 @@ import (
 func main() {
 	log.SetFlags(log.Lshortfile)
 
+	if len(os.Args) > 1 && os.Args[1] == "analyze" {
+		analyze(os.Args[2:])
+		return
+	}
+
 	var outputdir = flag.String("o", "build",
 		"directory name to create and output the bud source")
 	var from_format = flag.String("f", "seed",
-		"format to load (seed, json)")
+		"format to load (seed, json, dedalus, bloom)")
 	var to_format = flag.String("t", "",
-		"formats to write separated by spaces (bloom, dot, go, json, seed, graph, fieldgraph, owfn, opennet)")
+		"formats to write separated by spaces (bloom, bud, dot, svg, go, json, seed, graph, fieldgraph, mermaid, fieldmermaid, plantuml, fieldplantuml, owfn, opennet, sql, souffle, tla, jsonschema, openapi, goclient, jsclient)")
 	var transformations = flag.String("transformations", "",
-		"transformations to perform, separated by spaces (network replicate")
+		"transformations to perform, separated by spaces (network replicate replicate-quorum primary-backup shard reliable membership causal)")
+	var requestID = flag.String("request-id", "",
+		"column the network transformation threads from inputs to outputs to identify requests; empty means none")
+	var replyTo = flag.String("reply-to", "",
+		"output=input pairs, separated by spaces, naming whose senders the network transformation replies to when several inputs only reach an output through tables")
 	var execute = flag.Bool("execute", false,
 		"execute the seed")
 	var sleep = flag.String("sleep", "",
@@ -49,9 +67,15 @@ func main() {
 		"address the monitor uses; empty means it will not run")
 	var traceFilename = flag.String("trace", "",
 		"filename to dump a trace to; empty means it will not run")
+	var functionErrors = flag.String("function-errors", "drop",
+		"what happens to rows whose map or reduce functions fail (drop, report)")
+	var functionErrorCollection = flag.String("function-error-collection", "",
+		"collection receiving an error tuple for each failed row when function errors are reported")
+	var clock = flag.String("clock", "1s",
+		"how often host inputs receive the time: a duration, or a number of timesteps")
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage:\n  %s ", os.Args[0])
-		fmt.Fprintf(os.Stderr, "[options] [input filename]\nOptions:\n")
+		fmt.Fprintf(os.Stderr, "[options] [input filename]\n  %s analyze [options] [input filename]\nOptions:\n", os.Args[0])
 		flag.PrintDefaults()
 	}
 	flag.Parse()
@@ -70,8 +94,16 @@ func main() {
 	}
 
 	log.Println("Transform")
+	networkOptions := network.Options{RequestID: *requestID, ReplyTo: map[string]string{}}
+	for _, pair := range strings.Fields(*replyTo) {
+		names := strings.SplitN(pair, "=", 2)
+		if len(names) != 2 {
+			log.Fatalln("reply-to needs output=input pairs, got", pair)
+		}
+		networkOptions.ReplyTo[names[0]] = names[1]
+	}
 	for _, transformation := range strings.Fields(*transformations) {
-		service, err = transform(service, transformation)
+		service, err = transform(service, transformation, networkOptions)
 		if err != nil {
 			log.Fatalln(err)
 		}
@@ -82,7 +114,20 @@ func main() {
 
 	if *execute {
 		log.Println("Executing")
-		err = start(service, *sleep, *address, *monitorAddress, *traceFilename, *communicator)
+		err = service.BindFunctions()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		options := executor.Options{FunctionErrorCollection: *functionErrorCollection}
+		options.FunctionErrors, err = executor.ParseFunctionErrorPolicy(*functionErrors)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		options.Clock, err = executor.ParseClock(*clock)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		err = start(service, *sleep, *address, *monitorAddress, *traceFilename, *communicator, options)
 		if err != nil {
 			log.Fatalln(err)
 		}
@@ -104,6 +149,10 @@ func load(filename, format string) (*seed.Seed, error) {
 		service, err = seed.FromSeed(filename, source)
 	case "json":
 		service, err = seed.FromJSON(filename, source)
+	case "dedalus":
+		service, err = dedalus.DedalusFileToSeed(filename, source)
+	case "bloom":
+		service, err = bloom.FromBloom(filename, source)
 	default:
 		return nil, errors.New(fmt.Sprint("Loading from", format, "format not supported."))
 	}
@@ -129,6 +178,17 @@ func write(service *seed.Seed, name string, formats string, outputdir string) {
 	}
 
 	for _, format := range strings.Fields(formats) {
+		// formats written as directories
+		switch format {
+		case "bud":
+			files, err := bloom.ToBudProject(service, name)
+			if err != nil {
+				log.Fatalln("Error while converting to", format, ":", err)
+			}
+			writeDirectory(filepath.Join(outputdir, strings.ToLower(name)+"_bud"), files)
+			continue
+		}
+
 		var extension string
 		var writer func(service *seed.Seed, name string) ([]byte, error)
 		switch format {
@@ -138,6 +198,9 @@ func write(service *seed.Seed, name string, formats string, outputdir string) {
 		case "dot":
 			extension = "dot"
 			writer = dot.ToDot
+		case "svg":
+			extension = "svg"
+			writer = dot.ToSVG
 		case "go":
 			extension = "go"
 			writer = golang.ToGo
@@ -153,6 +216,18 @@ func write(service *seed.Seed, name string, formats string, outputdir string) {
 		case "fieldgraph":
 			extension = "fieldgraph.dot"
 			writer = graph.ToFieldGraph
+		case "mermaid":
+			extension = "mmd"
+			writer = graph.ToMermaid
+		case "fieldmermaid":
+			extension = "field.mmd"
+			writer = graph.ToFieldMermaid
+		case "plantuml":
+			extension = "puml"
+			writer = graph.ToPlantUML
+		case "fieldplantuml":
+			extension = "field.puml"
+			writer = graph.ToFieldPlantUML
 		case "owfn":
 			extension = "owfn"
 			writer = opennet.SeedToOWFN
@@ -162,6 +237,27 @@ func write(service *seed.Seed, name string, formats string, outputdir string) {
 		case "dedalus":
 			extension = "dedalus"
 			writer = dedalus.SeedToDedalusFile
+		case "sql":
+			extension = "sql"
+			writer = sql.ToSQL
+		case "souffle":
+			extension = "dl"
+			writer = souffle.ToSouffle
+		case "tla":
+			extension = "tla"
+			writer = tla.ToTLA
+		case "jsonschema":
+			extension = "schema.json"
+			writer = wsjson.ToJSONSchema
+		case "openapi":
+			extension = "openapi.json"
+			writer = wsjson.ToOpenAPI
+		case "goclient":
+			extension = "client.go"
+			writer = wsjson.ToGoClient
+		case "jsclient":
+			extension = "client.js"
+			writer = wsjson.ToJSClient
 		default:
 			log.Fatalln("Writing to", format, "format not supported.\n")
 		}
@@ -186,13 +282,39 @@ func write(service *seed.Seed, name string, formats string, outputdir string) {
 	}
 }
 
-func transform(service *seed.Seed, transformation string) (*seed.Seed, error) {
+func writeDirectory(dirname string, files map[string][]byte) {
+	err := os.MkdirAll(dirname, 0755)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	for filename, contents := range files {
+		err = ioutil.WriteFile(filepath.Join(dirname, filename), contents, 0644)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+}
+
+func transform(service *seed.Seed, transformation string, networkOptions network.Options) (*seed.Seed, error) {
 	var transform func(service *seed.Seed) (*seed.Seed, error)
 	switch transformation {
 	case "network":
-		transform = network.Transform
+		transform = networkOptions.Transform
 	case "replicate":
 		transform = replicate.Transform
+	case "primary-backup":
+		transform = primary.Transform
+	case "shard":
+		transform = shard.Transform
+	case "replicate-quorum":
+		transform = quorum.Transform
+	case "reliable":
+		transform = reliable.Transform
+	case "membership":
+		transform = membership.Transform
+	case "causal":
+		transform = causal.Transform
 	default:
 		return nil, errors.New(transformation + " not supported.")
 	}
@@ -205,7 +327,7 @@ func transform(service *seed.Seed, transformation string) (*seed.Seed, error) {
 	return transformed, nil
 }
 
-func start(service *seed.Seed, sleep, address, monitorAddress, traceFilename, communicator string) error {
+func start(service *seed.Seed, sleep, address, monitorAddress, traceFilename, communicator string, options executor.Options) error {
 	var err error
 	var sleepDuration time.Duration
 	if sleep != "" {
@@ -224,7 +346,7 @@ func start(service *seed.Seed, sleep, address, monitorAddress, traceFilename, co
 		log.Fatalln("cannot use both the web-based monitoring and tracing")
 	}
 
-	channels := executor.Execute(service, sleepDuration, address, useMonitor)
+	channels := executor.Execute(service, sleepDuration, address, useMonitor, options)
 
 	if monitorAddress != "" {
 		go monitor.StartMonitor(monitorAddress, channels, service)
@@ -0,0 +1,125 @@
+package seed
+
+import (
+	"testing"
+)
+
+func TestHostInput(t *testing.T) {
+	source := []byte(`host input tick [now]
+input hosts [name]
+table seen [name] => [at]
+
+seen <+- [hosts.name, tick.now]
+`)
+
+	s, err := FromSeed("hosted", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Collections["tick"].Host || s.Collections["hosts"].Host {
+		t.Errorf("expected only tick to be a host input: %s", s)
+	}
+	if len(s.Rules) != 1 {
+		t.Fatalf("expected 1 rule, got %d", len(s.Rules))
+	}
+
+	err = s.Validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// host inputs survive writing and reading
+	written, err := ToSeed(s, "hosted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err = FromSeed("hosted", written)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Collections["tick"].Host {
+		t.Errorf("tick is no longer a host input:\n%s", written)
+	}
+
+	// host inputs only have the time
+	s.Collections["tick"].Key = []string{"now", "zone"}
+	if s.Validate() == nil {
+		t.Error("expected an error for a host input with two columns")
+	}
+	s.Collections["tick"].Key = []string{"now"}
+	s.Collections["tick"].Type = CollectionTable
+	if s.Validate() == nil {
+		t.Error("expected an error for a host table")
+	}
+}
+
+func TestLattices(t *testing.T) {
+	source := []byte(`input visit [page, visitor] => [at]
+lmax latest [page] => [at]
+lset visitors [page] => [visitor]
+lcounter hits [page] => [counts]
+lorset carts [session] => [items]
+lregister status [page] => [message]
+
+latest <= [visit.page, visit.at]
+visitors <+ [visit.page, visit.visitor]
+carts <- [carts.session, carts.items]: visit.page => carts.session
+`)
+
+	s, err := FromSeed("lattices", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]CollectionType{
+		"latest":   CollectionLmax,
+		"visitors": CollectionLset,
+		"hits":     CollectionLcounter,
+		"carts":    CollectionLorset,
+		"status":   CollectionLregister,
+	}
+	for name, collectionType := range expected {
+		if s.Collections[name].Type != collectionType {
+			t.Errorf("%s should be %s, not %s", name, collectionType, s.Collections[name].Type)
+		}
+	}
+
+	err = s.Validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// lattice types survive writing and reading
+	written, err := ToSeed(s, "lattices")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reread, err := FromSeed("lattices", written)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := ToJSON(reread, "lattices")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := FromJSON("lattices", encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, collectionType := range expected {
+		if decoded.Collections[name].Type != collectionType {
+			t.Errorf("%s is no longer a %s:\n%s", name, collectionType, encoded)
+		}
+	}
+
+	// lattices are only merged into, except or-sets, which <- merges
+	// tombstones into
+	s.Rules[0].Operation = "<+-"
+	if s.Validate() == nil {
+		t.Error("expected an error for overwriting a lattice")
+	}
+	s.Rules[0].Operation = "<-"
+	if s.Validate() == nil {
+		t.Error("expected an error for deleting from an lmax")
+	}
+}
@@ -0,0 +1,225 @@
+package seed
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// The standard reduce functions are available to every Seed. They
+// handle values as decoded from both JSON (float64, string) and
+// msgpack (sized integers, []byte).
+func init() {
+	RegisterReduce("count", count)
+	RegisterReduce("sum", sum)
+	RegisterReduce("min", minimum)
+	RegisterReduce("max", maximum)
+	RegisterReduce("avg", avg)
+	RegisterReduce("collect", collect)
+	RegisterReduce("distinct", distinct)
+}
+
+// count returns the number of tuples
+func count(input []Tuple) Element {
+	return len(input)
+}
+
+// sum adds the first column of each tuple. The result is an int64
+// when every value is an integer, otherwise a float64.
+func sum(input []Tuple) Element {
+	var intSum int64
+	var floatSum float64
+	allInts := true
+
+	for _, tuple := range input {
+		i, f, isInt := number(tuple[0])
+		intSum += i
+		floatSum += f
+		if !isInt {
+			allInts = false
+		}
+	}
+
+	if allInts {
+		return intSum
+	}
+	return floatSum
+}
+
+// minimum returns the smallest first column
+func minimum(input []Tuple) Element {
+	return extreme(input, -1)
+}
+
+// maximum returns the largest first column
+func maximum(input []Tuple) Element {
+	return extreme(input, 1)
+}
+
+// extreme returns the first column which compares in the direction
+// of sign to all the others
+func extreme(input []Tuple, sign int) Element {
+	var result Element
+	for i, tuple := range input {
+		if i == 0 {
+			result = tuple[0]
+			continue
+		}
+
+		comparison, err := Compare(tuple[0], result)
+		if err != nil {
+			panic(err)
+		}
+		if comparison*sign > 0 {
+			result = tuple[0]
+		}
+	}
+
+	return result
+}
+
+// avg returns the mean of the first columns as a float64
+func avg(input []Tuple) Element {
+	if len(input) == 0 {
+		return 0.0
+	}
+
+	var total float64
+	for _, tuple := range input {
+		_, f, _ := number(tuple[0])
+		total += f
+	}
+
+	return total / float64(len(input))
+}
+
+// collect gathers the arguments of each tuple into a list. Single
+// arguments are gathered directly, otherwise the argument tuples are.
+func collect(input []Tuple) Element {
+	collected := []Element{}
+	for _, tuple := range input {
+		collected = append(collected, arguments(tuple))
+	}
+	return collected
+}
+
+// distinct is collect without repeated values
+func distinct(input []Tuple) Element {
+	seen := map[string]bool{}
+	collected := []Element{}
+	for _, tuple := range input {
+		element := arguments(tuple)
+
+		id, err := json.Marshal(normalize(element))
+		if err != nil {
+			panic(err)
+		}
+		if seen[string(id)] {
+			continue
+		}
+		seen[string(id)] = true
+
+		collected = append(collected, element)
+	}
+	return collected
+}
+
+func arguments(tuple Tuple) Element {
+	if len(tuple) == 1 {
+		return tuple[0]
+	}
+	return tuple
+}
+
+// Compare returns < 0 if a < b, 0 if a == b and > 0 if a > b.
+// Numbers are compared by value, strings and []byte lexically and
+// false is less than true. An error is returned when the values
+// cannot be compared.
+func Compare(a Element, b Element) (int, error) {
+	a = normalize(a)
+	b = normalize(b)
+
+	if isNumber(a) && isNumber(b) {
+		ai, af, aIsInt := number(a)
+		bi, bf, bIsInt := number(b)
+		switch {
+		case aIsInt && bIsInt && ai < bi, !(aIsInt && bIsInt) && af < bf:
+			return -1, nil
+		case aIsInt && bIsInt && ai > bi, !(aIsInt && bIsInt) && af > bf:
+			return 1, nil
+		default:
+			return 0, nil
+		}
+	}
+
+	switch a := a.(type) {
+	case string:
+		if b, ok := b.(string); ok {
+			switch {
+			case a < b:
+				return -1, nil
+			case a > b:
+				return 1, nil
+			default:
+				return 0, nil
+			}
+		}
+	case bool:
+		if b, ok := b.(bool); ok {
+			switch {
+			case a == b:
+				return 0, nil
+			case b:
+				return -1, nil
+			default:
+				return 1, nil
+			}
+		}
+	}
+
+	return 0, fmt.Errorf("cannot compare %#v and %#v", a, b)
+}
+
+// normalize converts msgpack's []byte strings to strings
+func normalize(element Element) Element {
+	switch typed := element.(type) {
+	case []byte:
+		return string(typed)
+	case Tuple:
+		return normalize([]interface{}(typed))
+	case []interface{}:
+		normalized := Tuple{}
+		for _, e := range typed {
+			normalized = append(normalized, normalize(e))
+		}
+		return normalized
+	default:
+		return element
+	}
+}
+
+func isNumber(element Element) bool {
+	switch reflect.ValueOf(element).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// number returns the element as both an int64 and a float64, and
+// whether the element was an integer. Non-numbers panic.
+func number(element Element) (int64, float64, bool) {
+	value := reflect.ValueOf(element)
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int(), float64(value.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(value.Uint()), float64(value.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return int64(value.Float()), value.Float(), false
+	default:
+		panic(fmt.Sprintf("not a number: %#v", element))
+	}
+}
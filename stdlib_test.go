@@ -0,0 +1,72 @@
+package seed
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStandardReduceFunctions(t *testing.T) {
+	type test struct {
+		function string
+		input    []Tuple
+		expected Element
+	}
+
+	tests := []test{
+		// json decoded
+		{"count", []Tuple{{1.0}, {2.0}}, 2},
+		{"sum", []Tuple{{1.0}, {2.5}}, 3.5},
+		{"min", []Tuple{{"b"}, {"a"}, {"c"}}, "a"},
+		{"max", []Tuple{{1.0}, {3.0}, {2.0}}, 3.0},
+		{"avg", []Tuple{{1.0}, {2.0}}, 1.5},
+		{"collect", []Tuple{{"a"}, {"a"}}, []Element{"a", "a"}},
+		{"distinct", []Tuple{{"a", 1.0}, {"a", 1.0}}, []Element{Tuple{"a", 1.0}}},
+
+		// msgpack decoded
+		{"sum", []Tuple{{int8(1)}, {int16(2)}}, int64(3)},
+		{"min", []Tuple{{[]byte("b")}, {[]byte("a")}}, []byte("a")},
+		{"max", []Tuple{{int8(1)}, {uint8(3)}}, uint8(3)},
+		{"distinct", []Tuple{{[]byte("a")}, {"a"}}, []Element{[]byte("a")}},
+	}
+
+	for _, test := range tests {
+		function, ok := reduceFunctions[test.function]
+		if !ok {
+			t.Fatalf("%s is not registered", test.function)
+		}
+
+		result := function(test.input)
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("%s(%v): expected %#v, got %#v", test.function, test.input, test.expected, result)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	type test struct {
+		a, b     Element
+		expected int
+	}
+
+	tests := []test{
+		{1.0, int8(2), -1},
+		{uint64(2), 2.0, 0},
+		{"b", []byte("a"), 1},
+		{false, true, -1},
+	}
+
+	for _, test := range tests {
+		result, err := Compare(test.a, test.b)
+		if err != nil {
+			t.Errorf("Compare(%#v, %#v): %v", test.a, test.b, err)
+		}
+		if result != test.expected {
+			t.Errorf("Compare(%#v, %#v): expected %d, got %d", test.a, test.b, test.expected, result)
+		}
+	}
+
+	_, err := Compare("a", 1.0)
+	if err == nil {
+		t.Error("expected an error comparing a string and a number")
+	}
+}
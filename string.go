@@ -41,6 +41,16 @@ func (c *Collection) String(cname string) string {
 		ctype = "channel"
 	case CollectionScratch:
 		ctype = "scratch"
+	case CollectionLmax:
+		ctype = "lmax"
+	case CollectionLset:
+		ctype = "lset"
+	case CollectionLcounter:
+		ctype = "lcounter"
+	case CollectionLorset:
+		ctype = "lorset"
+	case CollectionLregister:
+		ctype = "lregister"
 	default:
 		// shouldn't get here
 		panic(c.Type)
@@ -58,6 +68,10 @@ func (c *Collection) String(cname string) string {
 			strings.Join(c.Data, ", "))
 	}
 
+	if c.Host {
+		ctype = "host " + ctype
+	}
+
 	return fmt.Sprintf("%s %s %s %s",
 		ctype,
 		cname,
@@ -78,6 +92,16 @@ func (ctype CollectionType) String() string {
 		return "channel"
 	case CollectionScratch:
 		return "scratch"
+	case CollectionLmax:
+		return "lmax"
+	case CollectionLset:
+		return "lset"
+	case CollectionLcounter:
+		return "lcounter"
+	case CollectionLorset:
+		return "lorset"
+	case CollectionLregister:
+		return "lregister"
 	default:
 		// shouldn't get here
 		panic(fmt.Sprintf("%#v", ctype))
@@ -0,0 +1,373 @@
+// Package causal adds causal consistency, using vector clocks, to the
+// replicated tables of a Seed
+package causal
+
+import (
+	"fmt"
+	"github.com/nathankerr/seed"
+	"github.com/nathankerr/seed/transformation/internal/construct"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Transform makes clients of tables replicated by the replicate
+// transformation see their own writes, and those they have seen, at
+// every replica.
+//
+// The table causal_replica [address] => [clock], holding this
+// replica's address and its vector clock, {} at first, must be filled
+// in when each replica starts.
+//
+// The clock counts the batches of writes, one per timestep, made by
+// each replica and applied by this one. The rows of the replicated
+// tables get a column with the clock of the batch which wrote them, and
+// the replication channels carry the sender and the clock of the
+// batch. Writes from other replicas wait in <channel>_inbox until the
+// writes they depend on have been applied.
+//
+// The inputs get two columns: a token, the clock the client has seen
+// ("" when it has seen nothing), and the address to send the clock to
+// once the request is handled, on causal_token [@client] => [token].
+// Requests wait in <input>_pending until the replica's clock covers
+// their token. The outputs get a column with the replica's clock.
+// Clients merge the clocks they receive into their token by taking the
+// largest count for each replica.
+//
+// Run it after the network and replicate transformations.
+func Transform(orig *seed.Seed) (*seed.Seed, error) {
+	for _, name := range []string{replica, stamps, next, token} {
+		if _, ok := orig.Collections[name]; ok {
+			return nil, fmt.Errorf("%s is used by the transformation", name)
+		}
+	}
+
+	c := &causal{
+		orig: orig,
+		s: &seed.Seed{
+			Name:        orig.Name,
+			Collections: make(map[string]*seed.Collection),
+		},
+		clocks:      map[string]string{},
+		renamed:     map[string]map[string]string{},
+		readFrom:    map[string]string{},
+		replication: map[string]string{},
+		writes:      map[string]bool{},
+		outputs:     map[string]bool{},
+	}
+
+	supplied := map[string]bool{}
+	for _, rule := range orig.Rules {
+		supplied[rule.Supplies] = true
+	}
+
+	// the replicated tables, the channels between their replicas, and
+	// the scratches holding this replica's writes to them
+	tables := []string{}
+	for collectionName, collection := range orig.Collections {
+		c.s.Collections[collectionName] = collection
+		if collection.Type != seed.CollectionTable {
+			continue
+		}
+		if _, ok := orig.Collections[collectionName+"_replicants"]; !ok {
+			continue
+		}
+		tables = append(tables, collectionName)
+		for _, operation := range []string{"insert", "delete", "update"} {
+			writes := fmt.Sprintf("%s_%s", collectionName, operation)
+			if _, ok := orig.Collections[writes]; ok {
+				c.writes[writes] = true
+			}
+			if _, ok := orig.Collections[writes+"_channel"]; ok {
+				c.replication[writes+"_channel"] = collectionName
+			}
+		}
+	}
+	if len(tables) == 0 {
+		return nil, fmt.Errorf("there are no replicated tables; run the replicate transformation first")
+	}
+	sort.Strings(tables)
+
+	// the channels to and from the clients
+	inputs := []string{}
+	for collectionName, collection := range orig.Collections {
+		if collection.Type != seed.CollectionChannel {
+			continue
+		}
+		if _, ok := c.replication[collectionName]; ok {
+			continue
+		}
+		if lattice, ok := orig.Collections[strings.TrimSuffix(collectionName, "_merge_channel")]; ok && lattice.Type.Lattice() {
+			// lattices converge without clocks
+			continue
+		}
+		if supplied[collectionName] {
+			c.outputs[collectionName] = true
+			construct.Add(c.s, collectionName, collection.Type, collection.Key,
+				append(append([]string{}, collection.Data...), construct.Unique("token", construct.Columns(collection))))
+		} else {
+			inputs = append(inputs, collectionName)
+		}
+	}
+	sort.Strings(inputs)
+
+	construct.Add(c.s, replica, seed.CollectionTable, []string{"address"}, []string{"clock"})
+	construct.Add(c.s, stamps, seed.CollectionScratch, []string{"clock"}, nil)
+	construct.Add(c.s, next, seed.CollectionScratch, []string{"address"}, []string{"clock"})
+	construct.Add(c.s, token, seed.CollectionChannel, []string{"@client"}, []string{"token"})
+
+	// the clock after this timestep covers the current one, the batch
+	// written in it, and the batches delivered in it
+	construct.Rule(c.s, stamps, "<=", []seed.Expression{construct.QC(replica, "clock")})
+	construct.Rule(c.s, next, "<=", []seed.Expression{construct.QC(replica, "address"),
+		seed.ReduceFunction{Name: "causal_merge", Arguments: []seed.QualifiedColumn{construct.QC(stamps, "clock")}}})
+	construct.Rule(c.s, replica, "<+-", []seed.Expression{construct.QC(next, "address"), construct.QC(next, "clock")})
+
+	// this replica's writes tick its clock
+	writes := []string{}
+	for collectionName := range c.writes {
+		writes = append(writes, collectionName)
+	}
+	sort.Strings(writes)
+	for _, collectionName := range writes {
+		construct.Rule(c.s, stamps, "<=", []seed.Expression{seed.MapFunction{
+			Name:      "causal_tick",
+			Arguments: []seed.QualifiedColumn{construct.QC(replica, "clock"), construct.QC(replica, "address"), construct.QC(collectionName, construct.Columns(orig.Collections[collectionName])[0])},
+		}})
+	}
+
+	for _, tableName := range tables {
+		c.stamp(tableName)
+	}
+	channelNames := []string{}
+	for channelName := range c.replication {
+		channelNames = append(channelNames, channelName)
+	}
+	sort.Strings(channelNames)
+	for _, channelName := range channelNames {
+		c.deliver(channelName)
+	}
+	for _, inputName := range inputs {
+		c.hold(inputName)
+	}
+
+	for _, rule := range orig.Rules {
+		rewritten, err := c.rewrite(rule)
+		if err != nil {
+			return nil, err
+		}
+		c.s.Rules = append(c.s.Rules, rewritten)
+	}
+
+	return c.s, nil
+}
+
+// The collections added by Transform
+const (
+	replica = "causal_replica"
+	stamps  = "causal_stamps"
+	next    = "causal_next"
+	token   = "causal_token"
+)
+
+type causal struct {
+	orig        *seed.Seed
+	s           *seed.Seed
+	clocks      map[string]string            // table or channel: clock column
+	renamed     map[string]map[string]string // channel: column: column without the address marker
+	readFrom    map[string]string            // channel: collection its rules read from instead
+	replication map[string]string            // channel: replicated table
+	writes      map[string]bool              // scratches of this replica's writes
+	outputs     map[string]bool              // channels to the clients
+}
+
+// stamp adds the clock column to a replicated table
+func (c *causal) stamp(tableName string) {
+	table := c.orig.Collections[tableName]
+	clockColumn := construct.Unique("clock", construct.Columns(table))
+	c.clocks[tableName] = clockColumn
+	construct.Add(c.s, tableName, table.Type, table.Key, append(append([]string{}, table.Data...), clockColumn))
+}
+
+// deliver adds the sender and clock columns to a replication channel
+// and delays the writes it carries until they can be applied
+func (c *causal) deliver(channelName string) {
+	channel := c.orig.Collections[channelName]
+	sender := construct.Unique("sender", construct.Columns(channel))
+	clockColumn := construct.Unique("clock", append(construct.Columns(channel), sender))
+	c.clocks[channelName] = clockColumn
+	construct.Add(c.s, channelName, channel.Type, channel.Key, append(append([]string{}, channel.Data...), sender, clockColumn))
+
+	// writes sent to other replicas are also kept in the sending
+	// channel, so only those addressed to this replica have arrived
+	address, _ := channel.AddressColumn()
+	filter := construct.Constraint(channelName, channel.Key[address], replica, "address")
+	delivered := c.wait(channelName, clockColumn, []seed.Constraint{filter}, "inbox", "deliverable", "early", "delivered", sender)
+	construct.Rule(c.s, stamps, "<=", []seed.Expression{construct.QC(delivered, clockColumn)})
+}
+
+// hold adds the token and client columns to an input and delays the
+// requests until the replica's clock covers their token
+func (c *causal) hold(inputName string) {
+	input := c.orig.Collections[inputName]
+	tokenColumn := construct.Unique("token", construct.Columns(input))
+	client := construct.Unique("client", append(construct.Columns(input), tokenColumn))
+	construct.Add(c.s, inputName, input.Type, input.Key, append(append([]string{}, input.Data...), tokenColumn, client))
+
+	ready := c.wait(inputName, tokenColumn, nil, "pending", "covered", "behind", "ready")
+
+	// tell the client the clock it has now seen
+	construct.Rule(c.s, token, "<~", []seed.Expression{construct.QC(ready, client), construct.QC(next, "clock")})
+}
+
+// wait adds the collections and rules holding the rows of a channel in
+// <channel>_<held> until the map function causal_<can>, given the
+// replica's clock, the row's clockColumn and its extra columns, says
+// they can be used. The rows which can be used are put in
+// <channel>_<usable>, which the rules reading the channel read instead.
+func (c *causal) wait(channelName, clockColumn string, filter []seed.Constraint, held, can, cannot, usable string, extra ...string) string {
+	channel := c.s.Collections[channelName]
+	channelColumns := construct.Columns(channel)
+
+	// the address markers are only allowed in channels
+	renamed := map[string]string{}
+	plain := []string{}
+	for _, column := range channelColumns {
+		renamed[column] = strings.TrimPrefix(column, "@")
+		plain = append(plain, renamed[column])
+	}
+	c.renamed[channelName] = renamed
+
+	waiting := channelName + "_waiting"
+	heldName := channelName + "_" + held
+	canName := channelName + "_" + can
+	cannotName := channelName + "_" + cannot
+	usableName := channelName + "_" + usable
+	c.readFrom[channelName] = usableName
+
+	// rows with the same key but different clocks are kept apart
+	for _, name := range []string{waiting, canName, cannotName, usableName} {
+		construct.Add(c.s, name, seed.CollectionScratch, plain, nil)
+	}
+	construct.Add(c.s, heldName, seed.CollectionTable, plain, nil)
+
+	// the rows which arrived and those held from before
+	construct.Rule(c.s, waiting, "<=", construct.ColumnsOf(channelName, channelColumns), filter...)
+	construct.Rule(c.s, waiting, "<=", construct.ColumnsOf(heldName, plain))
+
+	// check whether each row can be used
+	for _, name := range []string{canName, cannotName} {
+		function := "causal_" + strings.TrimPrefix(name, channelName+"_")
+		intension := []seed.Expression{}
+		for _, column := range plain {
+			if column == clockColumn {
+				arguments := []seed.QualifiedColumn{construct.QC(replica, "clock"), construct.QC(waiting, clockColumn)}
+				for _, column := range extra {
+					arguments = append(arguments, construct.QC(waiting, column))
+				}
+				intension = append(intension, seed.MapFunction{Name: function, Arguments: arguments})
+			} else {
+				intension = append(intension, construct.QC(waiting, column))
+			}
+		}
+		construct.Rule(c.s, name, "<=", intension)
+	}
+
+	// the checks are nil for the rows they do not hold for, which the
+	// joins drop
+	matching := func(left, right string) []seed.Constraint {
+		constraints := []seed.Constraint{}
+		for _, column := range plain {
+			constraints = append(constraints, construct.Constraint(left, column, right, column))
+		}
+		return constraints
+	}
+	construct.Rule(c.s, usableName, "<=", construct.ColumnsOf(waiting, plain), matching(waiting, canName)...)
+	construct.Rule(c.s, heldName, "<+", construct.ColumnsOf(waiting, plain), matching(waiting, cannotName)...)
+	construct.Rule(c.s, heldName, "<-", construct.ColumnsOf(heldName, plain), matching(heldName, canName)...)
+
+	return usableName
+}
+
+// rewrite returns a rule reading the usable rows of the held channels
+// and adding the clock columns
+func (c *causal) rewrite(rule *seed.Rule) (*seed.Rule, error) {
+	rewritten := &seed.Rule{
+		Supplies:  rule.Supplies,
+		Operation: rule.Operation,
+	}
+
+	for _, expression := range rule.Intension {
+		switch value := expression.(type) {
+		case seed.QualifiedColumn:
+			expression = c.rename(value)
+		case seed.MapFunction:
+			value.Arguments = c.renameAll(value.Arguments)
+			expression = value
+		case seed.ReduceFunction:
+			value.Arguments = c.renameAll(value.Arguments)
+			expression = value
+		default:
+			panic(fmt.Sprintf("unhandled type: %v", reflect.TypeOf(expression).String()))
+		}
+		rewritten.Intension = append(rewritten.Intension, expression)
+	}
+	for _, constraint := range rule.Predicate {
+		rewritten.Predicate = append(rewritten.Predicate, seed.Constraint{
+			Left:  c.rename(constraint.Left),
+			Right: c.rename(constraint.Right),
+		})
+	}
+
+	switch {
+	case c.replication[rule.Supplies] != "":
+		// writes sent to the other replicas
+		rewritten.Intension = append(rewritten.Intension, construct.QC(replica, "address"), construct.QC(next, "clock"))
+	case c.clocks[rule.Supplies] != "" && rule.Operation == "<-":
+		// rows are deleted from replicated tables by key, whatever their clock
+		tableName := rule.Supplies
+		table := c.s.Collections[tableName]
+		requires := rule.Requires()
+		if len(requires) != 1 {
+			return nil, fmt.Errorf("%s deletes from %s using more than one collection", rule, tableName)
+		}
+		from := c.rename(construct.QC(requires[0], "")).Collection
+		rewritten.Intension = construct.ColumnsOf(tableName, construct.Columns(table))
+		rewritten.Predicate = nil
+		for _, column := range table.Key {
+			rewritten.Predicate = append(rewritten.Predicate, construct.Constraint(from, column, tableName, column))
+		}
+	case c.clocks[rule.Supplies] != "":
+		// rows written to replicated tables get the clock of their batch
+		stamp := construct.QC(next, "clock")
+		for _, collectionName := range rule.Requires() {
+			if _, ok := c.replication[collectionName]; ok {
+				stamp = c.rename(construct.QC(collectionName, c.clocks[collectionName]))
+			}
+		}
+		rewritten.Intension = append(rewritten.Intension, stamp)
+	case c.outputs[rule.Supplies]:
+		// responses to the clients
+		rewritten.Intension = append(rewritten.Intension, construct.QC(next, "clock"))
+	}
+
+	return rewritten, nil
+}
+
+// rename moves references to held channels to their usable rows
+func (c *causal) rename(column seed.QualifiedColumn) seed.QualifiedColumn {
+	usable, ok := c.readFrom[column.Collection]
+	if !ok {
+		return column
+	}
+
+	return construct.QC(usable, c.renamed[column.Collection][column.Column])
+}
+
+func (c *causal) renameAll(columns []seed.QualifiedColumn) []seed.QualifiedColumn {
+	renamed := []seed.QualifiedColumn{}
+	for _, column := range columns {
+		renamed = append(renamed, c.rename(column))
+	}
+	return renamed
+}
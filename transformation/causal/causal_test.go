@@ -0,0 +1,106 @@
+package causal
+
+import (
+	"github.com/nathankerr/seed"
+	executor "github.com/nathankerr/seed/host/golang"
+	"github.com/nathankerr/seed/transformation/internal/construct"
+	"github.com/nathankerr/seed/transformation/network"
+	"github.com/nathankerr/seed/transformation/replicate"
+	"testing"
+	"time"
+)
+
+func TestTransform(t *testing.T) {
+	service := construct.Load(t, "kvs", network.Transform, replicate.Transform, Transform)
+
+	err := service.Validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = service.ValidateFunctions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rules := map[string]bool{
+		"causal_next <= [causal_replica.address, {causal_merge causal_stamps.clock}]":                                                        false,
+		"causal_stamps <= [(causal_tick causal_replica.clock causal_replica.address kvstate_update.key)]":                                    false,
+		"kvstate <+- [kvstate_update.key, kvstate_update.value, causal_next.clock]":                                                          false,
+		"kvstate <+- [kvstate_update_channel_delivered.key, kvstate_update_channel_delivered.value, kvstate_update_channel_delivered.clock]": false,
+		"kvstate <- [kvstate.key, kvstate.value, kvstate.clock]: kvstate_delete.key => kvstate.key":                                          false,
+		"kvget_response <~ [kvget_ready.kvget_response_addr, kvstate.key, kvstate.value, causal_next.clock]: kvget_ready.key => kvstate.key": false,
+		"causal_token <~ [kvput_ready.client, causal_next.clock]":                                                                            false,
+	}
+	for _, rule := range service.Rules {
+		if _, ok := rules[rule.String()]; ok {
+			rules[rule.String()] = true
+		}
+	}
+	for rule, found := range rules {
+		if !found {
+			t.Errorf("missing rule %s", rule)
+		}
+	}
+}
+
+// TestStaleRead runs the transformed kvs as replica r1. A read with a
+// token from r2 waits until r2's write reaches r1.
+func TestStaleRead(t *testing.T) {
+	service := construct.Load(t, "kvs", network.Transform, replicate.Transform, Transform)
+	err := service.BindFunctions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	channels := executor.Execute(service, time.Millisecond, "", false, executor.Options{})
+	fromDistribution := make(chan executor.MessageContainer, 100)
+	channels.Distribution <- executor.MessageContainer{
+		Operation:  "register",
+		Collection: "client",
+		Data:       []seed.Tuple{{fromDistribution}},
+	}
+	send := func(collectionName string, tuple seed.Tuple) {
+		channels.Collections[collectionName] <- executor.MessageContainer{
+			Operation:  "<~",
+			Collection: collectionName,
+			Data:       []seed.Tuple{tuple},
+		}
+	}
+	receive := func(collectionName string, timeout time.Duration) (seed.Tuple, bool) {
+		deadline := time.After(timeout)
+		for {
+			select {
+			case message := <-fromDistribution:
+				if message.Collection == collectionName {
+					return message.Data[0], true
+				}
+			case <-deadline:
+				return nil, false
+			}
+		}
+	}
+
+	// requests arriving before the replica knows its clock are dropped
+	send(replica, seed.Tuple{"r1", "{}"})
+	time.Sleep(50 * time.Millisecond)
+
+	send("kvput", seed.Tuple{"r1", "a", "1", "", "client"})
+	if tuple, ok := receive(token, 5*time.Second); !ok || tuple[1] != `{"r1":1}` {
+		t.Fatalf("the put should have returned the token {\"r1\":1}, got %v", tuple)
+	}
+
+	send("kvget", seed.Tuple{"client", "r1", "a", `{"r2":1}`, "client"})
+	if tuple, ok := receive("kvget_response", 100*time.Millisecond); ok {
+		t.Fatalf("the get should wait for r2's write, got %v", tuple)
+	}
+
+	send("kvstate_update_channel", seed.Tuple{"r1", "b", "2", "r2", `{"r2":1}`})
+	tuple, ok := receive("kvget_response", 5*time.Second)
+	if !ok {
+		t.Fatal("the get should have been answered once r2's write arrived")
+	}
+	if tuple[2] != "1" || tuple[3] != `{"r1":1,"r2":1}` {
+		t.Errorf("expected the value 1 and the token {\"r1\":1,\"r2\":1}, got %v", tuple)
+	}
+}
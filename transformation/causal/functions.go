@@ -0,0 +1,146 @@
+package causal
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/nathankerr/seed"
+)
+
+// The functions used by the rules Transform adds.
+func init() {
+	seed.RegisterMap("causal_tick", tick)
+	seed.RegisterMap("causal_covered", covered)
+	seed.RegisterMap("causal_behind", behind)
+	seed.RegisterMap("causal_deliverable", deliverable)
+	seed.RegisterMap("causal_early", early)
+	seed.RegisterReduce("causal_merge", merge)
+}
+
+// A clock counts the write batches from each replica. Clocks are
+// encoded as JSON objects, e.g., {"127.0.0.1:3000":2}, so they compare
+// equal when they are. The empty string is the zero clock.
+type clock map[string]float64
+
+func decode(element seed.Element) clock {
+	c := clock{}
+	var encoded string
+	switch value := element.(type) {
+	case string:
+		encoded = value
+	case []byte:
+		encoded = string(value)
+	default:
+		panic(fmt.Sprintf("clock %v is not a string", element))
+	}
+	if encoded == "" {
+		return c
+	}
+
+	err := json.Unmarshal([]byte(encoded), &c)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// encode sorts the replicas, as encoding/json does for maps
+func (c clock) encode() string {
+	encoded, err := json.Marshal(c)
+	if err != nil {
+		panic(err)
+	}
+	return string(encoded)
+}
+
+// covers reports whether c has seen everything other has
+func (c clock) covers(other clock) bool {
+	for replica, count := range other {
+		if c[replica] < count {
+			return false
+		}
+	}
+	return true
+}
+
+// tick returns its first argument, a clock, with the count for its
+// second, a replica, incremented. Any other arguments only tie the
+// result to the rows being written.
+func tick(arguments seed.Tuple) seed.Element {
+	c := decode(arguments[0])
+	replica, ok := arguments[1].(string)
+	if !ok {
+		panic(fmt.Sprintf("replica %v is not a string", arguments[1]))
+	}
+	c[replica]++
+	return c.encode()
+}
+
+// covered returns its second argument, a client's token, when its
+// first, the replica's clock, covers it; otherwise nil. Joining the
+// result with the tokens keeps the requests which can be handled.
+func covered(arguments seed.Tuple) seed.Element {
+	if !decode(arguments[0]).covers(decode(arguments[1])) {
+		return nil
+	}
+	return arguments[1]
+}
+
+// behind is the opposite of covered
+func behind(arguments seed.Tuple) seed.Element {
+	if decode(arguments[0]).covers(decode(arguments[1])) {
+		return nil
+	}
+	return arguments[1]
+}
+
+// deliverable returns its second argument, the stamp of a write from
+// the replica in its third argument, when the writes it depends on have
+// been applied by the replica with its first, the clock; otherwise nil.
+// Writes in the same batch have the same stamp, so a batch is
+// deliverable until it is fully applied.
+func deliverable(arguments seed.Tuple) seed.Element {
+	if !ready(arguments) {
+		return nil
+	}
+	return arguments[1]
+}
+
+// early is the opposite of deliverable
+func early(arguments seed.Tuple) seed.Element {
+	if ready(arguments) {
+		return nil
+	}
+	return arguments[1]
+}
+
+func ready(arguments seed.Tuple) bool {
+	local := decode(arguments[0])
+	stamp := decode(arguments[1])
+	sender, ok := arguments[2].(string)
+	if !ok {
+		panic(fmt.Sprintf("replica %v is not a string", arguments[2]))
+	}
+
+	for replica, count := range stamp {
+		if replica == sender {
+			count--
+		}
+		if local[replica] < count {
+			return false
+		}
+	}
+	return true
+}
+
+// merge returns the smallest clock covering all of the clocks
+func merge(tuples []seed.Tuple) seed.Element {
+	merged := clock{}
+	for _, tuple := range tuples {
+		for replica, count := range decode(tuple[0]) {
+			if count > merged[replica] {
+				merged[replica] = count
+			}
+		}
+	}
+	return merged.encode()
+}
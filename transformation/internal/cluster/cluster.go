@@ -0,0 +1,128 @@
+// Package cluster runs several instances of a Seed on the go executor,
+// connected by a simulated network. It is for the transformations'
+// tests.
+package cluster
+
+import (
+	"github.com/nathankerr/seed"
+	executor "github.com/nathankerr/seed/host/golang"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A Cluster holds the running instances, by address
+type Cluster struct {
+	Instances map[string]executor.Channels
+
+	// the messages for addresses without an instance; they are dropped
+	// when nobody receives them
+	outside chan executor.MessageContainer
+
+	mutex sync.Mutex
+	drop  func(from string, message executor.MessageContainer) bool
+}
+
+// Run starts an instance of the seed returned by load for each address.
+// The network delivers each channel message to the instance named by
+// its address column.
+func Run(t *testing.T, load func() *seed.Seed, addresses ...string) *Cluster {
+	return RunWith(t, load, func() executor.Options { return executor.Options{} }, addresses...)
+}
+
+// RunWith is Run, with each instance given the options returned by
+// options
+func RunWith(t *testing.T, load func() *seed.Seed, options func() executor.Options, addresses ...string) *Cluster {
+	c := &Cluster{
+		Instances: map[string]executor.Channels{},
+		outside:   make(chan executor.MessageContainer, 1000),
+	}
+
+	networks := map[string]chan executor.MessageContainer{}
+	services := map[string]*seed.Seed{}
+	for _, address := range addresses {
+		service := load()
+		err := service.BindFunctions()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		channels := executor.Execute(service, time.Millisecond, "", false, options())
+		network := make(chan executor.MessageContainer, 100)
+		// every address starts with ""
+		channels.Distribution <- executor.MessageContainer{
+			Operation:  "register",
+			Collection: "",
+			Data:       []seed.Tuple{{network}},
+		}
+		c.Instances[address] = channels
+		networks[address] = network
+		services[address] = service
+	}
+
+	for address, network := range networks {
+		go c.route(address, services[address], network)
+	}
+
+	return c
+}
+
+// route delivers the messages sent by an instance
+func (c *Cluster) route(from string, service *seed.Seed, network <-chan executor.MessageContainer) {
+	for message := range network {
+		c.mutex.Lock()
+		drop := c.drop
+		c.mutex.Unlock()
+		if drop != nil && drop(from, message) {
+			continue
+		}
+
+		// the distributer only sends channels with an address column
+		addressColumn, _ := service.Collections[message.Collection].AddressColumn()
+		to, _ := message.Data[0][addressColumn].(string)
+		message.Operation = "<~"
+
+		instance, ok := c.Instances[to]
+		if !ok {
+			select {
+			case c.outside <- message:
+			default:
+			}
+			continue
+		}
+		go func() { instance.Collections[message.Collection] <- message }()
+	}
+}
+
+// Drop sets the messages the network drops; nil drops none
+func (c *Cluster) Drop(drop func(from string, message executor.MessageContainer) bool) {
+	c.mutex.Lock()
+	c.drop = drop
+	c.mutex.Unlock()
+}
+
+// Send gives the instance at address tuples for a collection
+func (c *Cluster) Send(address, collectionName string, tuples ...seed.Tuple) {
+	c.Instances[address].Collections[collectionName] <- executor.MessageContainer{
+		Operation:  "<~",
+		Collection: collectionName,
+		Data:       tuples,
+	}
+}
+
+// Receive returns the next tuple sent outside the cluster on a
+// collection, skipping the others; ok is false if none is sent before
+// the timeout.
+func (c *Cluster) Receive(collectionName string, timeout time.Duration) (tuple seed.Tuple, ok bool) {
+	deadline := time.After(timeout)
+	for {
+		select {
+		case message := <-c.outside:
+			if message.Collection == collectionName {
+				return message.Data[0], true
+			}
+		case <-deadline:
+			return nil, false
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Package construct holds what the transformations share for adding
+// collections and rules to a Seed
+package construct
+
+import (
+	"github.com/nathankerr/seed"
+)
+
+// Add adds a collection to s, replacing any with the same name
+func Add(s *seed.Seed, name string, collectionType seed.CollectionType, key []string, data []string) {
+	s.Collections[name] = &seed.Collection{
+		Type: collectionType,
+		Key:  append([]string{}, key...),
+		Data: append([]string{}, data...),
+	}
+}
+
+// Rule appends a rule to s
+func Rule(s *seed.Seed, supplies string, operation string, intension []seed.Expression, predicate ...seed.Constraint) {
+	s.Rules = append(s.Rules, &seed.Rule{
+		Supplies:  supplies,
+		Operation: operation,
+		Intension: intension,
+		Predicate: predicate,
+	})
+}
+
+// Columns lists the columns of a collection in key then data order
+func Columns(collection *seed.Collection) []string {
+	return append(append([]string{}, collection.Key...), collection.Data...)
+}
+
+// Unique appends _ to name until it is not in taken
+func Unique(name string, taken []string) string {
+	for {
+		clash := false
+		for _, column := range taken {
+			if column == name {
+				clash = true
+			}
+		}
+		if !clash {
+			return name
+		}
+		name += "_"
+	}
+}
+
+// QC refers to a column of a collection
+func QC(collection, column string) seed.QualifiedColumn {
+	return seed.QualifiedColumn{Collection: collection, Column: column}
+}
+
+// QCs refers to several columns of a collection
+func QCs(collection string, columns []string) []seed.QualifiedColumn {
+	qcs := []seed.QualifiedColumn{}
+	for _, column := range columns {
+		qcs = append(qcs, QC(collection, column))
+	}
+	return qcs
+}
+
+// ColumnsOf refers to several columns of a collection, as expressions
+func ColumnsOf(collection string, columns []string) []seed.Expression {
+	expressions := []seed.Expression{}
+	for _, column := range columns {
+		expressions = append(expressions, QC(collection, column))
+	}
+	return expressions
+}
+
+// Constraint requires the left column to equal the right one
+func Constraint(leftCollection, leftColumn, rightCollection, rightColumn string) seed.Constraint {
+	return seed.Constraint{
+		Left:  QC(leftCollection, leftColumn),
+		Right: QC(rightCollection, rightColumn),
+	}
+}
@@ -0,0 +1,30 @@
+package construct
+
+import (
+	"github.com/nathankerr/seed"
+	"io/ioutil"
+	"testing"
+)
+
+// Load reads services/<name>/<name>.seed, relative to a transformation's
+// directory, and applies the transforms to it. It is for tests.
+func Load(t *testing.T, name string, transforms ...func(*seed.Seed) (*seed.Seed, error)) *seed.Seed {
+	source, err := ioutil.ReadFile("../../services/" + name + "/" + name + ".seed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service, err := seed.FromSeed(name, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, transform := range transforms {
+		service, err = transform(service)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return service
+}
@@ -0,0 +1,78 @@
+package membership
+
+import (
+	"fmt"
+	"github.com/nathankerr/seed"
+)
+
+// The functions used by the rules Transform adds.
+func init() {
+	seed.RegisterMap("membership_other", other)
+	seed.RegisterMap("membership_quiet", quietSince)
+	seed.RegisterMap("membership_alive", aliveSince)
+}
+
+// other returns its second argument, a member, when it differs from its
+// first, this instance; otherwise nil. Joining the result with the
+// gossiped members drops this instance from them.
+func other(arguments seed.Tuple) seed.Element {
+	if arguments[0] == arguments[1] {
+		return nil
+	}
+	return arguments[1]
+}
+
+// quietSince returns its first argument, when a member was last seen, when
+// more than its third argument, the timeout, has passed by its second,
+// now; otherwise nil. Joining the result with the members keeps the
+// quiet ones.
+func quietSince(arguments seed.Tuple) seed.Element {
+	if !expired(arguments) {
+		return nil
+	}
+	return arguments[0]
+}
+
+// aliveSince is the opposite of quietSince
+func aliveSince(arguments seed.Tuple) seed.Element {
+	if expired(arguments) {
+		return nil
+	}
+	return arguments[0]
+}
+
+func expired(arguments seed.Tuple) bool {
+	lastSeen := number(arguments[0])
+	now := number(arguments[1])
+	timeout := number(arguments[2])
+	return lastSeen+timeout < now
+}
+
+// number converts the numbers decoded from wsjson and msgpack messages
+func number(element seed.Element) float64 {
+	switch value := element.(type) {
+	case float64:
+		return value
+	case float32:
+		return float64(value)
+	case int:
+		return float64(value)
+	case int8:
+		return float64(value)
+	case int16:
+		return float64(value)
+	case int32:
+		return float64(value)
+	case int64:
+		return float64(value)
+	case uint8:
+		return float64(value)
+	case uint16:
+		return float64(value)
+	case uint32:
+		return float64(value)
+	case uint64:
+		return float64(value)
+	}
+	panic(fmt.Sprintf("%v is not a number", element))
+}
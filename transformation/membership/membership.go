@@ -0,0 +1,148 @@
+// Package membership adds failure detection through heartbeats to a
+// Seed
+package membership
+
+import (
+	"fmt"
+	"github.com/nathankerr/seed"
+	"github.com/nathankerr/seed/transformation/internal/construct"
+	"sort"
+	"strings"
+)
+
+// Transform keeps a list of the live instances of a Seed in
+// membership_members [address] => [last_seen].
+//
+// Two tables must be filled in when each instance starts:
+//
+//	membership_self [address]         this instance's address
+//	membership_timeout [seconds]      how long members may be quiet
+//	                                  before they are dropped
+//
+// Each instance also needs to be told about one other member, by
+// adding it to membership_members; the rest are learned from it.
+//
+// Whenever the host fills membership_tick [now], a host input, each
+// instance sends a heartbeat with the time to every member on
+// membership_heartbeat and tells them about the members it has not
+// found quiet, and when it last saw them, on membership_gossip.
+// Instances add the senders of heartbeats and the gossiped members to
+// their own, keeping the latest time each was seen. Members not seen
+// for longer than the timeout are dropped. The times come from the
+// members' clocks, which need to be closer together than the timeout.
+//
+// The peer lists of the replication transformations, <table>_replicants
+// and primary_peers, are filled from the members instead of by hand.
+//
+// Run it after the network and replication transformations.
+func Transform(orig *seed.Seed) (*seed.Seed, error) {
+	for _, name := range []string{self, timeout, tick, members, heartbeat, gossip, known, alive, others, news, sightings, quiet} {
+		if _, ok := orig.Collections[name]; ok {
+			return nil, fmt.Errorf("%s is used by the transformation", name)
+		}
+	}
+
+	m := &membership{
+		s: &seed.Seed{
+			Name:        orig.Name,
+			Collections: make(map[string]*seed.Collection),
+			Rules:       append([]*seed.Rule{}, orig.Rules...),
+		},
+	}
+
+	peerLists := []string{}
+	for collectionName, collection := range orig.Collections {
+		m.s.Collections[collectionName] = collection
+		if isPeerList(collectionName, collection) {
+			peerLists = append(peerLists, collectionName)
+		}
+	}
+	sort.Strings(peerLists)
+
+	construct.Add(m.s, self, seed.CollectionTable, []string{"address"}, nil)
+	construct.Add(m.s, timeout, seed.CollectionTable, []string{"seconds"}, nil)
+	construct.Add(m.s, tick, seed.CollectionInput, []string{"now"}, nil)
+	m.s.Collections[tick].Host = true
+	construct.Add(m.s, members, seed.CollectionTable, []string{"address"}, []string{"last_seen"})
+	construct.Add(m.s, heartbeat, seed.CollectionChannel, []string{"@address", "sender"}, []string{"now"})
+	construct.Add(m.s, gossip, seed.CollectionChannel, []string{"@address", "member"}, []string{"last_seen"})
+	construct.Add(m.s, known, seed.CollectionScratch, []string{"address"}, []string{"last_seen"})
+	construct.Add(m.s, alive, seed.CollectionScratch, []string{"address"}, []string{"last_seen"})
+	construct.Add(m.s, others, seed.CollectionScratch, []string{"member", "other"}, nil)
+	construct.Add(m.s, news, seed.CollectionScratch, []string{"address", "last_seen"}, nil)
+	construct.Add(m.s, sightings, seed.CollectionScratch, []string{"address", "last_seen"}, nil)
+	construct.Add(m.s, quiet, seed.CollectionScratch, []string{"address"}, []string{"last_seen"})
+
+	// on each tick, send heartbeats and gossip to the members
+	construct.Rule(m.s, heartbeat, "<~", []seed.Expression{construct.QC(members, "address"), construct.QC(self, "address"), construct.QC(tick, "now")})
+	construct.Rule(m.s, known, "<=", []seed.Expression{construct.QC(members, "address"), construct.QC(members, "last_seen")})
+	construct.Rule(m.s, alive, "<=", []seed.Expression{construct.QC(members, "address"),
+		seed.MapFunction{Name: "membership_alive", Arguments: []seed.QualifiedColumn{construct.QC(members, "last_seen"), construct.QC(tick, "now"), construct.QC(timeout, "seconds")}}})
+
+	// quiet members are not gossiped, or the others would bring them back
+	construct.Rule(m.s, gossip, "<~", []seed.Expression{construct.QC(members, "address"), construct.QC(alive, "address"), construct.QC(alive, "last_seen")},
+		construct.Constraint(alive, "address", known, "address"),
+		construct.Constraint(alive, "last_seen", known, "last_seen"))
+
+	// sent heartbeats and gossip are also kept in the sending channels,
+	// so only those addressed to this instance are news
+	construct.Rule(m.s, news, "<=", []seed.Expression{construct.QC(heartbeat, "sender"), construct.QC(heartbeat, "now")},
+		construct.Constraint(heartbeat, "@address", self, "address"))
+	construct.Rule(m.s, others, "<=", []seed.Expression{construct.QC(gossip, "member"),
+		seed.MapFunction{Name: "membership_other", Arguments: []seed.QualifiedColumn{construct.QC(self, "address"), construct.QC(gossip, "member")}}},
+		construct.Constraint(gossip, "@address", self, "address"))
+	construct.Rule(m.s, news, "<=", []seed.Expression{construct.QC(gossip, "member"), construct.QC(gossip, "last_seen")},
+		construct.Constraint(gossip, "@address", self, "address"),
+		construct.Constraint(gossip, "member", others, "other"))
+
+	// keep the latest time each member was seen
+	construct.Rule(m.s, sightings, "<=", []seed.Expression{construct.QC(news, "address"), construct.QC(news, "last_seen")})
+	construct.Rule(m.s, sightings, "<=", []seed.Expression{construct.QC(members, "address"), construct.QC(members, "last_seen")},
+		construct.Constraint(members, "address", news, "address"))
+	construct.Rule(m.s, members, "<+-", []seed.Expression{construct.QC(sightings, "address"),
+		seed.ReduceFunction{Name: "max", Arguments: []seed.QualifiedColumn{construct.QC(sightings, "last_seen")}}})
+
+	// drop the quiet members
+	construct.Rule(m.s, quiet, "<=", []seed.Expression{construct.QC(members, "address"),
+		seed.MapFunction{Name: "membership_quiet", Arguments: []seed.QualifiedColumn{construct.QC(members, "last_seen"), construct.QC(tick, "now"), construct.QC(timeout, "seconds")}}})
+	construct.Rule(m.s, members, "<-", []seed.Expression{construct.QC(members, "address"), construct.QC(members, "last_seen")},
+		construct.Constraint(members, "address", quiet, "address"),
+		construct.Constraint(members, "last_seen", quiet, "last_seen"))
+
+	// the peer lists follow the members
+	for _, peerList := range peerLists {
+		construct.Add(m.s, peerList, seed.CollectionScratch, []string{"address"}, nil)
+		construct.Rule(m.s, peerList, "<=", []seed.Expression{construct.QC(members, "address")})
+	}
+
+	return m.s, nil
+}
+
+// The collections added by Transform
+const (
+	self      = "membership_self"
+	timeout   = "membership_timeout"
+	tick      = "membership_tick"
+	members   = "membership_members"
+	heartbeat = "membership_heartbeat"
+	gossip    = "membership_gossip"
+	known     = "membership_known"
+	alive     = "membership_alive"
+	others    = "membership_others"
+	news      = "membership_news"
+	sightings = "membership_sightings"
+	quiet     = "membership_quiet"
+)
+
+// isPeerList reports whether a collection is one of the lists of other
+// replicas added by the replication transformations
+func isPeerList(name string, collection *seed.Collection) bool {
+	if collection.Type != seed.CollectionTable || len(collection.Key) != 1 || collection.Key[0] != "address" || len(collection.Data) != 0 {
+		return false
+	}
+	return strings.HasSuffix(name, "_replicants") || name == "primary_peers"
+}
+
+type membership struct {
+	s *seed.Seed
+}
@@ -0,0 +1,149 @@
+package membership
+
+import (
+	"github.com/nathankerr/seed"
+	executor "github.com/nathankerr/seed/host/golang"
+	"github.com/nathankerr/seed/transformation/internal/cluster"
+	"github.com/nathankerr/seed/transformation/internal/construct"
+	"github.com/nathankerr/seed/transformation/network"
+	"github.com/nathankerr/seed/transformation/replicate"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTransform(t *testing.T) {
+	service, err := Transform(construct.Load(t, "kvs", network.Transform, replicate.Transform))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = service.Validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = service.ValidateFunctions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if service.Collections["kvstate_replicants"].Type != seed.CollectionScratch {
+		t.Errorf("kvstate_replicants should be filled from the members")
+	}
+
+	rules := map[string]bool{
+		"membership_heartbeat <~ [membership_members.address, membership_self.address, membership_tick.now]":                                                                                                   false,
+		"membership_members <+- [membership_sightings.address, {max membership_sightings.last_seen}]":                                                                                                          false,
+		"membership_members <- [membership_members.address, membership_members.last_seen]: membership_members.address => membership_quiet.address, membership_members.last_seen => membership_quiet.last_seen": false,
+		"kvstate_replicants <= [membership_members.address]":                                                                                                                                                   false,
+	}
+	for _, rule := range service.Rules {
+		if _, ok := rules[rule.String()]; ok {
+			rules[rule.String()] = true
+		}
+	}
+	for rule, found := range rules {
+		if !found {
+			t.Errorf("missing rule %s", rule)
+		}
+	}
+}
+
+func TestQuiet(t *testing.T) {
+	if quietSince(seed.Tuple{100.0, 104.0, 5.0}) != nil || aliveSince(seed.Tuple{100.0, 104.0, 5.0}) != 100.0 {
+		t.Error("a member seen 4 seconds ago should not be quiet after 5")
+	}
+	if quietSince(seed.Tuple{100.0, 106.0, int64(5)}) != 100.0 || aliveSince(seed.Tuple{100.0, 106.0, int64(5)}) != nil {
+		t.Error("a member seen 6 seconds ago should be quiet after 5")
+	}
+}
+
+// TestDropQuiet runs three instances of the transformed kvs, m2 and m3
+// knowing only m1. They learn of each other; then m3 stops, and m1
+// stops sending it heartbeats and replicating writes to it.
+func TestDropQuiet(t *testing.T) {
+	c := cluster.RunWith(t, func() *seed.Seed {
+		service, err := Transform(construct.Load(t, "kvs", network.Transform, replicate.Transform))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return service
+	}, func() executor.Options {
+		return executor.Options{Clock: &executor.StepClock{Steps: 10}}
+	}, "m1", "m2", "m3")
+
+	// the last time m1 sent each member a message on a collection
+	var mutex sync.Mutex
+	sent := map[string]map[string]time.Time{}
+	stopped := ""
+	c.Drop(func(from string, message executor.MessageContainer) bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if from == "m1" {
+			if sent[message.Collection] == nil {
+				sent[message.Collection] = map[string]time.Time{}
+			}
+			sent[message.Collection][message.Data[0][0].(string)] = time.Now()
+		}
+		return from == stopped
+	})
+	// reaching reports whether m1 has recently sent to a member
+	reaching := func(collectionName, address string) bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return time.Since(sent[collectionName][address]) < 100*time.Millisecond
+	}
+	// reached reports whether m1 has ever sent to a member
+	reached := func(collectionName, address string) bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		_, ok := sent[collectionName][address]
+		return ok
+	}
+
+	now := float64(time.Now().UnixNano()) / 1e9
+	for _, address := range []string{"m1", "m2", "m3"} {
+		c.Send(address, self, seed.Tuple{address})
+		c.Send(address, timeout, seed.Tuple{0.2})
+		if address != "m1" {
+			c.Send(address, members, seed.Tuple{"m1", now})
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !(reaching(heartbeat, "m2") && reaching(heartbeat, "m3")) {
+		if time.Now().After(deadline) {
+			t.Fatal("m1 should have learned of m2 and m3")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mutex.Lock()
+	stopped = "m3"
+	mutex.Unlock()
+	time.Sleep(300 * time.Millisecond)
+	for reaching(heartbeat, "m3") {
+		if time.Now().After(deadline) {
+			t.Fatal("m1 should have dropped m3")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for !reaching(heartbeat, "m2") {
+		if time.Now().After(deadline) {
+			t.Fatal("m1 should still send heartbeats to m2")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	c.Send("m1", "kvput", seed.Tuple{"m1", "a", "1"})
+	for !reached("kvstate_update_channel", "m2") {
+		if time.Now().After(deadline) {
+			t.Fatal("m1 should replicate the write to m2")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if reached("kvstate_update_channel", "m3") {
+		t.Error("m1 should not replicate the write to m3")
+	}
+}
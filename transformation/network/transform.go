@@ -6,20 +6,50 @@ import (
 	"github.com/nathankerr/graph"
 	"github.com/nathankerr/seed"
 	seedGraph "github.com/nathankerr/seed/representation/graph"
+	"log"
 	"math"
 	"reflect"
+	"sort"
 	"strings"
 )
 
-// Transform uses graphs to add network interfaces to Seeds
+// Options change how Transform adds network interfaces
+type Options struct {
+	// RequestID names a column, supplied by clients, which is threaded
+	// from each input to the outputs it reaches along with the reply
+	// address, so replies to concurrent requests can be told apart.
+	// Empty means no column is added.
+	RequestID string
+
+	// ReplyTo names, for an output which several inputs only reach
+	// through tables, the input whose senders receive it
+	ReplyTo map[string]string
+}
+
+// Transform adds network interfaces to a Seed using the zero Options
 func Transform(orig *seed.Seed) (*seed.Seed, error) {
+	return Options{}.Transform(orig)
+}
+
+// Transform uses graphs to add network interfaces to Seeds.
+//
+// Outputs get the reply addresses of the inputs reaching them without
+// passing through a table. Outputs only reached through tables get the
+// addresses of the input reaching them, or of the one named in
+// ReplyTo when there are several; the addresses are stored in the key
+// of each table on the way. Flows which cannot be addressed are
+// logged.
+func (options Options) Transform(orig *seed.Seed) (*seed.Seed, error) {
 	// build graph
 	g := seedGraph.SeedAsGraph(orig)
 
 	orig.Name = strings.Title(orig.Name) + "Server"
 
+	reached := map[string]bool{} // outputs reached without passing through a table
+
 	for inputName, input := range orig.Collections {
-		if input.Type != seed.CollectionInput {
+		// host inputs are filled locally
+		if input.Type != seed.CollectionInput || input.Host {
 			continue
 		}
 		input.Key = append([]string{"@address"}, input.Key...)
@@ -42,60 +72,81 @@ func Transform(orig *seed.Seed) (*seed.Seed, error) {
 				// there is no path (that does not go through a table)
 				continue
 			}
+			reached[outputName] = true
 
 			outputAddress := outputName + "_addr"
-			previousCollection := inputName
-			for _, node := range path[:len(path)] {
-				// unbox graph.internalNode;
-				node = g.GetNode(node.ID())
-
-				switch node := node.(type) {
-				case seedGraph.CollectionNode:
-					previousCollection = node.Name
-					switch node.Collection.Type {
-					case seed.CollectionInput, seed.CollectionScratch:
-						node.Collection.Key = prependIfNotExists(node.Collection.Key, outputAddress)
-					case seed.CollectionOutput:
-						node.Collection.Key = prependIfNotExists(node.Collection.Key, "@"+outputAddress)
-					case seed.CollectionChannel, seed.CollectionTable:
-						panic("should not encounter these collection types")
-					default:
-						panic(fmt.Sprintf("unhandled type: %d", node.Collection.Type))
-					}
-				case seedGraph.RuleNode:
-					exists := false
-					for _, expression := range node.Rule.Intension {
-						switch expression := expression.(type) {
-						case seed.QualifiedColumn:
-							if expression.Column == outputAddress {
-								// if a reference to the outputAddress already exists (i.e., from being added by another flow)
-								// then add a constraint to make the rows match up
-								node.Rule.Predicate = append(node.Rule.Predicate, seed.Constraint{
-									Left: expression,
-									Right: seed.QualifiedColumn{
-										Collection: previousCollection,
-										Column:     outputAddress,
-									},
-								})
-								exists = true
-							}
-						case seed.MapFunction, seed.ReduceFunction:
-							continue
-						default:
-							panic(fmt.Sprintf("unhandled type: %v", reflect.TypeOf(expression).String()))
-						}
-					}
-					if !exists {
-						// add to the projection
-						node.Rule.Intension = append([]seed.Expression{seed.QualifiedColumn{
-							Collection: previousCollection,
-							Column:     outputAddress,
-						}}, node.Rule.Intension...)
-					}
-				default:
-					panic(fmt.Sprintf("unhandled type: %v", reflect.TypeOf(node).String()))
-				}
+			thread(g, path, inputName, outputAddress, "@"+outputAddress)
+			if options.RequestID != "" {
+				thread(g, path, inputName, options.RequestID, options.RequestID)
+			}
+		}
+	}
+
+	// the reply addresses for outputs only reached through tables are
+	// stored in the tables
+	inputNames := []string{}
+	outputNames := []string{}
+	for collectionName, collection := range orig.Collections {
+		switch collection.Type {
+		case seed.CollectionInput:
+			if !collection.Host {
+				inputNames = append(inputNames, collectionName)
+			}
+		case seed.CollectionOutput:
+			outputNames = append(outputNames, collectionName)
+		}
+	}
+	sort.Strings(inputNames)
+	sort.Strings(outputNames)
+	for _, outputName := range outputNames {
+		if reached[outputName] {
+			continue
+		}
+		goal, _ := g.NodeFor(outputName)
+
+		// the paths through tables from each input; when more than one
+		// input reaches the output, which senders get its replies must
+		// be chosen
+		paths := map[string][]graph.Node{}
+		for _, inputName := range inputNames {
+			start, _ := g.NodeFor(inputName)
+			path, cost, _ := graph.AStar(start, goal, g, tableCost, nil)
+			if math.IsInf(cost, 0) {
+				continue
+			}
+			paths[inputName] = path
+		}
+
+		from, chosen := options.ReplyTo[outputName]
+		switch {
+		case chosen:
+			if _, ok := paths[from]; !ok {
+				return nil, fmt.Errorf("%s cannot reply to the senders of %s, which do not reach it", outputName, from)
+			}
+		case len(paths) == 0:
+			log.Printf("network: no input reaches %s, so it has no reply address", outputName)
+			continue
+		case len(paths) == 1:
+			for inputName := range paths {
+				from = inputName
+			}
+		default:
+			candidates := []string{}
+			for inputName := range paths {
+				candidates = append(candidates, inputName)
 			}
+			sort.Strings(candidates)
+			return nil, fmt.Errorf("%s is only reached through tables, from %s; choose whose senders it replies to with ReplyTo", outputName, strings.Join(candidates, ", "))
+		}
+		path := paths[from]
+
+		outputAddress := outputName + "_addr"
+		if !storable(g, path, from, outputName, outputAddress) {
+			continue
+		}
+		thread(g, path, from, outputAddress, "@"+outputAddress)
+		if options.RequestID != "" && storable(g, path, from, outputName, options.RequestID) {
+			thread(g, path, from, options.RequestID, options.RequestID)
 		}
 	}
 
@@ -103,8 +154,11 @@ func Transform(orig *seed.Seed) (*seed.Seed, error) {
 	for _, collection := range orig.Collections {
 		switch collection.Type {
 		case seed.CollectionInput, seed.CollectionOutput:
+			if collection.Host {
+				continue
+			}
 			collection.Type = seed.CollectionChannel
-		case seed.CollectionScratch, seed.CollectionTable, seed.CollectionChannel:
+		case seed.CollectionScratch, seed.CollectionTable, seed.CollectionChannel, seed.CollectionLmax, seed.CollectionLset, seed.CollectionLcounter, seed.CollectionLorset, seed.CollectionLregister:
 			// no-op
 		default:
 			panic(collection.Type)
@@ -128,11 +182,140 @@ func Transform(orig *seed.Seed) (*seed.Seed, error) {
 	return orig, nil
 }
 
-// returns Inf if the to node is a table, otherwise 1
+// thread adds column to the collections and rules along a path from an
+// input to an output, where it is named outputColumn
+func thread(g *seedGraph.Graph, path []graph.Node, inputName string, column string, outputColumn string) {
+	previousCollection := inputName
+	for _, node := range path[:len(path)] {
+		// unbox graph.internalNode;
+		node = g.GetNode(node.ID())
+
+		switch node := node.(type) {
+		case seedGraph.CollectionNode:
+			previousCollection = node.Name
+			switch node.Collection.Type {
+			case seed.CollectionInput, seed.CollectionScratch:
+				node.Collection.Key = prependIfNotExists(node.Collection.Key, column)
+			case seed.CollectionTable, seed.CollectionLmax, seed.CollectionLset, seed.CollectionLcounter, seed.CollectionLorset, seed.CollectionLregister:
+				// each row keeps the column of the request which wrote it
+				node.Collection.Key = prependIfNotExists(node.Collection.Key, column)
+
+				// the other rules writing the table keep the column of
+				// the rows they read from it
+				for _, rule := range g.Seed.Rules {
+					if rule.Supplies == node.Name && !references(rule, column) {
+						rule.Intension = append([]seed.Expression{seed.QualifiedColumn{
+							Collection: node.Name,
+							Column:     column,
+						}}, rule.Intension...)
+					}
+				}
+			case seed.CollectionOutput:
+				node.Collection.Key = prependIfNotExists(node.Collection.Key, outputColumn)
+			case seed.CollectionChannel:
+				panic("should not encounter these collection types")
+			default:
+				panic(fmt.Sprintf("unhandled type: %d", node.Collection.Type))
+			}
+		case seedGraph.RuleNode:
+			exists := false
+			for _, expression := range node.Rule.Intension {
+				switch expression := expression.(type) {
+				case seed.QualifiedColumn:
+					if expression.Column == column {
+						// if a reference to the column already exists (i.e., from being added by another flow)
+						// then add a constraint to make the rows match up
+						if expression.Collection != previousCollection {
+							node.Rule.Predicate = append(node.Rule.Predicate, seed.Constraint{
+								Left: expression,
+								Right: seed.QualifiedColumn{
+									Collection: previousCollection,
+									Column:     column,
+								},
+							})
+						}
+						exists = true
+					}
+				case seed.MapFunction, seed.ReduceFunction:
+					continue
+				default:
+					panic(fmt.Sprintf("unhandled type: %v", reflect.TypeOf(expression).String()))
+				}
+			}
+			if !exists {
+				// add to the projection
+				node.Rule.Intension = append([]seed.Expression{seed.QualifiedColumn{
+					Collection: previousCollection,
+					Column:     column,
+				}}, node.Rule.Intension...)
+			}
+		default:
+			panic(fmt.Sprintf("unhandled type: %v", reflect.TypeOf(node).String()))
+		}
+	}
+}
+
+// storable reports whether column can be stored in the tables along a
+// path from an input to an output. The other rules writing each table
+// must read the table, so they can keep the column of its rows.
+func storable(g *seedGraph.Graph, path []graph.Node, inputName string, outputName string, column string) bool {
+	for _, node := range path {
+		node, ok := g.GetNode(node.ID()).(seedGraph.CollectionNode)
+		if !ok || !persistent(node.Collection) {
+			continue
+		}
+
+		for ruleNumber, rule := range g.Seed.Rules {
+			if rule.Supplies != node.Name || references(rule, column) {
+				continue
+			}
+
+			onPath := false
+			for _, pathNode := range path {
+				if ruleNode, ok := g.GetNode(pathNode.ID()).(seedGraph.RuleNode); ok && ruleNode.Rule == rule {
+					onPath = true
+				}
+			}
+			if onPath {
+				continue
+			}
+
+			readsTable := false
+			for _, collectionName := range rule.Requires() {
+				if collectionName == node.Name {
+					readsTable = true
+				}
+			}
+			if !readsTable {
+				log.Printf("network: %s cannot reply to the senders of %s through %s, which rule %d also writes", outputName, inputName, node.Name, ruleNumber)
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// references reports whether a rule's intension has column
+func references(rule *seed.Rule, column string) bool {
+	for _, expression := range rule.Intension {
+		if qc, ok := expression.(seed.QualifiedColumn); ok && qc.Column == column {
+			return true
+		}
+	}
+	return false
+}
+
+// persistent reports whether a collection is a table or a lattice
+func persistent(collection *seed.Collection) bool {
+	return collection.Type == seed.CollectionTable || collection.Type.Lattice()
+}
+
+// returns Inf if the to node is a table or a lattice, otherwise 1
 func cost(from graph.Node, to graph.Node) float64 {
 	switch to := to.(type) {
 	case seedGraph.CollectionNode:
-		if to.Collection.Type == seed.CollectionTable {
+		if persistent(to.Collection) {
 			return math.Inf(0)
 		}
 	case seedGraph.RuleNode:
@@ -144,6 +327,15 @@ func cost(from graph.Node, to graph.Node) float64 {
 	return 1.0
 }
 
+// returns 100 if the to node is a table, otherwise 1, so paths avoid
+// tables when they can
+func tableCost(from graph.Node, to graph.Node) float64 {
+	if math.IsInf(cost(from, to), 0) {
+		return 100
+	}
+	return 1.0
+}
+
 func prependIfNotExists(strings []string, toAdd string) []string {
 	exists := false
 
@@ -2,6 +2,7 @@ package network
 
 import (
 	"github.com/nathankerr/seed"
+	"strings"
 	"testing"
 	// "reflect"
 )
@@ -39,7 +40,7 @@ response <+ [request.timezone, (current_time_in request.timezone)]`,
 					&seed.Rule{
 						Supplies:  "response",
 						Operation: "<~",
-						Projection: []seed.Expression{
+						Intension: []seed.Expression{
 							seed.QualifiedColumn{
 								Collection: "request",
 								Column:     "response_addr",
@@ -89,3 +90,138 @@ response <+ [request.timezone, (current_time_in request.timezone)]`,
 
 	}
 }
+
+// transform returns the rules and collections, as strings, of a seed
+// after Transform
+func transform(t *testing.T, options Options, source string) (map[string]string, []string) {
+	input, err := seed.FromSeed("test", []byte(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := options.Transform(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = output.Validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	collections := map[string]string{}
+	for name, collection := range output.Collections {
+		collections[name] = strings.TrimSpace(collection.String(name))
+	}
+	rules := []string{}
+	for _, rule := range output.Rules {
+		rules = append(rules, rule.String())
+	}
+	return collections, rules
+}
+
+func check(t *testing.T, name string, collections map[string]string, rules []string, expectedCollections map[string]string, expectedRules []string) {
+	for collectionName, expected := range expectedCollections {
+		if collections[collectionName] != expected {
+			t.Errorf("%s: expected %s, got %s", name, expected, collections[collectionName])
+		}
+	}
+	if len(rules) != len(expectedRules) {
+		t.Fatalf("%s: expected %d rules, got %v", name, len(expectedRules), rules)
+	}
+	for i, expected := range expectedRules {
+		if rules[i] != expected {
+			t.Errorf("%s: expected %s, got %s", name, expected, rules[i])
+		}
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	collections, rules := transform(t, Options{RequestID: "rid"},
+		"input request [key]\n"+
+			"table store [key] => [value]\n"+
+			"output response [key, value]\n"+
+			"response <+ [request.key, store.value]: request.key => store.key\n")
+
+	check(t, "request id", collections, rules,
+		map[string]string{
+			"request":  "channel request [rid, response_addr, @address, key]",
+			"response": "channel response [rid, @response_addr, key, value]",
+		},
+		[]string{
+			"response <~ [request.rid, request.response_addr, request.key, store.value]: request.key => store.key",
+		})
+}
+
+func TestPendingTable(t *testing.T) {
+	// requests wait in a table until the host fills tick
+	collections, rules := transform(t, Options{RequestID: "rid"},
+		"input order [id] => [item]\n"+
+			"host input tick [now]\n"+
+			"table pending [id] => [item]\n"+
+			"output shipped [id, item]\n"+
+			"pending <+ [order.id, order.item]\n"+
+			"shipped <+ [pending.id, pending.item, tick.now]\n"+
+			"pending <- [pending.id, pending.item, tick.now]\n")
+
+	check(t, "pending table", collections, rules,
+		map[string]string{
+			"order":   "channel order [rid, shipped_addr, @address, id] => [item]",
+			"tick":    "host input tick [now]",
+			"pending": "table pending [rid, shipped_addr, id] => [item]",
+			"shipped": "channel shipped [rid, @shipped_addr, id, item]",
+		},
+		[]string{
+			"pending <+ [order.rid, order.shipped_addr, order.id, order.item]",
+			"shipped <~ [pending.rid, pending.shipped_addr, pending.id, pending.item, tick.now]",
+			"pending <- [pending.rid, pending.shipped_addr, pending.id, pending.item, tick.now]",
+		})
+}
+
+// both inputs reach deliver only through tables
+const pubsub = "input subscribe [topic]\n" +
+	"input publish [topic, message]\n" +
+	"table subscribers [topic]\n" +
+	"table posts [topic, message]\n" +
+	"output deliver [topic, message]\n" +
+	"subscribers <+ [subscribe.topic]\n" +
+	"posts <+ [publish.topic, publish.message]\n" +
+	"deliver <+ [posts.topic, posts.message]: posts.topic => subscribers.topic\n"
+
+func TestSubscribers(t *testing.T) {
+	// posts are delivered to the subscribers of their topic
+	collections, rules := transform(t, Options{ReplyTo: map[string]string{"deliver": "subscribe"}}, pubsub)
+
+	check(t, "subscribers", collections, rules,
+		map[string]string{
+			"subscribe":   "channel subscribe [deliver_addr, @address, topic]",
+			"publish":     "channel publish [@address, topic, message]",
+			"subscribers": "table subscribers [deliver_addr, topic]",
+			"posts":       "table posts [topic, message]",
+			"deliver":     "channel deliver [@deliver_addr, topic, message]",
+		},
+		[]string{
+			"subscribers <+ [subscribe.deliver_addr, subscribe.topic]",
+			"posts <+ [publish.topic, publish.message]",
+			"deliver <~ [subscribers.deliver_addr, posts.topic, posts.message]: posts.topic => subscribers.topic",
+		})
+}
+
+func TestReplyToRequired(t *testing.T) {
+	tests := map[string]Options{
+		"not chosen":     Options{},
+		"does not reach": Options{ReplyTo: map[string]string{"deliver": "nowhere"}},
+	}
+
+	for name, options := range tests {
+		input, err := seed.FromSeed("pubsub", []byte(pubsub))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = options.Transform(input)
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package primary
+
+import (
+	"fmt"
+	"github.com/nathankerr/seed"
+)
+
+// The functions used by the rules Transform adds.
+func init() {
+	seed.RegisterMap("primary_next", next)
+	seed.RegisterMap("primary_other", other)
+}
+
+// next returns the sequence number after its argument. Sequence
+// numbers are float64 so they compare equal to those decoded from
+// wsjson messages.
+func next(arguments seed.Tuple) seed.Element {
+	switch sequence := arguments[0].(type) {
+	case int:
+		return float64(sequence + 1)
+	case int64:
+		return float64(sequence + 1)
+	case float64:
+		return sequence + 1
+	default:
+		panic(fmt.Sprintf("sequence number %v is not a number", sequence))
+	}
+}
+
+// other returns its second argument, the leader, when it differs from
+// its first, this replica; otherwise nil. Joining the result with the
+// leader keeps the rows of backups.
+func other(arguments seed.Tuple) seed.Element {
+	if arguments[0] == arguments[1] {
+		return nil
+	}
+	return arguments[1]
+}
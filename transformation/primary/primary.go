@@ -0,0 +1,320 @@
+// Package primary adds primary/backup replication to the tables of a
+// Seed
+package primary
+
+import (
+	"fmt"
+	"github.com/nathankerr/seed"
+	"github.com/nathankerr/seed/transformation/internal/construct"
+	"reflect"
+	"sort"
+)
+
+// Transform replicates the tables from a leader to its backups.
+//
+// Three tables must be filled in when each replica starts:
+//
+//	primary_leader [replica] => [address]
+//	                                  this replica's address and the
+//	                                  leader's, which may be changed
+//	                                  at runtime
+//	primary_replica [address] => [seq]
+//	                                  this replica's address and the
+//	                                  sequence number of the last
+//	                                  change applied, 0 at first
+//	primary_peers [address]           the other replicas
+//
+// Only the leader accepts the input channels; backups forward what
+// they receive to the leader on <input>_forwarded. The changes the
+// leader makes to its tables in a timestep are applied and sent to the
+// peers as a batch with the next sequence number. The batch is
+// committed in the following timestep, after its changes have been
+// sent. Backups apply the committed batches in sequence number order.
+// A new leader continues from the last batch it applied.
+//
+// Run it after the network transformation.
+func Transform(orig *seed.Seed) (*seed.Seed, error) {
+	for _, name := range []string{leader, replica, peers, forward, following, batch, committed, commit, commits, apply} {
+		if _, ok := orig.Collections[name]; ok {
+			return nil, fmt.Errorf("%s is used by the transformation", name)
+		}
+	}
+
+	p := &primary{
+		orig: orig,
+		s: &seed.Seed{
+			Name:        orig.Name,
+			Collections: make(map[string]*seed.Collection),
+		},
+		accepted:  map[string]string{},
+		renamed:   map[string]map[string]string{},
+		writes:    map[string]map[string]bool{},
+		immediate: map[string]bool{},
+	}
+
+	supplied := map[string]bool{}
+	for _, rule := range orig.Rules {
+		supplied[rule.Supplies] = true
+	}
+
+	tables := []string{}
+	inputs := []string{}
+	for collectionName, collection := range orig.Collections {
+		p.s.Collections[collectionName] = collection
+		switch collection.Type {
+		case seed.CollectionTable:
+			tables = append(tables, collectionName)
+		case seed.CollectionInput, seed.CollectionChannel:
+			// host inputs are local to each replica
+			if !supplied[collectionName] && !collection.Host {
+				inputs = append(inputs, collectionName)
+			}
+		}
+	}
+	sort.Strings(tables)
+	sort.Strings(inputs)
+
+	construct.Add(p.s, leader, seed.CollectionTable, []string{"replica"}, []string{"address"})
+	construct.Add(p.s, replica, seed.CollectionTable, []string{"address"}, []string{"seq"})
+	construct.Add(p.s, peers, seed.CollectionTable, []string{"address"}, nil)
+	construct.Add(p.s, forward, seed.CollectionScratch, []string{"address"}, nil)
+	construct.Add(p.s, following, seed.CollectionScratch, []string{"seq"}, nil)
+	construct.Add(p.s, batch, seed.CollectionScratch, []string{"seq"}, []string{"changes"})
+	construct.Add(p.s, committed, seed.CollectionTable, []string{"seq"}, nil)
+	construct.Add(p.s, commit, seed.CollectionChannel, []string{"@address", "seq"}, nil)
+	construct.Add(p.s, commits, seed.CollectionTable, []string{"seq"}, nil)
+	construct.Add(p.s, apply, seed.CollectionScratch, []string{"seq"}, nil)
+
+	construct.Rule(p.s, forward, "<=", []seed.Expression{
+		seed.MapFunction{Name: "primary_other", Arguments: []seed.QualifiedColumn{construct.QC(replica, "address"), construct.QC(leader, "address")}}})
+	construct.Rule(p.s, following, "<=", []seed.Expression{
+		seed.MapFunction{Name: "primary_next", Arguments: []seed.QualifiedColumn{construct.QC(replica, "seq")}}})
+
+	for _, inputName := range inputs {
+		p.accept(inputName)
+	}
+
+	for _, rule := range orig.Rules {
+		p.write(rule)
+	}
+
+	for _, tableName := range tables {
+		for _, operation := range []string{"insert", "update", "delete"} {
+			if p.writes[tableName][operation] {
+				p.replicate(tableName, operation)
+			}
+		}
+	}
+
+	// the leader commits its batches in the following timestep
+	construct.Rule(p.s, replica, "<+-", []seed.Expression{construct.QC(replica, "address"), construct.QC(batch, "seq")})
+	construct.Rule(p.s, committed, "<+", []seed.Expression{construct.QC(batch, "seq")})
+	construct.Rule(p.s, commit, "<~", []seed.Expression{construct.QC(peers, "address"), construct.QC(committed, "seq")})
+	construct.Rule(p.s, committed, "<-", []seed.Expression{construct.QC(committed, "seq")})
+
+	// backups apply the next committed batch
+	construct.Rule(p.s, commits, "<+", []seed.Expression{construct.QC(commit, "seq")},
+		construct.Constraint(forward, "address", leader, "address"))
+	construct.Rule(p.s, apply, "<=", []seed.Expression{construct.QC(commits, "seq")},
+		construct.Constraint(commits, "seq", following, "seq"))
+	construct.Rule(p.s, replica, "<+-", []seed.Expression{construct.QC(replica, "address"), construct.QC(apply, "seq")})
+	construct.Rule(p.s, commits, "<-", []seed.Expression{construct.QC(commits, "seq")},
+		construct.Constraint(commits, "seq", apply, "seq"))
+
+	return p.s, nil
+}
+
+// The collections added by Transform
+const (
+	leader    = "primary_leader"
+	replica   = "primary_replica"
+	peers     = "primary_peers"
+	forward   = "primary_forward"   // the leader, at backups
+	following = "primary_following" // the sequence number after replica's
+	batch     = "primary_batch"     // at the leader, when its tables change
+	committed = "primary_committed"
+	commit    = "primary_commit"
+	commits   = "primary_commits" // received, but not yet applied
+	apply     = "primary_apply"
+)
+
+type primary struct {
+	orig      *seed.Seed
+	s         *seed.Seed
+	accepted  map[string]string            // input: the scratch holding what the leader accepts
+	renamed   map[string]map[string]string // input: column: accepted column
+	writes    map[string]map[string]bool   // table: operations used
+	immediate map[string]bool              // tables inserted into with <=
+}
+
+// accept holds what an input receives in a scratch when this replica
+// is the leader, and forwards it to the leader otherwise
+func (p *primary) accept(inputName string) {
+	input := p.orig.Collections[inputName]
+	acceptedName := inputName + "_accepted"
+	p.accepted[inputName] = acceptedName
+
+	// the address markers are only allowed in channels
+	renamed := map[string]string{}
+	acceptedColumns := [][]string{}
+	for _, columnNames := range [][]string{input.Key, input.Data} {
+		columns := []string{}
+		for _, column := range columnNames {
+			renamed[column] = column
+			if column[0] == '@' {
+				renamed[column] = column[1:]
+			}
+			columns = append(columns, renamed[column])
+		}
+		acceptedColumns = append(acceptedColumns, columns)
+	}
+	p.renamed[inputName] = renamed
+	construct.Add(p.s, acceptedName, seed.CollectionScratch, acceptedColumns[0], acceptedColumns[1])
+
+	construct.Rule(p.s, acceptedName, "<=", construct.ColumnsOf(inputName, construct.Columns(input)),
+		construct.Constraint(replica, "address", leader, "address"))
+
+	if input.Type != seed.CollectionChannel {
+		return
+	}
+
+	// sent rows are also kept in the sending channel, so forwarding on
+	// the input itself would forward them again in the next timestep
+	forwardedName := inputName + "_forwarded"
+	construct.Add(p.s, forwardedName, seed.CollectionChannel, input.Key, input.Data)
+
+	address, _ := input.AddressColumn()
+	intension := construct.ColumnsOf(inputName, construct.Columns(input))
+	intension[address] = construct.QC(forward, "address")
+	construct.Rule(p.s, forwardedName, "<~", intension,
+		construct.Constraint(forward, "address", leader, "address"))
+	construct.Rule(p.s, acceptedName, "<=", construct.ColumnsOf(forwardedName, construct.Columns(input)),
+		construct.Constraint(replica, "address", leader, "address"))
+}
+
+// write adds an original rule, reading the accepted inputs. Rules
+// supplying a table instead supply the scratch for their operation.
+func (p *primary) write(rule *seed.Rule) {
+	rewritten := &seed.Rule{
+		Supplies:  rule.Supplies,
+		Operation: rule.Operation,
+	}
+	for _, expression := range rule.Intension {
+		switch value := expression.(type) {
+		case seed.QualifiedColumn:
+			expression = p.rename(value)
+		case seed.MapFunction:
+			value.Arguments = p.renameAll(value.Arguments)
+			expression = value
+		case seed.ReduceFunction:
+			value.Arguments = p.renameAll(value.Arguments)
+			expression = value
+		default:
+			panic(fmt.Sprintf("unhandled type: %v", reflect.TypeOf(expression).String()))
+		}
+		rewritten.Intension = append(rewritten.Intension, expression)
+	}
+	for _, constraint := range rule.Predicate {
+		rewritten.Predicate = append(rewritten.Predicate, seed.Constraint{
+			Left:  p.rename(constraint.Left),
+			Right: p.rename(constraint.Right),
+		})
+	}
+
+	tableName := rule.Supplies
+	table := p.orig.Collections[tableName]
+	if table.Type == seed.CollectionTable {
+		var operation string
+		switch rule.Operation {
+		case "<+", "<=":
+			operation = "insert"
+			if rule.Operation == "<=" {
+				p.immediate[tableName] = true
+			}
+		case "<+-":
+			operation = "update"
+		case "<-":
+			operation = "delete"
+		default:
+			// shouldn't get here
+			panic(rule.Operation)
+		}
+
+		if p.writes[tableName] == nil {
+			p.writes[tableName] = map[string]bool{}
+		}
+		p.writes[tableName][operation] = true
+
+		rewritten.Supplies = tableName + "_" + operation
+		rewritten.Operation = "<="
+		construct.Add(p.s, rewritten.Supplies, seed.CollectionScratch, table.Key, table.Data)
+	}
+
+	p.s.Rules = append(p.s.Rules, rewritten)
+}
+
+// replicate applies the changes made by an operation on a table at the
+// leader, and sends them to the backups to apply
+func (p *primary) replicate(tableName string, operation string) {
+	table := p.orig.Collections[tableName]
+	changes := tableName + "_" + operation
+	log := changes + "_log"
+	entries := changes + "_entries"
+	sequence := construct.Unique("seq", construct.Columns(table))
+
+	var local, remote string
+	switch operation {
+	case "insert":
+		local = "<+"
+		if p.immediate[tableName] {
+			local = "<="
+		}
+		remote = "<+"
+	case "update":
+		local = "<+-"
+		remote = "<+-"
+	case "delete":
+		local = "<-"
+		remote = "<-"
+	}
+
+	construct.Add(p.s, log, seed.CollectionChannel, append([]string{"@address", sequence}, table.Key...), table.Data)
+	construct.Add(p.s, entries, seed.CollectionTable, append([]string{sequence}, table.Key...), table.Data)
+
+	// the leader applies and sends the changes
+	construct.Rule(p.s, batch, "<=", []seed.Expression{
+		construct.QC(following, "seq"),
+		seed.ReduceFunction{Name: "count", Arguments: construct.QCs(changes, construct.Columns(table)[:1])}},
+		construct.Constraint(replica, "address", leader, "address"))
+	construct.Rule(p.s, tableName, local, construct.ColumnsOf(changes, construct.Columns(table)),
+		construct.Constraint(replica, "address", leader, "address"))
+	construct.Rule(p.s, log, "<~", append(
+		[]seed.Expression{construct.QC(peers, "address"), construct.QC(batch, "seq")},
+		construct.ColumnsOf(changes, construct.Columns(table))...))
+
+	// the backups apply the changes when their batch is applied
+	construct.Rule(p.s, entries, "<+", construct.ColumnsOf(log, append([]string{sequence}, construct.Columns(table)...)),
+		construct.Constraint(forward, "address", leader, "address"))
+	construct.Rule(p.s, tableName, remote, construct.ColumnsOf(entries, construct.Columns(table)),
+		construct.Constraint(entries, sequence, apply, "seq"))
+	construct.Rule(p.s, entries, "<-", construct.ColumnsOf(entries, append([]string{sequence}, construct.Columns(table)...)),
+		construct.Constraint(entries, sequence, apply, "seq"))
+}
+
+// rename moves references to inputs to their accepted scratches
+func (p *primary) rename(column seed.QualifiedColumn) seed.QualifiedColumn {
+	acceptedName, ok := p.accepted[column.Collection]
+	if !ok {
+		return column
+	}
+
+	return construct.QC(acceptedName, p.renamed[column.Collection][column.Column])
+}
+
+func (p *primary) renameAll(columns []seed.QualifiedColumn) []seed.QualifiedColumn {
+	renamed := []seed.QualifiedColumn{}
+	for _, column := range columns {
+		renamed = append(renamed, p.rename(column))
+	}
+	return renamed
+}
@@ -0,0 +1,92 @@
+package primary
+
+import (
+	"github.com/nathankerr/seed"
+	executor "github.com/nathankerr/seed/host/golang"
+	"github.com/nathankerr/seed/transformation/internal/cluster"
+	"github.com/nathankerr/seed/transformation/internal/construct"
+	"github.com/nathankerr/seed/transformation/network"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTransform(t *testing.T) {
+	service, err := Transform(construct.Load(t, "cart", network.Transform))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = service.Validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// log already has a seq column
+	entries := service.Collections["log_insert_entries"].String("log_insert_entries")
+	expected := "table log_insert_entries [seq_, cart, seq] => [item, num]"
+	if !strings.HasPrefix(entries, expected) {
+		t.Errorf("expected %q, got %q", expected, entries)
+	}
+
+	rules := map[string]bool{
+		"action_forwarded <~ [primary_forward.address, action.cart, action.seq, action.item, action.num]: primary_forward.address => primary_leader.address":      false,
+		"log <+ [log_insert.cart, log_insert.seq, log_insert.item, log_insert.num]: primary_replica.address => primary_leader.address":                            false,
+		"log <+ [log_insert_entries.cart, log_insert_entries.seq, log_insert_entries.item, log_insert_entries.num]: log_insert_entries.seq_ => primary_apply.seq": false,
+		"response <~ [checkout_accepted.response_addr, checkout_accepted.cart, {accumulate_items log.item log.num}]: checkout_accepted.cart => log.cart":          false,
+		"primary_apply <= [primary_commits.seq]: primary_commits.seq => primary_following.seq":                                                                    false,
+	}
+	for _, rule := range service.Rules {
+		if _, ok := rules[rule.String()]; ok {
+			rules[rule.String()] = true
+		}
+	}
+	for rule, found := range rules {
+		if !found {
+			t.Errorf("missing rule %s", rule)
+		}
+	}
+}
+
+// TestFailover runs the transformed kvs as the leader p and the backup
+// b. A put sent to b is forwarded to p and replicated back to b. When p
+// stops and b becomes the leader, b has the put and accepts new ones.
+func TestFailover(t *testing.T) {
+	c := cluster.Run(t, func() *seed.Seed {
+		service, err := Transform(construct.Load(t, "kvs", network.Transform))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return service
+	}, "p", "b")
+	for address, peer := range map[string]string{"p": "b", "b": "p"} {
+		c.Send(address, leader, seed.Tuple{address, "p"})
+		c.Send(address, replica, seed.Tuple{address, 0})
+		c.Send(address, peers, seed.Tuple{peer})
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// get polls b until it returns value
+	get := func(value string) {
+		for i := 0; i < 50; i++ {
+			c.Send("b", "kvget", seed.Tuple{"client", "b", "a"})
+			if tuple, ok := c.Receive("kvget_response", 100*time.Millisecond); ok && tuple[2] == value {
+				return
+			}
+		}
+		t.Fatalf("expected b to return %s", value)
+	}
+
+	c.Send("b", "kvput", seed.Tuple{"b", "a", "1"})
+	get("1")
+
+	// p stops
+	c.Drop(func(from string, message executor.MessageContainer) bool {
+		return from == "p"
+	})
+	c.Send("b", leader, seed.Tuple{"b", "b"})
+	get("1")
+
+	c.Send("b", "kvput", seed.Tuple{"b", "a", "2"})
+	get("2")
+}
@@ -0,0 +1,76 @@
+package quorum
+
+import (
+	"fmt"
+	"github.com/nathankerr/seed"
+	"strconv"
+	"strings"
+)
+
+// The functions used by the rules Transform adds.
+func init() {
+	seed.RegisterMap("quorum_version", version)
+	seed.RegisterMap("quorum_request", request)
+	seed.RegisterMap("quorum_time", versionTime)
+	seed.RegisterMap("quorum_reached", reached)
+}
+
+// version returns the version of a write made by the replica named by
+// the second argument when its clock is at the first: the next time,
+// padded so versions sort by it, followed by the replica's name.
+func version(arguments seed.Tuple) seed.Element {
+	return fmt.Sprintf("%020d.%s", integer(arguments[0])+1, text(arguments[1]))
+}
+
+// request returns the id of a read request: the version the replica
+// would give a write, followed by the request, its other arguments
+func request(arguments seed.Tuple) seed.Element {
+	return fmt.Sprintf("%s %v", version(arguments[:2]), arguments[2:])
+}
+
+// versionTime returns the time of a version or request id
+func versionTime(arguments seed.Tuple) seed.Element {
+	encoded := text(arguments[0])
+	time, err := strconv.ParseInt(encoded[:strings.Index(encoded, ".")], 10, 64)
+	if err != nil {
+		panic(err)
+	}
+	return time
+}
+
+// reached returns its second argument, the quorum, when the first
+// argument, a count, is at least the quorum; otherwise nil. Joining
+// the result with the quorum keeps the rows which reached it.
+func reached(arguments seed.Tuple) seed.Element {
+	comparison, err := seed.Compare(arguments[0], arguments[1])
+	if err != nil {
+		panic(err)
+	}
+
+	if comparison >= 0 {
+		return arguments[1]
+	}
+	return nil
+}
+
+// integer converts a time, which may have been decoded as any kind of
+// number, to an int64
+func integer(element seed.Element) int64 {
+	time, err := strconv.ParseFloat(fmt.Sprint(element), 64)
+	if err != nil {
+		panic(fmt.Sprintf("time %v is not a number", element))
+	}
+	return int64(time)
+}
+
+// text converts msgpack's []byte strings to strings
+func text(element seed.Element) string {
+	switch value := element.(type) {
+	case string:
+		return value
+	case []byte:
+		return string(value)
+	default:
+		panic(fmt.Sprintf("%v is not a string", element))
+	}
+}
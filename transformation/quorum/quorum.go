@@ -0,0 +1,579 @@
+// Package quorum adds quorum replication to the tables of a Seed
+package quorum
+
+import (
+	"fmt"
+	"github.com/nathankerr/seed"
+	"github.com/nathankerr/seed/transformation/internal/construct"
+	"reflect"
+	"sort"
+)
+
+// Transform replicates each table using read and write quorums.
+//
+// Every table gets a version column, and three tables which must be
+// filled in when each replica starts:
+//
+//	<table>_replicants [address]            the other replicas
+//	<table>_quorum [address] => [write, read]
+//	                                        this replica's address and
+//	                                        the write (W) and read (R)
+//	                                        quorums, counting itself
+//	<table>_clock [address] => [time]       this replica's address and
+//	                                        its Lamport clock, 0 at first
+//
+// A version is the time of the write, one more than the replica's
+// clock, followed by the replica's address. The clock moves past the
+// versions the replica makes and receives, so a write gets a later
+// version than every write its replica has seen (last writer wins);
+// the address orders concurrent writes.
+//
+// Writes, the rules supplying the table, are sent to every replicant
+// and applied at each replica, at the end of the timestep, when their
+// version is later than the one of the row they replace. Inserts and updates get a new version;
+// deletes keep the version of the row they delete, and only delete
+// that row. Each replica acknowledges the writes it receives. When W
+// acknowledgements have been received, the key and version of the
+// write are put in <table>_written, here and, through <table>_commit,
+// on the replicants. Rules which read a written table, but do not
+// write a table, only see the rows in <table>_written, so their
+// outputs wait for the write quorum.
+//
+// Reads are rules which join the table with one collection that is not
+// a table, such as an input or channel. Each request is held in
+// <table>_read<rule> and sent to every replicant; the replicas answer
+// with the rows the rule would join with, and then acknowledge the
+// request. When R replicas have answered, the rule is run on the rows
+// with the last version of each key.
+//
+// Run it after the network transformation.
+func Transform(orig *seed.Seed) (*seed.Seed, error) {
+	q := &quorum{
+		orig: orig,
+		s: &seed.Seed{
+			Name:        orig.Name,
+			Collections: make(map[string]*seed.Collection),
+		},
+		writes: map[string]map[string]bool{},
+	}
+
+	for collectionName, collection := range orig.Collections {
+		q.s.Collections[collectionName] = collection
+		if collection.Type == seed.CollectionTable {
+			q.tables = append(q.tables, collectionName)
+		}
+	}
+	sort.Strings(q.tables)
+
+	// add the version columns and the configuration tables
+	q.versions = map[string]string{}
+	for _, tableName := range q.tables {
+		table := q.s.Collections[tableName]
+		version := construct.Unique("version", construct.Columns(table))
+		q.versions[tableName] = version
+		q.s.Collections[tableName] = &seed.Collection{
+			Type: table.Type,
+			Key:  table.Key,
+			Data: append(append([]string{}, table.Data...), version),
+		}
+
+		construct.Add(q.s, tableName+"_replicants", seed.CollectionTable, []string{"address"}, nil)
+		construct.Add(q.s, tableName+"_quorum", seed.CollectionTable, []string{"address"}, []string{"write", "read"})
+	}
+
+	// the tables supplied by a rule
+	written := map[string]bool{}
+	for _, rule := range orig.Rules {
+		if orig.Collections[rule.Supplies].Type == seed.CollectionTable {
+			written[rule.Supplies] = true
+		}
+	}
+
+	for ruleNumber, rule := range orig.Rules {
+		supplies := orig.Collections[rule.Supplies]
+		if supplies.Type == seed.CollectionTable {
+			err := q.write(ruleNumber, rule)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if tableName, requestName, ok := q.readable(rule); ok {
+			q.read(ruleNumber, rule, tableName, requestName)
+			continue
+		}
+
+		q.s.Rules = append(q.s.Rules, q.gate(rule, written))
+	}
+
+	for _, tableName := range q.tables {
+		q.clock(tableName)
+		if len(q.writes[tableName]) > 0 {
+			q.replicateWrites(tableName)
+		}
+	}
+
+	return q.s, nil
+}
+
+type quorum struct {
+	orig     *seed.Seed
+	s        *seed.Seed
+	tables   []string                   // sorted
+	versions map[string]string          // table: version column
+	writes   map[string]map[string]bool // table: operations used
+}
+
+// gate keeps a rule to the rows of the written tables it reads which
+// are in <table>_written
+func (q *quorum) gate(rule *seed.Rule, written map[string]bool) *seed.Rule {
+	gated := &seed.Rule{
+		Supplies:  rule.Supplies,
+		Operation: rule.Operation,
+		Intension: rule.Intension,
+		Predicate: append([]seed.Constraint{}, rule.Predicate...),
+	}
+	for _, collectionName := range rule.Requires() {
+		if !written[collectionName] {
+			continue
+		}
+		columns := append(append([]string{}, q.orig.Collections[collectionName].Key...), q.versions[collectionName])
+		gated.Predicate = append(gated.Predicate, join(collectionName, collectionName+"_written", columns)...)
+	}
+	return gated
+}
+
+// clock keeps a table's Lamport clock: after each timestep it is the
+// latest of its time, the times of the versions received and those of
+// the versions made. <table>_now holds the time, once the received
+// versions are accounted for, which new versions follow.
+func (q *quorum) clock(tableName string) {
+	clock := tableName + "_clock"
+	times := tableName + "_times"
+	now := tableName + "_now"
+	ticks := tableName + "_ticks"
+	next := tableName + "_next"
+
+	construct.Add(q.s, clock, seed.CollectionTable, []string{"address"}, []string{"time"})
+	construct.Add(q.s, times, seed.CollectionScratch, []string{"time"}, nil)
+	construct.Add(q.s, now, seed.CollectionScratch, []string{"address"}, []string{"time"})
+	construct.Add(q.s, ticks, seed.CollectionScratch, []string{"address", "time"}, nil)
+	construct.Add(q.s, next, seed.CollectionScratch, []string{"address"}, []string{"time"})
+
+	construct.Rule(q.s, times, "<=", []seed.Expression{construct.QC(clock, "time")})
+	construct.Rule(q.s, now, "<=", []seed.Expression{construct.QC(clock, "address"),
+		seed.ReduceFunction{Name: "max", Arguments: []seed.QualifiedColumn{construct.QC(times, "time")}}})
+	construct.Rule(q.s, ticks, "<=", construct.ColumnsOf(now, []string{"address", "time"}))
+	construct.Rule(q.s, next, "<=", []seed.Expression{construct.QC(ticks, "address"),
+		seed.ReduceFunction{Name: "max", Arguments: []seed.QualifiedColumn{construct.QC(ticks, "time")}}})
+	construct.Rule(q.s, clock, "<+-", construct.ColumnsOf(next, []string{"address", "time"}))
+}
+
+// write redirects a rule supplying a table to the scratch for its
+// operation. The scratches are replicated by replicateWrites.
+func (q *quorum) write(ruleNumber int, rule *seed.Rule) error {
+	tableName := rule.Supplies
+
+	var operation string
+	switch rule.Operation {
+	case "<+", "<=":
+		operation = "insert"
+	case "<+-":
+		operation = "update"
+	case "<-":
+		operation = "delete"
+
+		// deletes keep the version of the row they delete
+		requiresTable := false
+		for _, collectionName := range rule.Requires() {
+			if collectionName == tableName {
+				requiresTable = true
+			}
+		}
+		if !requiresTable {
+			return fmt.Errorf("rule %d deletes from %s without reading it, so the version to delete is unknown", ruleNumber, tableName)
+		}
+	default:
+		// shouldn't get here
+		panic(rule.Operation)
+	}
+
+	if q.writes[tableName] == nil {
+		q.writes[tableName] = map[string]bool{}
+	}
+	q.writes[tableName][operation] = true
+
+	table := q.orig.Collections[tableName]
+	rewritten := &seed.Rule{
+		Operation: "<=",
+		Intension: append([]seed.Expression{}, rule.Intension...),
+		Predicate: rule.Predicate,
+	}
+	switch operation {
+	case "insert", "update":
+		rewritten.Supplies = tableName + "_" + operation + "_request"
+		construct.Add(q.s, rewritten.Supplies, seed.CollectionScratch, table.Key, table.Data)
+	case "delete":
+		rewritten.Supplies = tableName + "_delete"
+		rewritten.Intension = append(rewritten.Intension, construct.QC(tableName, q.versions[tableName]))
+		construct.Add(q.s, rewritten.Supplies, seed.CollectionScratch, table.Key, q.s.Collections[tableName].Data)
+	}
+	q.s.Rules = append(q.s.Rules, rewritten)
+
+	return nil
+}
+
+// replicateWrites applies the writes to a table locally and on the
+// replicants, and collects the acknowledgements
+func (q *quorum) replicateWrites(tableName string) {
+	table := q.s.Collections[tableName]
+	version := q.versions[tableName]
+	key := table.Key
+	rows := construct.Columns(table)
+	replicants := tableName + "_replicants"
+	config := tableName + "_quorum"
+	times := tableName + "_times"
+	now := tableName + "_now"
+	ticks := tableName + "_ticks"
+
+	coordinator := construct.Unique("coordinator", rows)
+	replica := construct.Unique("replica", rows)
+
+	// writes are identified by their version and key, as the writes
+	// made by a replica in a timestep share a version
+	write := append([]string{version}, key...)
+	keyed := append(append([]string{}, key...), version)
+	applied := append(append([]string{}, keyed...), q.orig.Collections[tableName].Data...)
+
+	ack := tableName + "_ack"
+	pending := tableName + "_pending"
+	acks := tableName + "_acks"
+	ackCount := tableName + "_ack_count"
+	ackQuorum := tableName + "_ack_quorum"
+	acked := tableName + "_acked"
+	commit := tableName + "_commit"
+	written := tableName + "_written"
+
+	construct.Add(q.s, ack, seed.CollectionChannel, append([]string{"@" + coordinator, replica}, write...), nil)
+	construct.Add(q.s, pending, seed.CollectionTable, write, nil)
+	construct.Add(q.s, acks, seed.CollectionTable, append(append([]string{}, write...), replica), nil)
+	construct.Add(q.s, ackCount, seed.CollectionScratch, write, []string{"acks"})
+	construct.Add(q.s, ackQuorum, seed.CollectionScratch, write, []string{"reached"})
+	construct.Add(q.s, acked, seed.CollectionScratch, write, nil)
+	construct.Add(q.s, commit, seed.CollectionChannel, append([]string{"@address"}, write...), nil)
+	construct.Add(q.s, written, seed.CollectionTable, key, []string{version})
+
+	var incoming string
+	if q.writes[tableName]["insert"] || q.writes[tableName]["update"] {
+		incoming = q.lastWriter(tableName, version)
+	}
+
+	for _, operation := range []string{"insert", "update", "delete"} {
+		if !q.writes[tableName][operation] {
+			continue
+		}
+
+		scratch := tableName + "_" + operation
+		channel := scratch + "_channel"
+
+		// give inserts and updates new versions
+		if operation != "delete" {
+			request := scratch + "_request"
+			construct.Add(q.s, scratch, seed.CollectionScratch, key, table.Data)
+			construct.Rule(q.s, scratch, "<=",
+				append(construct.ColumnsOf(request, construct.Columns(q.orig.Collections[tableName])),
+					seed.MapFunction{Name: "quorum_version", Arguments: construct.QCs(now, []string{"time", "address"})}))
+			construct.Rule(q.s, ticks, "<=", []seed.Expression{construct.QC(now, "address"),
+				seed.MapFunction{Name: "quorum_time", Arguments: []seed.QualifiedColumn{construct.QC(scratch, version)}}})
+		}
+
+		// send to the replicants
+		construct.Add(q.s, channel, seed.CollectionChannel, append([]string{"@address", coordinator}, key...), table.Data)
+		construct.Rule(q.s, channel, "<~", append(
+			[]seed.Expression{construct.QC(replicants, "address"), construct.QC(config, "address")},
+			construct.ColumnsOf(scratch, rows)...))
+
+		// apply here and on the replicas, and acknowledge
+		if operation == "delete" {
+			construct.Rule(q.s, tableName, "<-", construct.ColumnsOf(scratch, rows))
+			construct.Rule(q.s, tableName, "<-", construct.ColumnsOf(tableName, rows),
+				join(channel, tableName, write)...)
+		} else {
+			construct.Rule(q.s, incoming, "<=", construct.ColumnsOf(scratch, applied))
+			construct.Rule(q.s, incoming, "<=", construct.ColumnsOf(channel, applied))
+		}
+		construct.Rule(q.s, times, "<=", []seed.Expression{
+			seed.MapFunction{Name: "quorum_time", Arguments: []seed.QualifiedColumn{construct.QC(channel, version)}}})
+		construct.Rule(q.s, ack, "<~", append(
+			[]seed.Expression{construct.QC(channel, coordinator), construct.QC(config, "address")},
+			construct.ColumnsOf(channel, write)...))
+
+		// wait for the acknowledgements, including this replica's
+		construct.Rule(q.s, pending, "<+", construct.ColumnsOf(scratch, write))
+		construct.Rule(q.s, acks, "<+", append(construct.ColumnsOf(scratch, write), construct.QC(config, "address")))
+	}
+
+	construct.Rule(q.s, acks, "<+", append(construct.ColumnsOf(ack, write), construct.QC(ack, replica)),
+		join(ack, pending, write)...)
+	construct.Rule(q.s, ackCount, "<=", append(construct.ColumnsOf(acks, write),
+		seed.ReduceFunction{Name: "count", Arguments: construct.QCs(acks, []string{replica})}))
+	construct.Rule(q.s, ackQuorum, "<=", append(construct.ColumnsOf(ackCount, write),
+		seed.MapFunction{Name: "quorum_reached", Arguments: []seed.QualifiedColumn{construct.QC(ackCount, "acks"), construct.QC(config, "write")}}))
+	construct.Rule(q.s, acked, "<=", construct.ColumnsOf(pending, write),
+		append(join(pending, ackQuorum, write), construct.Constraint(ackQuorum, "reached", config, "write"))...)
+
+	// the acknowledged rows can be read, here and on the replicants
+	committed := q.lastWriter(written, version)
+	construct.Rule(q.s, committed, "<=", construct.ColumnsOf(acked, keyed))
+	construct.Rule(q.s, commit, "<~", append([]seed.Expression{construct.QC(replicants, "address")}, construct.ColumnsOf(acked, write)...))
+	construct.Rule(q.s, committed, "<=", construct.ColumnsOf(commit, keyed))
+
+	// forget finished writes
+	construct.Rule(q.s, pending, "<-", construct.ColumnsOf(pending, write),
+		join(pending, acked, write)...)
+	construct.Rule(q.s, acks, "<-", construct.ColumnsOf(acks, append(append([]string{}, write...), replica)),
+		join(acks, acked, write)...)
+}
+
+// lastWriter puts the rows added to <target>_incoming into target when
+// their version is later than that of the row with the same key.
+// incoming has target's columns, with the version moved to the key.
+func (q *quorum) lastWriter(target, version string) string {
+	collection := q.s.Collections[target]
+	key := collection.Key
+	data := []string{}
+	for _, column := range collection.Data {
+		if column != version {
+			data = append(data, column)
+		}
+	}
+	keyed := append(append([]string{}, key...), version)
+	columns := append(append([]string{}, keyed...), data...)
+
+	incoming := target + "_incoming"
+	candidates := target + "_candidates"
+	latest := target + "_latest"
+	construct.Add(q.s, incoming, seed.CollectionScratch, keyed, data)
+	construct.Add(q.s, candidates, seed.CollectionScratch, keyed, data)
+	construct.Add(q.s, latest, seed.CollectionScratch, key, []string{version})
+
+	construct.Rule(q.s, candidates, "<=", construct.ColumnsOf(incoming, columns))
+	construct.Rule(q.s, candidates, "<=", construct.ColumnsOf(target, columns), join(target, incoming, key)...)
+	construct.Rule(q.s, latest, "<=", append(construct.ColumnsOf(candidates, key),
+		seed.ReduceFunction{Name: "max", Arguments: []seed.QualifiedColumn{construct.QC(candidates, version)}}))
+	construct.Rule(q.s, target, "<+-", construct.ColumnsOf(candidates, construct.Columns(collection)),
+		join(candidates, latest, keyed)...)
+
+	return incoming
+}
+
+// readable returns the table and the request collection when a rule
+// can read from a quorum: it reads one table and one collection which
+// is not a table
+func (q *quorum) readable(rule *seed.Rule) (string, string, bool) {
+	requires := rule.Requires()
+	if len(requires) != 2 {
+		return "", "", false
+	}
+
+	tableName, requestName := requires[0], requires[1]
+	if q.orig.Collections[tableName].Type != seed.CollectionTable {
+		tableName, requestName = requestName, tableName
+	}
+	if q.orig.Collections[tableName].Type != seed.CollectionTable ||
+		q.orig.Collections[requestName].Type == seed.CollectionTable {
+		return "", "", false
+	}
+
+	return tableName, requestName, true
+}
+
+// read runs a rule on the rows of a table read from a quorum
+func (q *quorum) read(ruleNumber int, rule *seed.Rule, tableName, requestName string) {
+	table := q.s.Collections[tableName]
+	version := q.versions[tableName]
+	rows := construct.Columns(table)
+	replicants := tableName + "_replicants"
+	config := tableName + "_quorum"
+	now := tableName + "_now"
+	ticks := tableName + "_ticks"
+
+	// the request's columns, without the address markers
+	request := q.orig.Collections[requestName]
+	requestColumns := []string{}
+	renamed := map[string]string{}
+	for _, column := range construct.Columns(request) {
+		renamed[column] = column
+		if column[0] == '@' {
+			renamed[column] = column[1:]
+		}
+		requestColumns = append(requestColumns, renamed[column])
+	}
+	id := construct.Unique("rid", append(append([]string{}, requestColumns...), rows...))
+	coordinator := construct.Unique("coordinator", []string{id})
+	replica := construct.Unique("replica", []string{id})
+
+	prefix := fmt.Sprintf("%s_read%d", tableName, ruleNumber)
+	fresh := prefix + "_new"
+	pending := prefix
+	requests := prefix + "_request"
+	data := prefix + "_data"
+	answered := prefix + "_answered"
+	ack := prefix + "_ack"
+	responses := prefix + "_responses"
+	acks := prefix + "_acks"
+	count := prefix + "_count"
+	reachedQuorum := prefix + "_quorum"
+	ready := prefix + "_ready"
+	latest := prefix + "_latest"
+	latestRows := prefix + "_rows"
+
+	responseKey := append(append([]string{id}, table.Key...), version)
+	construct.Add(q.s, fresh, seed.CollectionScratch, []string{id}, requestColumns)
+	construct.Add(q.s, pending, seed.CollectionTable, []string{id}, requestColumns)
+	construct.Add(q.s, requests, seed.CollectionChannel, []string{"@address", coordinator, id}, requestColumns)
+	construct.Add(q.s, data, seed.CollectionChannel, append([]string{"@" + coordinator}, responseKey...), q.orig.Collections[tableName].Data)
+	construct.Add(q.s, answered, seed.CollectionTable, []string{coordinator, id}, nil)
+	construct.Add(q.s, ack, seed.CollectionChannel, []string{"@" + coordinator, id, replica}, nil)
+	construct.Add(q.s, responses, seed.CollectionTable, responseKey, q.orig.Collections[tableName].Data)
+	construct.Add(q.s, acks, seed.CollectionTable, []string{id, replica}, nil)
+	construct.Add(q.s, count, seed.CollectionScratch, []string{id}, []string{"acks"})
+	construct.Add(q.s, reachedQuorum, seed.CollectionScratch, []string{id}, []string{"reached"})
+	construct.Add(q.s, ready, seed.CollectionScratch, []string{id}, requestColumns)
+	construct.Add(q.s, latest, seed.CollectionScratch, append([]string{id}, table.Key...), []string{version})
+	construct.Add(q.s, latestRows, seed.CollectionScratch, responseKey, q.orig.Collections[tableName].Data)
+
+	responseColumns := append(append([]string{}, responseKey...), q.orig.Collections[tableName].Data...)
+	tableColumns := append(append(append([]string{}, table.Key...), version), q.orig.Collections[tableName].Data...)
+
+	// new requests, identified by a version and the request
+	construct.Rule(q.s, fresh, "<=", append(
+		[]seed.Expression{seed.MapFunction{Name: "quorum_request", Arguments: append(construct.QCs(now, []string{"time", "address"}), construct.QCs(requestName, construct.Columns(request))...)}},
+		construct.ColumnsOf(requestName, construct.Columns(request))...))
+	construct.Rule(q.s, ticks, "<=", []seed.Expression{construct.QC(now, "address"),
+		seed.MapFunction{Name: "quorum_time", Arguments: []seed.QualifiedColumn{construct.QC(fresh, id)}}})
+	construct.Rule(q.s, pending, "<+", construct.ColumnsOf(fresh, append([]string{id}, requestColumns...)))
+	construct.Rule(q.s, requests, "<~", append(
+		[]seed.Expression{construct.QC(replicants, "address"), construct.QC(config, "address"), construct.QC(fresh, id)},
+		construct.ColumnsOf(fresh, requestColumns)...))
+
+	// answers from this replica
+	construct.Rule(q.s, responses, "<+", append([]seed.Expression{construct.QC(fresh, id)}, construct.ColumnsOf(tableName, tableColumns)...),
+		renameConstraints(rule.Predicate, requestName, fresh, renamed)...)
+	construct.Rule(q.s, acks, "<+", []seed.Expression{construct.QC(fresh, id), construct.QC(config, "address")})
+
+	// answers from the replicants: the rows, then an acknowledgement
+	construct.Rule(q.s, data, "<~", append([]seed.Expression{construct.QC(requests, coordinator), construct.QC(requests, id)}, construct.ColumnsOf(tableName, tableColumns)...),
+		renameConstraints(rule.Predicate, requestName, requests, renamed)...)
+	construct.Rule(q.s, answered, "<+", construct.ColumnsOf(requests, []string{coordinator, id}))
+	construct.Rule(q.s, ack, "<~", []seed.Expression{construct.QC(answered, coordinator), construct.QC(answered, id), construct.QC(config, "address")})
+	construct.Rule(q.s, answered, "<-", construct.ColumnsOf(answered, []string{coordinator, id}))
+
+	construct.Rule(q.s, responses, "<+", construct.ColumnsOf(data, responseColumns),
+		construct.Constraint(data, id, pending, id))
+	construct.Rule(q.s, acks, "<+", construct.ColumnsOf(ack, []string{id, replica}),
+		construct.Constraint(ack, id, pending, id))
+
+	// wait for the read quorum
+	construct.Rule(q.s, count, "<=", []seed.Expression{
+		construct.QC(acks, id),
+		seed.ReduceFunction{Name: "count", Arguments: construct.QCs(acks, []string{replica})}})
+	construct.Rule(q.s, reachedQuorum, "<=", []seed.Expression{
+		construct.QC(count, id),
+		seed.MapFunction{Name: "quorum_reached", Arguments: []seed.QualifiedColumn{construct.QC(count, "acks"), construct.QC(config, "read")}}})
+	construct.Rule(q.s, ready, "<=", construct.ColumnsOf(pending, append([]string{id}, requestColumns...)),
+		construct.Constraint(pending, id, reachedQuorum, id),
+		construct.Constraint(reachedQuorum, "reached", config, "read"))
+
+	// last writer wins
+	construct.Rule(q.s, latest, "<=", append(construct.ColumnsOf(responses, append([]string{id}, table.Key...)),
+		seed.ReduceFunction{Name: "max", Arguments: construct.QCs(responses, []string{version})}),
+		construct.Constraint(responses, id, ready, id))
+	latestConstraints := []seed.Constraint{construct.Constraint(responses, id, latest, id), construct.Constraint(responses, version, latest, version)}
+	for _, column := range table.Key {
+		latestConstraints = append(latestConstraints, construct.Constraint(responses, column, latest, column))
+	}
+	construct.Rule(q.s, latestRows, "<=", construct.ColumnsOf(responses, responseColumns), latestConstraints...)
+
+	// the original rule, on the request and the latest rows
+	rewritten := &seed.Rule{
+		Supplies:  rule.Supplies,
+		Operation: rule.Operation,
+		Predicate: append(renameConstraints(rule.Predicate, requestName, ready, renamed), construct.Constraint(ready, id, latestRows, id)),
+	}
+	for i, constraint := range rewritten.Predicate[:len(rule.Predicate)] {
+		rewritten.Predicate[i] = seed.Constraint{
+			Left:  renameColumn(constraint.Left, tableName, latestRows, nil),
+			Right: renameColumn(constraint.Right, tableName, latestRows, nil),
+		}
+	}
+	for _, expression := range rule.Intension {
+		switch value := expression.(type) {
+		case seed.QualifiedColumn:
+			value = renameColumn(value, requestName, ready, renamed)
+			expression = renameColumn(value, tableName, latestRows, nil)
+		case seed.MapFunction:
+			value.Arguments = renameColumns(value.Arguments, requestName, ready, renamed, tableName, latestRows)
+			expression = value
+		case seed.ReduceFunction:
+			value.Arguments = renameColumns(value.Arguments, requestName, ready, renamed, tableName, latestRows)
+			expression = value
+		default:
+			panic(fmt.Sprintf("unhandled type: %v", reflect.TypeOf(expression).String()))
+		}
+		rewritten.Intension = append(rewritten.Intension, expression)
+	}
+	q.s.Rules = append(q.s.Rules, rewritten)
+
+	// forget finished requests
+	construct.Rule(q.s, pending, "<-", construct.ColumnsOf(pending, append([]string{id}, requestColumns...)),
+		construct.Constraint(pending, id, ready, id))
+	construct.Rule(q.s, responses, "<-", construct.ColumnsOf(responses, responseColumns),
+		construct.Constraint(responses, id, ready, id))
+	construct.Rule(q.s, acks, "<-", construct.ColumnsOf(acks, []string{id, replica}),
+		construct.Constraint(acks, id, ready, id))
+}
+
+// renameColumn moves a reference from one collection to another,
+// renaming the column when it is in renamed
+func renameColumn(column seed.QualifiedColumn, from, to string, renamed map[string]string) seed.QualifiedColumn {
+	if column.Collection != from {
+		return column
+	}
+
+	column.Collection = to
+	if name, ok := renamed[column.Column]; ok {
+		column.Column = name
+	}
+	return column
+}
+
+func renameColumns(columns []seed.QualifiedColumn, request, ready string, renamed map[string]string, table, rows string) []seed.QualifiedColumn {
+	result := []seed.QualifiedColumn{}
+	for _, column := range columns {
+		column = renameColumn(column, request, ready, renamed)
+		result = append(result, renameColumn(column, table, rows, nil))
+	}
+	return result
+}
+
+func renameConstraints(constraints []seed.Constraint, from, to string, renamed map[string]string) []seed.Constraint {
+	result := []seed.Constraint{}
+	for _, constraint := range constraints {
+		result = append(result, seed.Constraint{
+			Left:  renameColumn(constraint.Left, from, to, renamed),
+			Right: renameColumn(constraint.Right, from, to, renamed),
+		})
+	}
+	return result
+}
+
+// join requires the columns of left to equal those of right
+func join(left, right string, columns []string) []seed.Constraint {
+	constraints := []seed.Constraint{}
+	for _, column := range columns {
+		constraints = append(constraints, construct.Constraint(left, column, right, column))
+	}
+	return constraints
+}
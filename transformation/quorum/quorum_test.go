@@ -0,0 +1,189 @@
+package quorum
+
+import (
+	"github.com/nathankerr/seed"
+	executor "github.com/nathankerr/seed/host/golang"
+	"github.com/nathankerr/seed/transformation/internal/cluster"
+	"github.com/nathankerr/seed/transformation/internal/construct"
+	"github.com/nathankerr/seed/transformation/network"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTransform(t *testing.T) {
+	service, err := Transform(construct.Load(t, "kvs", network.Transform))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = service.Validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = service.ValidateFunctions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the transformed seed must be writable as seed source
+	written, err := seed.ToSeed(service, "kvs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = seed.FromSeed("kvs", written)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	collections := map[string]string{
+		"kvstate":               "table kvstate [key] => [value, version]",
+		"kvstate_quorum":        "table kvstate_quorum [address] => [write, read]",
+		"kvstate_clock":         "table kvstate_clock [address] => [time]",
+		"kvstate_ack":           "channel kvstate_ack [@coordinator, replica, version, key]",
+		"kvstate_written":       "table kvstate_written [key] => [version]",
+		"kvstate_read2_request": "channel kvstate_read2_request [@address, coordinator, rid] => [kvget_response_addr, address, key]",
+	}
+	for collectionName, expected := range collections {
+		collection, ok := service.Collections[collectionName]
+		if !ok {
+			t.Errorf("missing %s", collectionName)
+			continue
+		}
+		if actual := collection.String(collectionName); !strings.HasPrefix(actual, expected) {
+			t.Errorf("expected %q, got %q", expected, actual)
+		}
+	}
+
+	rules := map[string]bool{
+		"kvstate_update <= [kvstate_update_request.key, kvstate_update_request.value, (quorum_version kvstate_now.time kvstate_now.address)]":                                                            false,
+		"kvstate <+- [kvstate_candidates.key, kvstate_candidates.value, kvstate_candidates.version]: kvstate_candidates.key => kvstate_latest.key, kvstate_candidates.version => kvstate_latest.version": false,
+		"kvstate <- [kvstate.key, kvstate.value, kvstate.version]: kvstate_delete_channel.version => kvstate.version, kvstate_delete_channel.key => kvstate.key":                                         false,
+		"kvstate_clock <+- [kvstate_next.address, kvstate_next.time]":              false,
+		"kvstate_written_incoming <= [kvstate_commit.key, kvstate_commit.version]": false,
+		"kvget_response <~ [kvstate_read2_ready.kvget_response_addr, kvstate_read2_rows.key, kvstate_read2_rows.value]: kvstate_read2_ready.key => kvstate_read2_rows.key, kvstate_read2_ready.rid => kvstate_read2_rows.rid": false,
+	}
+	for _, rule := range service.Rules {
+		if _, ok := rules[rule.String()]; ok {
+			rules[rule.String()] = true
+		}
+	}
+	for rule, found := range rules {
+		if !found {
+			t.Errorf("missing rule %s", rule)
+		}
+	}
+}
+
+func TestVersion(t *testing.T) {
+	first := version(seed.Tuple{0, "b:2"}).(string)
+	later := version(seed.Tuple{1.0, "a:1"}).(string)
+	concurrent := version(seed.Tuple{int8(1), "b:2"}).(string)
+
+	if first >= later {
+		t.Errorf("expected %s to sort before %s", first, later)
+	}
+	if later >= concurrent {
+		t.Errorf("expected the replica to order %s and %s", later, concurrent)
+	}
+	if time := versionTime(seed.Tuple{concurrent}); time != int64(2) {
+		t.Errorf("expected the time of %s to be 2, got %v", concurrent, time)
+	}
+}
+
+// start configures the replicas of table in c, each with the write and
+// read quorums
+func start(c *cluster.Cluster, table string, write, read int) {
+	for address := range c.Instances {
+		for replicant := range c.Instances {
+			if replicant != address {
+				c.Send(address, table+"_replicants", seed.Tuple{replicant})
+			}
+		}
+		c.Send(address, table+"_quorum", seed.Tuple{address, write, read})
+		c.Send(address, table+"_clock", seed.Tuple{address, 0})
+	}
+	time.Sleep(50 * time.Millisecond)
+}
+
+// TestWriteQuorum runs three replicas of a store which sends its rows
+// to their clients. r3 does not acknowledge writes, so the rows are
+// only sent when two acknowledgements are enough.
+func TestWriteQuorum(t *testing.T) {
+	source := "table store [key] => [client, value]\n" +
+		"channel put [@address, client, key] => [value]\n" +
+		"channel stored [@client, key] => [value]\n" +
+		"store <+ [put.key, put.client, put.value]\n" +
+		"stored <~ [store.client, store.key, store.value]\n"
+	load := func() *seed.Seed {
+		service, err := seed.FromSeed("store", []byte(source))
+		if err != nil {
+			t.Fatal(err)
+		}
+		service, err = Transform(service)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return service
+	}
+
+	for _, write := range []int{3, 2} {
+		c := cluster.Run(t, load, "r1", "r2", "r3")
+		c.Drop(func(from string, message executor.MessageContainer) bool {
+			return from == "r3" && message.Collection == "store_ack"
+		})
+		start(c, "store", write, 1)
+
+		c.Send("r1", "put", seed.Tuple{"r1", "client", "a", "1"})
+		tuple, ok := c.Receive("stored", 500*time.Millisecond)
+		switch {
+		case write == 3 && ok:
+			t.Errorf("with W=3, the row should wait for r3's acknowledgement, got %v", tuple)
+		case write == 2 && !ok:
+			t.Error("with W=2, the row should be sent once r2 acknowledged it")
+		case write == 2 && tuple[2] != "1":
+			t.Errorf("expected the value 1, got %v", tuple)
+		}
+	}
+}
+
+// TestLastWriterWins writes a key three times at r1, then once at r2,
+// which has seen r1's writes. r2's write is the last, though r1 has
+// written more, so a read from every replica returns it.
+func TestLastWriterWins(t *testing.T) {
+	c := cluster.Run(t, func() *seed.Seed {
+		service, err := Transform(construct.Load(t, "kvs", network.Transform))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return service
+	}, "r1", "r2", "r3")
+	start(c, "kvstate", 3, 3)
+	// r2 reads only its own replica
+	c.Send("r2", "kvstate_quorum", seed.Tuple{"r2", 3, 1})
+	time.Sleep(50 * time.Millisecond)
+
+	// get polls a replica until it returns value
+	get := func(address, value string) bool {
+		for i := 0; i < 50; i++ {
+			c.Send(address, "kvget", seed.Tuple{"client", address, "a"})
+			if tuple, ok := c.Receive("kvget_response", 100*time.Millisecond); ok && tuple[2] == value {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, value := range []string{"1", "2", "3"} {
+		c.Send("r1", "kvput", seed.Tuple{"r1", "a", value})
+		if !get("r2", value) {
+			t.Fatalf("r2 should have received r1's write of %s", value)
+		}
+	}
+
+	c.Send("r2", "kvput", seed.Tuple{"r2", "a", "4"})
+	if !get("r3", "4") {
+		t.Error("a read from every replica should return r2's write, the last")
+	}
+}
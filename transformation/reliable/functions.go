@@ -0,0 +1,98 @@
+package reliable
+
+import (
+	"fmt"
+	"github.com/nathankerr/seed"
+	"math/rand"
+	"time"
+)
+
+// The functions used by the rules Transform adds.
+func init() {
+	seed.RegisterMap("reliable_id", id)
+	seed.RegisterMap("reliable_new", unseen)
+	seed.RegisterMap("reliable_seen", seen)
+	seed.RegisterMap("reliable_fresh", fresh)
+	seed.RegisterMap("reliable_expired", expired)
+	seed.RegisterMap("reliable_current", current)
+	seed.RegisterMap("reliable_below", below)
+}
+
+// id returns a new message id, unique with high probability: the time
+// it was made, in nanoseconds, and a random suffix. Later ids sort after
+// earlier ones.
+func id(arguments seed.Tuple) seed.Element {
+	return fmt.Sprintf("%020d.%08x", time.Now().UnixNano(), rand.Uint32())
+}
+
+// expired returns its first argument, a message id, when more than its
+// second argument, the timeout in seconds, has passed since the id was
+// made; otherwise nil. Joining the result with the outbox keeps the
+// messages to give up.
+func expired(arguments seed.Tuple) seed.Element {
+	var made int64
+	_, err := fmt.Sscanf(fmt.Sprint(arguments[0]), "%d.", &made)
+	if err != nil {
+		panic(err)
+	}
+
+	var seconds float64
+	switch timeout := arguments[1].(type) {
+	case int:
+		seconds = float64(timeout)
+	case int64:
+		seconds = float64(timeout)
+	case float64:
+		seconds = timeout
+	default:
+		panic(fmt.Sprintf("timeout %v is not a number", timeout))
+	}
+
+	if time.Since(time.Unix(0, made)).Seconds() > seconds {
+		return arguments[0]
+	}
+	return nil
+}
+
+// current returns its first argument, a message id, when it is not
+// below its second, the sender's mark; otherwise nil
+func current(arguments seed.Tuple) seed.Element {
+	if below(arguments) != nil {
+		return nil
+	}
+	return arguments[0]
+}
+
+// below returns its first argument, a message id, when it is below its
+// second, the sender's mark; otherwise nil
+func below(arguments seed.Tuple) seed.Element {
+	comparison, err := seed.Compare(arguments[0], arguments[1])
+	if err != nil {
+		panic(err)
+	}
+
+	if comparison < 0 {
+		return arguments[0]
+	}
+	return nil
+}
+
+// unseen marks a message which has just arrived
+func unseen(arguments seed.Tuple) seed.Element {
+	return false
+}
+
+// seen marks a message which was received before
+func seen(arguments seed.Tuple) seed.Element {
+	return true
+}
+
+// fresh returns its second argument, a message id, when its first, the
+// largest mark of the message, shows it has not been seen; otherwise
+// nil. Joining the result with the message ids drops the duplicates.
+func fresh(arguments seed.Tuple) seed.Element {
+	if arguments[0] == true {
+		return nil
+	}
+	return arguments[1]
+}
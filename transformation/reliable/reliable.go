@@ -0,0 +1,294 @@
+// Package reliable adds at-least-once delivery with duplicate
+// suppression to the channels of a Seed
+package reliable
+
+import (
+	"fmt"
+	"github.com/nathankerr/seed"
+	"github.com/nathankerr/seed/transformation/internal/construct"
+	"reflect"
+	"sort"
+)
+
+// Transform makes the channels which a Seed both sends and receives,
+// i.e., those between its instances, reliable. Channels to and from
+// clients are left alone, as clients do not run the Seed and so would
+// neither number nor acknowledge their messages.
+//
+// Two tables must be filled in when each instance starts:
+//
+//	reliable_self [address]           this instance's address
+//	reliable_timeout [seconds]        how long a message is resent
+//	                                  before it is given up
+//
+// Each message sent on a channel gets an id, which sorts after the ids
+// of earlier messages, and is kept in <channel>_outbox, keyed by its
+// destination and id, until the destination acknowledges it on
+// <channel>_ack or the timeout passes. The messages in the outbox are
+// resent every timestep. The messages are sent on <channel>_data along
+// with the sender's address, their id and a mark, the smallest id the
+// sender has not given up which the destination has not acknowledged.
+//
+// Receivers acknowledge every copy, but only pass a message to the
+// rules reading the channel the first time it arrives. The ids of the
+// received messages are kept in <channel>_received until they are
+// below the sender's mark, which is kept in <channel>_marks; copies
+// with ids below the mark are dropped.
+//
+// Run it after the transformations adding channels.
+func Transform(orig *seed.Seed) (*seed.Seed, error) {
+	for _, name := range []string{self, timeout} {
+		if _, ok := orig.Collections[name]; ok {
+			return nil, fmt.Errorf("%s is used by the transformation", name)
+		}
+	}
+
+	r := &reliable{
+		orig: orig,
+		s: &seed.Seed{
+			Name:        orig.Name,
+			Collections: make(map[string]*seed.Collection),
+		},
+		renamed: map[string]map[string]string{},
+	}
+
+	sent := map[string]bool{}
+	received := map[string]bool{}
+	for _, rule := range orig.Rules {
+		sent[rule.Supplies] = true
+		for _, collectionName := range rule.Requires() {
+			received[collectionName] = true
+		}
+	}
+
+	channelNames := []string{}
+	for collectionName, collection := range orig.Collections {
+		r.s.Collections[collectionName] = collection
+		if collection.Type == seed.CollectionChannel && sent[collectionName] && received[collectionName] {
+			channelNames = append(channelNames, collectionName)
+		}
+	}
+	sort.Strings(channelNames)
+
+	construct.Add(r.s, self, seed.CollectionTable, []string{"address"}, nil)
+	construct.Add(r.s, timeout, seed.CollectionTable, []string{"seconds"}, nil)
+
+	for _, channelName := range channelNames {
+		r.deliver(channelName)
+	}
+
+	for _, rule := range orig.Rules {
+		r.s.Rules = append(r.s.Rules, r.rewrite(rule))
+	}
+
+	return r.s, nil
+}
+
+// The collections added by Transform
+const (
+	self    = "reliable_self"
+	timeout = "reliable_timeout"
+)
+
+type reliable struct {
+	orig    *seed.Seed
+	s       *seed.Seed
+	renamed map[string]map[string]string // channel: column: column without the address marker
+}
+
+// deliver adds the collections and rules sending and receiving the
+// messages of a channel
+func (r *reliable) deliver(channelName string) {
+	channel := r.orig.Collections[channelName]
+	channelColumns := construct.Columns(channel)
+	address, _ := channel.AddressColumn()
+
+	// the address markers are only allowed in channels
+	renamed := map[string]string{}
+	plainKey := []string{}
+	plainData := []string{}
+	for i, column := range channelColumns {
+		renamed[column] = column
+		if column[0] == '@' {
+			renamed[column] = column[1:]
+		}
+		if i < len(channel.Key) {
+			plainKey = append(plainKey, renamed[column])
+		} else {
+			plainData = append(plainData, renamed[column])
+		}
+	}
+	r.renamed[channelName] = renamed
+	plain := append(append([]string{}, plainKey...), plainData...)
+	destination := plain[address]
+	id := construct.Unique("id", plain)
+	sender := construct.Unique("sender", append(plain, id))
+	mark := construct.Unique("mark", append(plain, id, sender))
+
+	send := channelName + "_send"
+	numbered := channelName + "_numbered"
+	outbox := channelName + "_outbox"
+	pending := channelName + "_pending"
+	low := channelName + "_low"
+	expired := channelName + "_expired"
+	data := channelName + "_data"
+	ack := channelName + "_ack"
+	arrived := channelName + "_arrived"
+	bounds := channelName + "_bounds"
+	bound := channelName + "_bound"
+	marks := channelName + "_marks"
+	current := channelName + "_current"
+	copies := channelName + "_copies"
+	seenMarks := channelName + "_seen"
+	freshIDs := channelName + "_fresh"
+	receivedIDs := channelName + "_received"
+	forgotten := channelName + "_forgotten"
+	delivered := channelName + "_delivered"
+
+	construct.Add(r.s, send, seed.CollectionScratch, plainKey, plainData)
+	construct.Add(r.s, numbered, seed.CollectionScratch, append(append([]string{}, plainKey...), id), plainData)
+	construct.Add(r.s, outbox, seed.CollectionTable, append(append([]string{}, plainKey...), id), plainData)
+	construct.Add(r.s, pending, seed.CollectionScratch, []string{"destination", "id"}, nil)
+	construct.Add(r.s, low, seed.CollectionScratch, []string{"destination"}, []string{"mark"})
+	construct.Add(r.s, expired, seed.CollectionScratch, []string{"destination", "id"}, nil)
+	construct.Add(r.s, data, seed.CollectionChannel, append([]string{sender, id, mark}, channel.Key...), channel.Data)
+	construct.Add(r.s, ack, seed.CollectionChannel, []string{"@sender", "receiver", "id"}, nil)
+	construct.Add(r.s, arrived, seed.CollectionScratch, append([]string{sender, id, mark}, plainKey...), plainData)
+	construct.Add(r.s, bounds, seed.CollectionScratch, []string{"sender", "mark"}, nil)
+	construct.Add(r.s, bound, seed.CollectionScratch, []string{"sender"}, []string{"mark"})
+	construct.Add(r.s, marks, seed.CollectionTable, []string{"sender"}, []string{"mark"})
+	construct.Add(r.s, current, seed.CollectionScratch, []string{"sender", "id"}, nil)
+	construct.Add(r.s, copies, seed.CollectionScratch, []string{"sender", "id", "seen"}, nil)
+	construct.Add(r.s, seenMarks, seed.CollectionScratch, []string{"sender", "id"}, []string{"seen"})
+	construct.Add(r.s, freshIDs, seed.CollectionScratch, []string{"sender", "id"}, nil)
+	construct.Add(r.s, receivedIDs, seed.CollectionTable, []string{"sender", "id"}, nil)
+	construct.Add(r.s, forgotten, seed.CollectionScratch, []string{"sender", "id"}, nil)
+	construct.Add(r.s, delivered, seed.CollectionScratch, plainKey, plainData)
+
+	// number the messages and keep them until they are acknowledged or
+	// given up
+	numberedColumns := append(append(append([]string{}, plainKey...), id), plainData...)
+	construct.Rule(r.s, numbered, "<=", append(append(construct.ColumnsOf(send, plainKey),
+		seed.MapFunction{Name: "reliable_id", Arguments: construct.QCs(send, plain)}),
+		construct.ColumnsOf(send, plainData)...))
+	construct.Rule(r.s, outbox, "<+", construct.ColumnsOf(numbered, numberedColumns))
+	construct.Rule(r.s, outbox, "<-", construct.ColumnsOf(outbox, numberedColumns),
+		construct.Constraint(outbox, id, ack, "id"),
+		construct.Constraint(outbox, destination, ack, "receiver"),
+		construct.Constraint(ack, "@sender", self, "address"))
+	construct.Rule(r.s, expired, "<=", []seed.Expression{construct.QC(outbox, destination),
+		seed.MapFunction{Name: "reliable_expired", Arguments: []seed.QualifiedColumn{construct.QC(outbox, id), construct.QC(timeout, "seconds")}}})
+	construct.Rule(r.s, outbox, "<-", construct.ColumnsOf(outbox, numberedColumns),
+		construct.Constraint(outbox, destination, expired, "destination"),
+		construct.Constraint(outbox, id, expired, "id"))
+
+	// the mark sent to each destination
+	construct.Rule(r.s, pending, "<=", []seed.Expression{construct.QC(numbered, destination), construct.QC(numbered, id)})
+	construct.Rule(r.s, pending, "<=", []seed.Expression{construct.QC(outbox, destination), construct.QC(outbox, id)})
+	construct.Rule(r.s, low, "<=", []seed.Expression{construct.QC(pending, "destination"),
+		seed.ReduceFunction{Name: "min", Arguments: construct.QCs(pending, []string{"id"})}})
+
+	// send them now, and again each timestep until they are acknowledged
+	for _, messages := range []string{numbered, outbox} {
+		construct.Rule(r.s, data, "<~", append([]seed.Expression{construct.QC(self, "address"), construct.QC(messages, id), construct.QC(low, "mark")}, construct.ColumnsOf(messages, plain)...),
+			construct.Constraint(messages, destination, low, "destination"))
+	}
+
+	// sent messages are also kept in the sending channel, so only those
+	// addressed to this instance have arrived
+	construct.Rule(r.s, arrived, "<=", construct.ColumnsOf(data, construct.Columns(r.s.Collections[data])),
+		construct.Constraint(data, channelColumns[address], self, "address"))
+	construct.Rule(r.s, ack, "<~", []seed.Expression{construct.QC(arrived, sender), construct.QC(self, "address"), construct.QC(arrived, id)})
+
+	// the largest mark from each sender; the messages below it were
+	// received or given up
+	construct.Rule(r.s, bounds, "<=", []seed.Expression{construct.QC(arrived, sender), construct.QC(arrived, mark)})
+	construct.Rule(r.s, bounds, "<=", []seed.Expression{construct.QC(marks, "sender"), construct.QC(marks, "mark")},
+		construct.Constraint(marks, "sender", arrived, sender))
+	construct.Rule(r.s, bound, "<=", []seed.Expression{construct.QC(bounds, "sender"),
+		seed.ReduceFunction{Name: "max", Arguments: construct.QCs(bounds, []string{"mark"})}})
+	construct.Rule(r.s, marks, "<+-", construct.ColumnsOf(bound, []string{"sender", "mark"}))
+	construct.Rule(r.s, current, "<=", []seed.Expression{construct.QC(arrived, sender),
+		seed.MapFunction{Name: "reliable_current", Arguments: []seed.QualifiedColumn{construct.QC(arrived, id), construct.QC(bound, "mark")}}},
+		construct.Constraint(arrived, sender, bound, "sender"))
+
+	// deliver the current messages which have not been seen before
+	construct.Rule(r.s, copies, "<=", []seed.Expression{construct.QC(current, "sender"), construct.QC(current, "id"),
+		seed.MapFunction{Name: "reliable_new", Arguments: construct.QCs(current, []string{"id"})}})
+	construct.Rule(r.s, copies, "<=", []seed.Expression{construct.QC(receivedIDs, "sender"), construct.QC(receivedIDs, "id"),
+		seed.MapFunction{Name: "reliable_seen", Arguments: construct.QCs(receivedIDs, []string{"id"})}},
+		construct.Constraint(receivedIDs, "sender", current, "sender"),
+		construct.Constraint(receivedIDs, "id", current, "id"))
+	construct.Rule(r.s, seenMarks, "<=", []seed.Expression{construct.QC(copies, "sender"), construct.QC(copies, "id"),
+		seed.ReduceFunction{Name: "max", Arguments: construct.QCs(copies, []string{"seen"})}})
+	construct.Rule(r.s, freshIDs, "<=", []seed.Expression{construct.QC(seenMarks, "sender"),
+		seed.MapFunction{Name: "reliable_fresh", Arguments: construct.QCs(seenMarks, []string{"seen", "id"})}})
+	construct.Rule(r.s, delivered, "<=", construct.ColumnsOf(arrived, plain),
+		construct.Constraint(arrived, sender, freshIDs, "sender"),
+		construct.Constraint(arrived, id, freshIDs, "id"))
+	construct.Rule(r.s, receivedIDs, "<+", construct.ColumnsOf(freshIDs, []string{"sender", "id"}),
+		construct.Constraint(freshIDs, "id", arrived, id))
+
+	// forget the ids below the mark
+	construct.Rule(r.s, forgotten, "<=", []seed.Expression{construct.QC(receivedIDs, "sender"),
+		seed.MapFunction{Name: "reliable_below", Arguments: []seed.QualifiedColumn{construct.QC(receivedIDs, "id"), construct.QC(bound, "mark")}}},
+		construct.Constraint(receivedIDs, "sender", bound, "sender"))
+	construct.Rule(r.s, receivedIDs, "<-", construct.ColumnsOf(receivedIDs, []string{"sender", "id"}),
+		construct.Constraint(receivedIDs, "sender", forgotten, "sender"),
+		construct.Constraint(receivedIDs, "id", forgotten, "id"))
+}
+
+// rewrite returns a rule sending on, and reading from, the reliable
+// versions of the channels
+func (r *reliable) rewrite(rule *seed.Rule) *seed.Rule {
+	rewritten := &seed.Rule{
+		Supplies:  rule.Supplies,
+		Operation: rule.Operation,
+	}
+	if _, ok := r.renamed[rule.Supplies]; ok {
+		rewritten.Supplies = rule.Supplies + "_send"
+		rewritten.Operation = "<="
+	}
+
+	for _, expression := range rule.Intension {
+		switch value := expression.(type) {
+		case seed.QualifiedColumn:
+			expression = r.rename(value)
+		case seed.MapFunction:
+			value.Arguments = r.renameAll(value.Arguments)
+			expression = value
+		case seed.ReduceFunction:
+			value.Arguments = r.renameAll(value.Arguments)
+			expression = value
+		default:
+			panic(fmt.Sprintf("unhandled type: %v", reflect.TypeOf(expression).String()))
+		}
+		rewritten.Intension = append(rewritten.Intension, expression)
+	}
+	for _, constraint := range rule.Predicate {
+		rewritten.Predicate = append(rewritten.Predicate, seed.Constraint{
+			Left:  r.rename(constraint.Left),
+			Right: r.rename(constraint.Right),
+		})
+	}
+	return rewritten
+}
+
+// rename moves references to reliable channels to their delivered
+// scratches
+func (r *reliable) rename(column seed.QualifiedColumn) seed.QualifiedColumn {
+	renamed, ok := r.renamed[column.Collection]
+	if !ok {
+		return column
+	}
+
+	return construct.QC(column.Collection+"_delivered", renamed[column.Column])
+}
+
+func (r *reliable) renameAll(columns []seed.QualifiedColumn) []seed.QualifiedColumn {
+	renamed := []seed.QualifiedColumn{}
+	for _, column := range columns {
+		renamed = append(renamed, r.rename(column))
+	}
+	return renamed
+}
@@ -0,0 +1,150 @@
+package reliable
+
+import (
+	"github.com/nathankerr/seed"
+	executor "github.com/nathankerr/seed/host/golang"
+	"github.com/nathankerr/seed/transformation/internal/construct"
+	"github.com/nathankerr/seed/transformation/network"
+	"github.com/nathankerr/seed/transformation/replicate"
+	"testing"
+	"time"
+)
+
+func TestTransform(t *testing.T) {
+	service, err := Transform(construct.Load(t, "kvs", network.Transform, replicate.Transform))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = service.Validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = service.ValidateFunctions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the channels between replicas are made reliable; clients do
+	// not acknowledge messages
+	for _, name := range []string{"kvput_outbox", "kvget_response_outbox", "kvstate_update_channel_outbox"} {
+		_, ok := service.Collections[name]
+		if ok != (name == "kvstate_update_channel_outbox") {
+			t.Errorf("%s: expected %v, got %v", name, !ok, ok)
+		}
+	}
+
+	rules := map[string]bool{
+		"kvstate_update_channel_send <= [kvstate_replicants.address, kvstate_update.key, kvstate_update.value]": false,
+		"kvstate_update_channel_data <~ [reliable_self.address, kvstate_update_channel_outbox.id, kvstate_update_channel_low.mark, kvstate_update_channel_outbox.address, kvstate_update_channel_outbox.key, kvstate_update_channel_outbox.value]: kvstate_update_channel_outbox.address => kvstate_update_channel_low.destination": false,
+		"kvstate_update_channel_received <- [kvstate_update_channel_received.sender, kvstate_update_channel_received.id]: kvstate_update_channel_received.sender => kvstate_update_channel_forgotten.sender, kvstate_update_channel_received.id => kvstate_update_channel_forgotten.id":                                             false,
+		"kvstate_update_channel_ack <~ [kvstate_update_channel_arrived.sender, reliable_self.address, kvstate_update_channel_arrived.id]":                                                                                                                                                                                           false,
+		"kvstate <+- [kvstate_update_channel_delivered.key, kvstate_update_channel_delivered.value]":                                                                                                                                                                                                                                false,
+	}
+	for _, rule := range service.Rules {
+		if _, ok := rules[rule.String()]; ok {
+			rules[rule.String()] = true
+		}
+	}
+	for rule, found := range rules {
+		if !found {
+			t.Errorf("missing rule %s", rule)
+		}
+	}
+}
+
+// TestRetransmit runs two instances, a and b, connected by a network
+// which drops the first message from a to b. The message is resent
+// until b acknowledges it, and b delivers it once.
+func TestRetransmit(t *testing.T) {
+	source := "input in [to, client, value]\n" +
+		"channel message [@to, client, value]\n" +
+		"channel out [@client, value]\n" +
+		"message <~ [in.to, in.client, in.value]\n" +
+		"out <~ [message.client, message.value]\n"
+
+	instances := map[string]executor.Channels{}
+	network := make(chan executor.MessageContainer, 100)
+	for _, address := range []string{"a", "b"} {
+		service, err := seed.FromSeed("retransmit", []byte(source))
+		if err != nil {
+			t.Fatal(err)
+		}
+		service, err = Transform(service)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = service.BindFunctions()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		channels := executor.Execute(service, time.Millisecond, "", false, executor.Options{})
+		for _, prefix := range []string{"a", "b", "client"} {
+			channels.Distribution <- executor.MessageContainer{
+				Operation:  "register",
+				Collection: prefix,
+				Data:       []seed.Tuple{{network}},
+			}
+		}
+		channels.Collections[self] <- executor.MessageContainer{Operation: "<~", Collection: self, Data: []seed.Tuple{{address}}}
+		channels.Collections[timeout] <- executor.MessageContainer{Operation: "<~", Collection: timeout, Data: []seed.Tuple{{60}}}
+		instances[address] = channels
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	instances["a"].Collections["in"] <- executor.MessageContainer{
+		Operation:  "<~",
+		Collection: "in",
+		Data:       []seed.Tuple{{"b", "client", "hello"}},
+	}
+
+	// the distributers send each message to every communicator, so the
+	// network routes them by their address
+	copies := 0
+	delivered := 0
+	deadline := time.After(5 * time.Second)
+	quiet := time.After(time.Hour)
+	for {
+		select {
+		case message := <-network:
+			message.Operation = "<~"
+			tuple := message.Data[0]
+			switch message.Collection {
+			case "message_data":
+				// [sender, id, mark, @to, client, value]
+				if tuple[0] != "a" || tuple[3] != "b" {
+					continue
+				}
+				copies++
+				if copies == 1 {
+					continue
+				}
+				go func() { instances["b"].Collections[message.Collection] <- message }()
+			case "message_ack":
+				// [@sender, receiver, id]
+				if tuple[0] != "a" {
+					continue
+				}
+				go func() { instances["a"].Collections[message.Collection] <- message }()
+			case "out":
+				delivered++
+				if tuple[1] != "hello" {
+					t.Errorf("expected hello, got %v", tuple)
+				}
+				quiet = time.After(200 * time.Millisecond)
+			}
+		case <-quiet:
+			if copies < 2 {
+				t.Errorf("expected the message to be resent, got %d copies", copies)
+			}
+			if delivered != 1 {
+				t.Errorf("expected the message to be delivered once, got %d", delivered)
+			}
+			return
+		case <-deadline:
+			t.Fatalf("timed out after %d copies and %d deliveries", copies, delivered)
+		}
+	}
+}
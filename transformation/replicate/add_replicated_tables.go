@@ -5,7 +5,9 @@ import (
 	"github.com/nathankerr/seed"
 )
 
-// Transform adds table replication using a simple mechanism
+// Transform adds table replication using a simple mechanism. Lattices
+// are replicated by merging the writes into each replica, and or-sets
+// by removing from each replica what is removed from one.
 func Transform(orig *seed.Seed) (*seed.Seed, error) {
 	replicated := &seed.Seed{
 		Name:        orig.Name,
@@ -16,11 +18,26 @@ func Transform(orig *seed.Seed) (*seed.Seed, error) {
 	handleDelete := false
 	handleUpdate := false
 	insertOperation := map[string]string{}
+	mergeOperation := map[string]string{}
+	removes := map[string]bool{}
 
 	// rewrite and append rules from orig
 	for _, rule := range orig.Rules {
-		// rewrite rules feeding tables
-		if orig.Collections[rule.Supplies].Type == seed.CollectionTable {
+		// rewrite rules feeding lattices, which only <= and <+ can, and
+		// <- for or-sets
+		if orig.Collections[rule.Supplies].Type.Lattice() {
+			if rule.Operation == "<-" {
+				removes[rule.Supplies] = true
+				rule.Supplies += "_remove"
+			} else {
+				if mergeOperation[rule.Supplies] != "<=" {
+					mergeOperation[rule.Supplies] = rule.Operation
+				}
+				rule.Supplies += "_merge"
+			}
+			rule.Operation = "<="
+		} else if orig.Collections[rule.Supplies].Type == seed.CollectionTable {
+			// rewrite rules feeding tables
 			switch rule.Operation {
 			case "<+", "<=":
 				rule.Supplies += "_insert"
@@ -47,6 +64,15 @@ func Transform(orig *seed.Seed) (*seed.Seed, error) {
 	// add helper tables, rules
 	for tname, table := range orig.Collections {
 		replicated.Collections[tname] = table
+		if table.Type.Lattice() {
+			if operation, ok := mergeOperation[tname]; ok {
+				replicateLattice(replicated, tname, table, "merge", operation)
+			}
+			if removes[tname] {
+				replicateLattice(replicated, tname, table, "remove", "<-")
+			}
+			continue
+		}
 		if table.Type != seed.CollectionTable {
 			continue
 		}
@@ -196,3 +222,71 @@ func Transform(orig *seed.Seed) (*seed.Seed, error) {
 
 	return replicated, nil
 }
+
+// replicateLattice sends the rows written to a lattice to the other
+// replicas, which merge them into theirs. Merges can be repeated and
+// applied in any order, so the replicas converge once every write has
+// arrived; run the reliable transformation afterwards when messages
+// may be lost. The rows removed from an or-set, the "remove" kind, are
+// removed from the other replicas, which merges in tombstones and so
+// also converges.
+func replicateLattice(replicated *seed.Seed, tname string, table *seed.Collection, kind string, operation string) {
+	replicantsName := fmt.Sprintf("%s_replicants", tname)
+	replicated.Collections[replicantsName] = &seed.Collection{
+		Type: seed.CollectionTable,
+		Key:  []string{"address"},
+	}
+
+	// writes with the same key are all merged, so the collections they
+	// pass through are keyed by all the columns
+	columns := append(append([]string{}, table.Key...), table.Data...)
+
+	// scratch used to intercept the writes
+	scratchName := fmt.Sprintf("%s_%s", tname, kind)
+	replicated.Collections[scratchName] = &seed.Collection{
+		Type: seed.CollectionScratch,
+		Key:  columns,
+	}
+
+	// channel used for inter-replicant communication
+	channelName := fmt.Sprintf("%s_%s_channel", tname, kind)
+	replicated.Collections[channelName] = &seed.Collection{
+		Type: seed.CollectionChannel,
+		Key:  append([]string{"@address"}, columns...),
+	}
+
+	columnsOf := func(collectionName string) []seed.Expression {
+		expressions := []seed.Expression{}
+		for _, column := range columns {
+			expressions = append(expressions, seed.QualifiedColumn{
+				Collection: collectionName,
+				Column:     column,
+			})
+		}
+		return expressions
+	}
+	replicants := seed.QualifiedColumn{Collection: replicantsName, Column: "address"}
+
+	// the writes are merged into the lattice and sent to the other replicas
+	replicated.Rules = append(replicated.Rules, &seed.Rule{
+		Supplies:  tname,
+		Operation: operation,
+		Intension: columnsOf(scratchName),
+	})
+	replicated.Rules = append(replicated.Rules, &seed.Rule{
+		Supplies:  channelName,
+		Operation: "<~",
+		Intension: append([]seed.Expression{replicants}, columnsOf(scratchName)...),
+	})
+
+	// rows from the other replicas are merged in, or removed
+	remote := "<+"
+	if kind == "remove" {
+		remote = "<-"
+	}
+	replicated.Rules = append(replicated.Rules, &seed.Rule{
+		Supplies:  tname,
+		Operation: remote,
+		Intension: columnsOf(channelName),
+	})
+}
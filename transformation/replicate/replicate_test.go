@@ -0,0 +1,127 @@
+package replicate
+
+import (
+	"github.com/nathankerr/seed"
+	executor "github.com/nathankerr/seed/host/golang"
+	"github.com/nathankerr/seed/transformation/internal/cluster"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestLatticesConverge runs two replicas, a and b, which each add a
+// visitor to the same page. Both end up with both visitors.
+func TestLatticesConverge(t *testing.T) {
+	source := "input visit [page] => [visitor]\n" +
+		"lset visitors [page] => [visitor]\n" +
+		"visitors <+ [visit.page, visit.visitor]\n"
+
+	replicas := map[string]executor.Channels{}
+	network := make(chan executor.MessageContainer, 100)
+	for address, other := range map[string]string{"a": "b", "b": "a"} {
+		service, err := seed.FromSeed("converge", []byte(source))
+		if err != nil {
+			t.Fatal(err)
+		}
+		service, err = Transform(service)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		channels := executor.Execute(service, time.Millisecond, "", true, executor.Options{})
+		channels.Distribution <- executor.MessageContainer{
+			Operation:  "register",
+			Collection: other,
+			Data:       []seed.Tuple{{network}},
+		}
+		channels.Collections["visitors_replicants"] <- executor.MessageContainer{
+			Operation:  "<~",
+			Collection: "visitors_replicants",
+			Data:       []seed.Tuple{{other}},
+		}
+		replicas[address] = channels
+	}
+
+	// [@address, page, visitor]
+	go func() {
+		for message := range network {
+			message.Operation = "<~"
+			replicas[message.Data[0][0].(string)].Collections[message.Collection] <- message
+		}
+	}()
+
+	replicas["a"].Collections["visit"] <- executor.MessageContainer{Operation: "<~", Collection: "visit", Data: []seed.Tuple{{"home", "x"}}}
+	replicas["b"].Collections["visit"] <- executor.MessageContainer{Operation: "<~", Collection: "visit", Data: []seed.Tuple{{"home", "y"}}}
+
+	expected := []seed.Tuple{{"home", []interface{}{"x", "y"}}}
+	converged := map[string]bool{}
+	deadline := time.After(5 * time.Second)
+	for len(converged) < len(replicas) {
+		for address, channels := range replicas {
+			select {
+			case message := <-channels.Monitor:
+				if message.Block == "visitors" && reflect.DeepEqual(message.Data, expected) {
+					converged[address] = true
+				}
+			case <-deadline:
+				t.Fatalf("timed out; converged: %v", converged)
+			default:
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}
+}
+
+// TestOrsetRemove runs two replicas, a and b, of an or-set. b removes
+// the item it has seen while a adds another; both end up with only the
+// added one.
+func TestOrsetRemove(t *testing.T) {
+	source := "input add [session] => [items]\n" +
+		"input clear [session]\n" +
+		"input look [client, session]\n" +
+		"lorset carts [session] => [items]\n" +
+		"channel show [@client, session] => [items]\n" +
+		"carts <+ [add.session, add.items]\n" +
+		"carts <- [carts.session, carts.items]: clear.session => carts.session\n" +
+		"show <~ [look.client, carts.session, carts.items]: look.session => carts.session\n"
+
+	c := cluster.Run(t, func() *seed.Seed {
+		service, err := seed.FromSeed("orset", []byte(source))
+		if err != nil {
+			t.Fatal(err)
+		}
+		service, err = Transform(service)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return service
+	}, "a", "b")
+	c.Send("a", "carts_replicants", seed.Tuple{"b"})
+	c.Send("b", "carts_replicants", seed.Tuple{"a"})
+	time.Sleep(50 * time.Millisecond)
+
+	// look polls a replica until its cart is expected
+	look := func(address string, expected map[string]interface{}) bool {
+		for i := 0; i < 50; i++ {
+			c.Send(address, "look", seed.Tuple{"client", "s"})
+			if tuple, ok := c.Receive("show", 100*time.Millisecond); ok && reflect.DeepEqual(tuple[2], expected) {
+				return true
+			}
+		}
+		return false
+	}
+
+	c.Send("a", "add", seed.Tuple{"s", map[string]interface{}{"added": map[string]interface{}{"t1": "x"}}})
+	if !look("b", map[string]interface{}{"added": map[string]interface{}{"t1": "x"}, "removed": []interface{}{}}) {
+		t.Fatal("b should have received x")
+	}
+
+	c.Send("b", "clear", seed.Tuple{"s"})
+	c.Send("a", "add", seed.Tuple{"s", map[string]interface{}{"added": map[string]interface{}{"t2": "y"}}})
+	expected := map[string]interface{}{"added": map[string]interface{}{"t2": "y"}, "removed": []interface{}{"t1"}}
+	for _, address := range []string{"a", "b"} {
+		if !look(address, expected) {
+			t.Errorf("%s should only have y", address)
+		}
+	}
+}
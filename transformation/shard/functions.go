@@ -0,0 +1,74 @@
+package shard
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/nathankerr/seed"
+	"hash/fnv"
+)
+
+// The functions used by the rules Transform adds.
+func init() {
+	seed.RegisterMap("shard_of", of)
+	seed.RegisterMap("shard_other", other)
+}
+
+// of returns the shard, from 0 up to its first argument, of the key
+// made of the remaining arguments. Shards are float64 so they compare
+// equal to those decoded from wsjson messages.
+func of(arguments seed.Tuple) seed.Element {
+	var shards uint32
+	switch count := arguments[0].(type) {
+	case int:
+		shards = uint32(count)
+	case int64:
+		shards = uint32(count)
+	case float64:
+		shards = uint32(count)
+	default:
+		panic(fmt.Sprintf("number of shards %v is not a number", count))
+	}
+	if shards == 0 {
+		panic("there are no shards")
+	}
+
+	// numbers encode the same whether they are ints or float64s
+	columns := []interface{}{}
+	for _, argument := range arguments[1:] {
+		columns = append(columns, normalize(argument))
+	}
+	key, err := json.Marshal(columns)
+	if err != nil {
+		panic(err)
+	}
+
+	hash := fnv.New32a()
+	hash.Write(key)
+	return float64(hash.Sum32() % shards)
+}
+
+// normalize converts msgpack's []byte strings to strings so a key
+// lands on the same shard whichever communicator it came from
+func normalize(element seed.Element) seed.Element {
+	switch typed := element.(type) {
+	case []byte:
+		return string(typed)
+	case []interface{}:
+		normalized := []interface{}{}
+		for _, e := range typed {
+			normalized = append(normalized, normalize(e))
+		}
+		return normalized
+	}
+	return element
+}
+
+// other returns its second argument, the owner of a shard, when it
+// differs from its first, this node; otherwise nil. Joining the result
+// with the routes keeps the rows owned by other nodes.
+func other(arguments seed.Tuple) seed.Element {
+	if arguments[0] == arguments[1] {
+		return nil
+	}
+	return arguments[1]
+}
@@ -0,0 +1,310 @@
+// Package shard partitions the tables of a Seed across nodes
+package shard
+
+import (
+	"fmt"
+	"github.com/nathankerr/seed"
+	"github.com/nathankerr/seed/transformation/internal/construct"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Transform partitions each table across nodes by hashing its key
+// columns.
+//
+// Two tables must be filled in when each node starts:
+//
+//	shard_node [address] => [shards]  this node's address and the
+//	                                  number of shards
+//	shard_routes [shard] => [address] the node owning each shard,
+//	                                  numbered from 0
+//
+// An input used to read or write a table is routed by the input
+// columns joined with, or written to, the table's key. The node
+// receiving a tuple hashes these columns to find its shard, and either
+// accepts the tuple or forwards it to the shard's owner on
+// <input>_routed. The rules using the input read what was accepted, so
+// each node's tables only hold the rows of its shards.
+//
+// Rules joining more than one table, or reading a table with
+// something other than an input routed by the table's key, may need
+// rows from other shards and are errors. Run it after the network
+// transformation.
+func Transform(orig *seed.Seed) (*seed.Seed, error) {
+	for _, name := range []string{node, routes} {
+		if _, ok := orig.Collections[name]; ok {
+			return nil, fmt.Errorf("%s is used by the transformation", name)
+		}
+	}
+
+	supplied := map[string]bool{}
+	for _, rule := range orig.Rules {
+		supplied[rule.Supplies] = true
+	}
+	isInput := func(collectionName string) bool {
+		collection := orig.Collections[collectionName]
+		switch collection.Type {
+		case seed.CollectionInput, seed.CollectionChannel:
+			// host inputs are local to each node
+			return !supplied[collectionName] && !collection.Host
+		}
+		return false
+	}
+
+	// find the columns each input is routed by
+	routing := map[string][]string{} // input: columns
+	for ruleNumber, rule := range orig.Rules {
+		tables := []string{}
+		inputs := []string{}
+		others := []string{}
+		for _, collectionName := range rule.Requires() {
+			switch {
+			case orig.Collections[collectionName].Type == seed.CollectionTable, orig.Collections[collectionName].Type.Lattice():
+				tables = append(tables, collectionName)
+			case isInput(collectionName):
+				inputs = append(inputs, collectionName)
+			default:
+				others = append(others, collectionName)
+			}
+		}
+
+		supplies := ""
+		if orig.Collections[rule.Supplies].Type == seed.CollectionTable || orig.Collections[rule.Supplies].Type.Lattice() {
+			supplies = rule.Supplies
+		}
+
+		switch {
+		case len(tables) > 1:
+			return nil, fmt.Errorf("rule %d joins %s, which may be on different shards", ruleNumber, strings.Join(tables, " and "))
+		case len(tables) == 1 && supplies != "" && supplies != tables[0]:
+			return nil, fmt.Errorf("rule %d writes %s from %s, which may be on different shards", ruleNumber, supplies, tables[0])
+		case len(tables) == 0 && supplies == "":
+			// does not use a table
+			continue
+		case len(inputs) == 0 && len(others) == 0:
+			// only uses tables, which are on this node
+			continue
+		case len(others) > 0:
+			table := supplies
+			if len(tables) == 1 {
+				table = tables[0]
+			}
+			return nil, fmt.Errorf("rule %d uses %s with %s, which cannot be routed to a shard", ruleNumber, strings.Join(others, ", "), table)
+		}
+
+		for _, inputName := range inputs {
+			var columns []string
+			var err error
+			if len(tables) == 1 {
+				columns, err = joinedKey(orig, rule, inputName, tables[0])
+			} else {
+				columns, err = writtenKey(orig, rule, inputName, supplies)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: %s", ruleNumber, err)
+			}
+
+			if previous, ok := routing[inputName]; ok && strings.Join(previous, ",") != strings.Join(columns, ",") {
+				return nil, fmt.Errorf("rule %d routes %s by [%s], but it is already routed by [%s]", ruleNumber, inputName, strings.Join(columns, ", "), strings.Join(previous, ", "))
+			}
+			routing[inputName] = columns
+		}
+	}
+
+	sh := &shard{
+		orig: orig,
+		s: &seed.Seed{
+			Name:        orig.Name,
+			Collections: make(map[string]*seed.Collection),
+		},
+		accepted: map[string]string{},
+		renamed:  map[string]map[string]string{},
+	}
+	for collectionName, collection := range orig.Collections {
+		sh.s.Collections[collectionName] = collection
+	}
+
+	construct.Add(sh.s, node, seed.CollectionTable, []string{"address"}, []string{"shards"})
+	construct.Add(sh.s, routes, seed.CollectionTable, []string{"shard"}, []string{"address"})
+
+	inputNames := []string{}
+	for inputName := range routing {
+		inputNames = append(inputNames, inputName)
+	}
+	sort.Strings(inputNames)
+	for _, inputName := range inputNames {
+		sh.route(inputName, routing[inputName])
+	}
+
+	for _, rule := range orig.Rules {
+		sh.s.Rules = append(sh.s.Rules, sh.rewrite(rule))
+	}
+
+	return sh.s, nil
+}
+
+// The collections added by Transform
+const (
+	node   = "shard_node"
+	routes = "shard_routes"
+)
+
+type shard struct {
+	orig     *seed.Seed
+	s        *seed.Seed
+	accepted map[string]string            // input: the scratch holding what this node accepts
+	renamed  map[string]map[string]string // input: column: accepted column
+}
+
+// joinedKey returns the input columns a rule joins with the key of a
+// table
+func joinedKey(s *seed.Seed, rule *seed.Rule, inputName string, tableName string) ([]string, error) {
+	columns := []string{}
+	for _, key := range s.Collections[tableName].Key {
+		found := false
+		for _, constraint := range rule.Predicate {
+			left, right := constraint.Left, constraint.Right
+			if right.Collection == inputName {
+				left, right = right, left
+			}
+			if left.Collection == inputName && right.Collection == tableName && right.Column == key {
+				columns = append(columns, left.Column)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%s is not joined with %s.%s, which may be on a different shard", inputName, tableName, key)
+		}
+	}
+	return columns, nil
+}
+
+// writtenKey returns the input columns a rule writes to the key of a
+// table
+func writtenKey(s *seed.Seed, rule *seed.Rule, inputName string, tableName string) ([]string, error) {
+	columns := []string{}
+	for i, key := range s.Collections[tableName].Key {
+		column, ok := rule.Intension[i].(seed.QualifiedColumn)
+		if !ok || column.Collection != inputName {
+			return nil, fmt.Errorf("%s.%s is not written from %s, so its shard is unknown", tableName, key, inputName)
+		}
+		columns = append(columns, column.Column)
+	}
+	return columns, nil
+}
+
+// route accepts the tuples of an input whose shard this node owns and
+// forwards the others to their owners
+func (sh *shard) route(inputName string, routeColumns []string) {
+	input := sh.orig.Collections[inputName]
+	inputColumns := construct.Columns(input)
+	acceptedName := inputName + "_accepted"
+	shardName := inputName + "_shard"
+	remoteName := inputName + "_remote"
+	routedName := inputName + "_routed"
+	sh.accepted[inputName] = acceptedName
+
+	// the address markers are only allowed in channels
+	renamed := map[string]string{}
+	acceptedColumns := [][]string{}
+	for _, columnNames := range [][]string{input.Key, input.Data} {
+		columns := []string{}
+		for _, column := range columnNames {
+			renamed[column] = column
+			if column[0] == '@' {
+				renamed[column] = column[1:]
+			}
+			columns = append(columns, renamed[column])
+		}
+		acceptedColumns = append(acceptedColumns, columns)
+	}
+	sh.renamed[inputName] = renamed
+	plain := append(append([]string{}, acceptedColumns[0]...), acceptedColumns[1]...)
+	shardColumn := construct.Unique("shard", plain)
+	ownerColumn := construct.Unique("owner", plain)
+
+	construct.Add(sh.s, acceptedName, seed.CollectionScratch, acceptedColumns[0], acceptedColumns[1])
+	construct.Add(sh.s, shardName, seed.CollectionScratch, acceptedColumns[0], append(append([]string{}, acceptedColumns[1]...), shardColumn))
+	construct.Add(sh.s, remoteName, seed.CollectionScratch, acceptedColumns[0], append(append([]string{}, acceptedColumns[1]...), ownerColumn))
+
+	arguments := []seed.QualifiedColumn{construct.QC(node, "shards")}
+	for _, column := range routeColumns {
+		arguments = append(arguments, construct.QC(inputName, column))
+	}
+	construct.Rule(sh.s, shardName, "<=", append(construct.ColumnsOf(inputName, inputColumns),
+		seed.MapFunction{Name: "shard_of", Arguments: arguments}))
+
+	// accept this node's shards
+	construct.Rule(sh.s, acceptedName, "<=", construct.ColumnsOf(shardName, plain),
+		construct.Constraint(shardName, shardColumn, routes, "shard"),
+		construct.Constraint(routes, "address", node, "address"))
+
+	if input.Type != seed.CollectionChannel {
+		return
+	}
+
+	// forward the others; sent rows are also kept in the sending
+	// channel, so only rows addressed to this node are accepted
+	construct.Add(sh.s, routedName, seed.CollectionChannel, input.Key, input.Data)
+	construct.Rule(sh.s, remoteName, "<=", append(construct.ColumnsOf(shardName, plain),
+		seed.MapFunction{Name: "shard_other", Arguments: []seed.QualifiedColumn{construct.QC(node, "address"), construct.QC(routes, "address")}}),
+		construct.Constraint(shardName, shardColumn, routes, "shard"))
+
+	address, _ := input.AddressColumn()
+	intension := construct.ColumnsOf(remoteName, plain)
+	intension[address] = construct.QC(remoteName, ownerColumn)
+	construct.Rule(sh.s, routedName, "<~", intension,
+		construct.Constraint(remoteName, ownerColumn, routes, "address"))
+	construct.Rule(sh.s, acceptedName, "<=", construct.ColumnsOf(routedName, inputColumns),
+		construct.Constraint(routedName, inputColumns[address], node, "address"))
+}
+
+// rewrite returns a rule reading the accepted inputs
+func (sh *shard) rewrite(rule *seed.Rule) *seed.Rule {
+	rewritten := &seed.Rule{
+		Supplies:  rule.Supplies,
+		Operation: rule.Operation,
+	}
+	for _, expression := range rule.Intension {
+		switch value := expression.(type) {
+		case seed.QualifiedColumn:
+			expression = sh.rename(value)
+		case seed.MapFunction:
+			value.Arguments = sh.renameAll(value.Arguments)
+			expression = value
+		case seed.ReduceFunction:
+			value.Arguments = sh.renameAll(value.Arguments)
+			expression = value
+		default:
+			panic(fmt.Sprintf("unhandled type: %v", reflect.TypeOf(expression).String()))
+		}
+		rewritten.Intension = append(rewritten.Intension, expression)
+	}
+	for _, constraint := range rule.Predicate {
+		rewritten.Predicate = append(rewritten.Predicate, seed.Constraint{
+			Left:  sh.rename(constraint.Left),
+			Right: sh.rename(constraint.Right),
+		})
+	}
+	return rewritten
+}
+
+// rename moves references to routed inputs to their accepted scratches
+func (sh *shard) rename(column seed.QualifiedColumn) seed.QualifiedColumn {
+	acceptedName, ok := sh.accepted[column.Collection]
+	if !ok {
+		return column
+	}
+
+	return construct.QC(acceptedName, sh.renamed[column.Collection][column.Column])
+}
+
+func (sh *shard) renameAll(columns []seed.QualifiedColumn) []seed.QualifiedColumn {
+	renamed := []seed.QualifiedColumn{}
+	for _, column := range columns {
+		renamed = append(renamed, sh.rename(column))
+	}
+	return renamed
+}
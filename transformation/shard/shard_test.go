@@ -0,0 +1,139 @@
+package shard
+
+import (
+	"fmt"
+	"github.com/nathankerr/seed"
+	executor "github.com/nathankerr/seed/host/golang"
+	"github.com/nathankerr/seed/transformation/internal/cluster"
+	"github.com/nathankerr/seed/transformation/internal/construct"
+	"github.com/nathankerr/seed/transformation/network"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTransform(t *testing.T) {
+	service, err := Transform(construct.Load(t, "kvs", network.Transform))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = service.Validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = service.ValidateFunctions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rules := map[string]bool{
+		"kvput_shard <= [kvput.@address, kvput.key, kvput.value, (shard_of shard_node.shards kvput.key)]":                              false,
+		"kvput_routed <~ [kvput_remote.owner, kvput_remote.key, kvput_remote.value]: kvput_remote.owner => shard_routes.address":       false,
+		"kvput_accepted <= [kvput_routed.@address, kvput_routed.key, kvput_routed.value]: kvput_routed.@address => shard_node.address": false,
+		"kvstate <+- [kvput_accepted.key, kvput_accepted.value]":                                                                       false,
+		"kvget_response <~ [kvget_accepted.kvget_response_addr, kvstate.key, kvstate.value]: kvget_accepted.key => kvstate.key":        false,
+	}
+	for _, rule := range service.Rules {
+		if _, ok := rules[rule.String()]; ok {
+			rules[rule.String()] = true
+		}
+	}
+	for rule, found := range rules {
+		if !found {
+			t.Errorf("missing rule %s", rule)
+		}
+	}
+}
+
+func TestCrossShard(t *testing.T) {
+	// checkout reads every log row of a cart, but log is sharded by
+	// [cart, seq]
+	_, err := Transform(construct.Load(t, "cart", network.Transform))
+	if err == nil || !strings.Contains(err.Error(), "checkout is not joined with log.seq") {
+		t.Errorf("expected a cross shard error, got %v", err)
+	}
+}
+
+func TestOf(t *testing.T) {
+	// the same key from wsjson (string) and msgpack ([]byte)
+	for shards := 2; shards < 20; shards++ {
+		fromString := of(seed.Tuple{shards, "key", 1.0})
+		fromBytes := of(seed.Tuple{float64(shards), []byte("key"), 1})
+		if fromString != fromBytes {
+			t.Errorf("%d shards: expected %v, got %v", shards, fromString, fromBytes)
+		}
+	}
+}
+
+// TestRouting runs the transformed kvs on two nodes, n0 and n1, with a
+// shard each. Puts and gets sent to n0 for a key in n1's shard are
+// routed to n1, which holds the row.
+func TestRouting(t *testing.T) {
+	c := cluster.Run(t, func() *seed.Seed {
+		service, err := Transform(construct.Load(t, "kvs", network.Transform))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return service
+	}, "n0", "n1")
+	for _, address := range []string{"n0", "n1"} {
+		c.Send(address, node, seed.Tuple{address, 2})
+		c.Send(address, routes, seed.Tuple{0.0, "n0"}, seed.Tuple{1.0, "n1"})
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// a key in each shard
+	keys := map[float64]string{}
+	for i := 0; len(keys) < 2; i++ {
+		key := fmt.Sprint("k", i)
+		keys[of(seed.Tuple{2, key}).(float64)] = key
+	}
+
+	var mutex sync.Mutex
+	routed := map[string]bool{}
+	stopped := ""
+	c.Drop(func(from string, message executor.MessageContainer) bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if message.Collection == "kvput_routed" {
+			routed[fmt.Sprint(message.Data[0][1])] = true
+		}
+		return from == stopped
+	})
+
+	// get polls a node until it returns value for key
+	get := func(address, key, value string) bool {
+		for i := 0; i < 20; i++ {
+			c.Send(address, "kvget", seed.Tuple{"client", address, key})
+			if tuple, ok := c.Receive("kvget_response", 50*time.Millisecond); ok && tuple[1] == key && tuple[2] == value {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, key := range keys {
+		c.Send("n0", "kvput", seed.Tuple{"n0", key, "v" + key})
+		if !get("n0", key, "v"+key) {
+			t.Fatalf("n0 should return the put of %s", key)
+		}
+	}
+
+	mutex.Lock()
+	if routed[keys[0]] || !routed[keys[1]] {
+		t.Errorf("expected only the put of %s to be routed, got %v", keys[1], routed)
+	}
+	stopped = "n0"
+	mutex.Unlock()
+
+	// only n1's shard is left
+	if !get("n1", keys[1], "v"+keys[1]) {
+		t.Errorf("n1 should hold %s", keys[1])
+	}
+	if get("n1", keys[0], "v"+keys[0]) {
+		t.Errorf("n1 should not hold %s", keys[0])
+	}
+}
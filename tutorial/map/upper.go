@@ -9,3 +9,7 @@ import (
 func upper(input seed.Tuple) seed.Element {
 	return strings.ToUpper(input[0].(string))
 }
+
+func init() {
+	seed.RegisterMap("upper", upper)
+}
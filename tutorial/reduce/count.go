@@ -1,7 +0,0 @@
-package main
-
-import "github.com/nathankerr/seed"
-
-func count(input []seed.Tuple) seed.Element {
-	return len(input)
-}
@@ -10,6 +10,7 @@ type Seed struct {
 // Collection describes the data managed in a service.
 type Collection struct {
 	Type CollectionType
+	Host bool `json:",omitempty"` // filled by the host with the time
 	Key  []string
 	Data []string
 }
@@ -18,7 +19,8 @@ type Collection struct {
 type CollectionType int
 
 const (
-	// CollectionInput collections receive data from outside the Seed
+	// CollectionInput collections receive data from outside the Seed.
+	// Host inputs receive the time from the host executing the Seed.
 	CollectionInput CollectionType = iota
 
 	// CollectionOutput collections transfer data from inside the Seed
@@ -34,8 +36,47 @@ const (
 
 	// CollectionChannel collections transfer data over the network.
 	CollectionChannel
+
+	// CollectionLmax collections are persistent lattices. Their data
+	// columns keep the largest value written for each key.
+	CollectionLmax
+
+	// CollectionLset collections are persistent lattices. Their data
+	// columns hold the set of the values written for each key; a list
+	// written to them adds each of its elements.
+	CollectionLset
+
+	// CollectionLcounter collections are persistent lattices counting
+	// up (G-Counters). Their data columns map replicas to counts, and
+	// keep the largest count written for each replica. The value of
+	// the counter is the sum of the counts.
+	CollectionLcounter
+
+	// CollectionLorset collections are persistent lattices holding sets
+	// which elements can be removed from (OR-Sets). Their data columns
+	// hold {"added": {tag: element}, "removed": [tag]}: each element is
+	// added with a unique tag and removed by removing the tags it was
+	// seen with, so adds the remove has not seen survive it.
+	CollectionLorset
+
+	// CollectionLregister collections are persistent lattices holding
+	// the last value written (LWW-Registers). Their data columns hold
+	// [timestamp, value] pairs, and keep the pair with the latest
+	// timestamp.
+	CollectionLregister
 )
 
+// Lattice reports whether collections of the type merge the data
+// written to them instead of overwriting it. Lattices are persistent
+// and only grow.
+func (ct CollectionType) Lattice() bool {
+	switch ct {
+	case CollectionLmax, CollectionLset, CollectionLcounter, CollectionLorset, CollectionLregister:
+		return true
+	}
+	return false
+}
+
 // A Rule describes the data manipulation possible in a service.
 type Rule struct {
 	Supplies  string
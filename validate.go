@@ -6,8 +6,8 @@ import (
 	"reflect"
 )
 
-func collectionErrorMessagef(collection *Collection, format string, args ...interface{}) error {
-	format = fmt.Sprintf("Error for collection:\n\t%s\n%s\n", collection, format)
+func collectionErrorMessagef(name string, format string, args ...interface{}) error {
+	format = fmt.Sprintf("Error for collection:\n\t%s\n%s\n", name, format)
 	return errorMessagef(format, args...)
 }
 
@@ -23,13 +23,29 @@ func errorMessagef(format string, args ...interface{}) error {
 
 // Validate validates the Seed. Any error will be returned.
 func (s *Seed) Validate() error {
-	for _, collection := range s.Collections {
+	for name, collection := range s.Collections {
 		// Type should be known
 		switch collection.Type {
-		case CollectionInput, CollectionOutput, CollectionTable, CollectionScratch, CollectionChannel:
+		case CollectionInput, CollectionOutput, CollectionTable, CollectionScratch, CollectionChannel,
+			CollectionLmax, CollectionLset, CollectionLcounter, CollectionLorset, CollectionLregister:
 			// known collection types
 		default:
-			return collectionErrorMessagef(collection, "Unknown collection type %d", collection.Type)
+			return collectionErrorMessagef(name, "Unknown collection type %d", collection.Type)
+		}
+
+		// lattices merge their data columns
+		if collection.Type.Lattice() && len(collection.Data) == 0 {
+			return collectionErrorMessagef(name, "Lattices need data columns to merge")
+		}
+
+		// the host fills host inputs with a single column, the time
+		if collection.Host {
+			if collection.Type != CollectionInput {
+				return collectionErrorMessagef(name, "Only inputs can be provided by the host")
+			}
+			if len(collection.Key)+len(collection.Data) != 1 {
+				return collectionErrorMessagef(name, "Host inputs have one column for the time")
+			}
 		}
 	}
 
@@ -48,6 +64,21 @@ func (s *Seed) Validate() error {
 			return ruleErrorMessagef(rule, "Unknown operation: %s", rule.Operation)
 		}
 
+		// lattices only grow, so they are merged into, not deleted from
+		// or overwritten; removing from an or-set merges in tombstones
+		if s.Collections[rule.Supplies].Type.Lattice() {
+			switch rule.Operation {
+			case "<=", "<+":
+				// no-op
+			case "<-":
+				if s.Collections[rule.Supplies].Type != CollectionLorset {
+					return ruleErrorMessagef(rule, "%s is a lattice; only <= and <+ can add to it, and <- only removes from an lorset", rule.Supplies)
+				}
+			default:
+				return ruleErrorMessagef(rule, "%s is a lattice; only <= and <+ can add to it, and <- only removes from an lorset", rule.Supplies)
+			}
+		}
+
 		// the intension should be valid
 		for _, expression := range rule.Intension {
 			switch value := expression.(type) {